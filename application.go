@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
 
+	"github.com/techx/playground/auth"
 	"github.com/techx/playground/config"
 	"github.com/techx/playground/db"
+	"github.com/techx/playground/mail"
 	"github.com/techx/playground/server"
 )
 
@@ -17,6 +22,12 @@ func main() {
 		port = "5000"
 	}
 	reset := flag.Bool("reset", false, "Resets the database")
+	migrate := flag.Bool("migrate", false, "Applies pending database migrations, then exits")
+	dryRun := flag.Bool("dry-run", false, "With -migrate, reports what each migration would change without changing it")
+	exportDir := flag.String("export", "", "Writes every room to JSON files in this directory, then exits")
+	importDir := flag.String("import", "", "Replaces rooms with the JSON files in this directory, then exits")
+	logQuery := flag.String("logs", "", "Prints packet logs matching a query like characterId=<id>&type=chat&since=<time>&until=<time>&limit=100 as NDJSON, then exits")
+	reseed := flag.String("reseed", "", "Rebuilds events, sponsors, rooms, or room:<id> from the config files without a reset, then exits")
 
 	flag.Usage = func() {
 		fmt.Println("Usage: server -e {mode} -p {port}")
@@ -27,5 +38,91 @@ func main() {
 
 	config.Init(*environment)
 	db.Init(*reset)
+
+	if *migrate {
+		if err := db.Migrate(*dryRun); err != nil {
+			log.Fatalln("ERROR: Unable to migrate database ->", err)
+		}
+
+		return
+	}
+
+	if *exportDir != "" {
+		count, err := db.ExportWorld(*exportDir)
+
+		if err != nil {
+			log.Fatalln("ERROR: Unable to export world ->", err)
+		}
+
+		log.Println("Exported", count, "rooms to", *exportDir)
+		return
+	}
+
+	if *importDir != "" {
+		count, err := db.ImportWorld(*importDir)
+
+		if err != nil {
+			log.Fatalln("ERROR: Unable to import world ->", err)
+		}
+
+		log.Println("Imported", count, "rooms from", *importDir)
+		return
+	}
+
+	if *logQuery != "" {
+		if err := printLogs(*logQuery); err != nil {
+			log.Fatalln("ERROR: Unable to query logs ->", err)
+		}
+
+		return
+	}
+
+	if *reseed != "" {
+		if err := db.Reseed(*reseed); err != nil {
+			log.Fatalln("ERROR: Unable to reseed ->", err)
+		}
+
+		return
+	}
+
+	if err := auth.Init(); err != nil {
+		log.Fatalln("ERROR: Unable to set up login providers ->", err)
+	}
+
+	if err := mail.Init(); err != nil {
+		log.Fatalln("ERROR: Unable to set up mail ->", err)
+	}
+
 	server.Init(port)
 }
+
+// Prints the packet logs that match a query, one per line
+func printLogs(query string) error {
+	values, err := url.ParseQuery(query)
+
+	if err != nil {
+		return err
+	}
+
+	filter, err := db.ParseLogFilter(values)
+
+	if err != nil {
+		return err
+	}
+
+	logs, err := db.QueryLogs(filter)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for _, entry := range logs {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
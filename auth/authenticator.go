@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a provider doesn't recognize
+	// someone's credentials
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrNotAdmitted is returned for people the provider knows about, but who
+	// aren't allowed into Playground (e.g. hackers who weren't admitted)
+	ErrNotAdmitted = errors.New("not admitted")
+)
+
+// Credentials are whatever a client sent to log in with. Each provider only
+// looks at the fields it understands
+type Credentials struct {
+	// Optional -- names the provider to use instead of picking the first one
+	// that accepts these credentials
+	Provider string
+
+	// Tokens from IssueTokens, for people who have logged in before
+	Token        string
+	RefreshToken string
+
+	// A single sign-on token from Quill
+	QuillToken string
+
+	// An email address, and the code we sent to it
+	Email string
+	Code  int
+
+	// An ID token from an OpenID Connect provider
+	IDToken string
+}
+
+// Identity is who a provider says someone is
+type Identity struct {
+	// Set by providers that already know which character this is, like our
+	// own tokens
+	CharacterID string
+
+	// Identifies this person within the provider, e.g. their Quill ID. Linked
+	// to a character the first time they log in. Providers that only know
+	// someone's email leave this empty, and they're matched by email instead
+	Subject string
+
+	// Their email address, if the provider has checked it
+	Email string
+
+	// Starting point for their character if they've never logged in before
+	Character *models.Character
+}
+
+// Authenticator is an identity provider that people can log in through
+type Authenticator interface {
+	// Name identifies this provider in the config
+	Name() string
+
+	// Accepts returns true if these credentials are meant for this provider
+	Accepts(creds *Credentials) bool
+
+	// Remote returns true if Authenticate calls out to another service, in
+	// which case it should run in the background
+	Remote() bool
+
+	// Authenticate checks the credentials, returning ErrInvalidCredentials or
+	// ErrNotAdmitted if this person can't log in. Other errors are worth
+	// retrying
+	Authenticate(ctx context.Context, creds *Credentials) (*Identity, error)
+}
+
+var (
+	providersMu sync.RWMutex
+
+	// Every provider that could be turned on, keyed by name
+	factories = map[string]func() (Authenticator, error){}
+
+	// The providers turned on in the config, in the order they're tried
+	enabled []Authenticator
+)
+
+// Register makes a provider available to turn on in auth.providers. newProvider
+// reads the provider's settings from the config, and is only called if it's
+// turned on
+func Register(name string, newProvider func() (Authenticator, error)) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	factories[name] = newProvider
+}
+
+// Init sets up the providers listed in auth.providers
+func Init() error {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	enabled = nil
+
+	for _, name := range config.GetConfig().GetStringSlice("auth.providers") {
+		newProvider, ok := factories[name]
+
+		if !ok {
+			return fmt.Errorf("unknown login provider %s", name)
+		}
+
+		provider, err := newProvider()
+
+		if err != nil {
+			return fmt.Errorf("unable to set up login provider %s: %w", name, err)
+		}
+
+		enabled = append(enabled, provider)
+	}
+
+	return nil
+}
+
+// Find returns the provider that should check these credentials, or false if
+// no provider that's turned on can
+func Find(creds *Credentials) (Authenticator, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	for _, provider := range enabled {
+		if creds.Provider != "" && provider.Name() != creds.Provider {
+			continue
+		}
+
+		if provider.Accepts(creds) {
+			return provider, true
+		}
+	}
+
+	return nil, false
+}
+
+// Login returns the character someone logged in as through a provider,
+// creating one if it's their first time. firstTime is true for new characters,
+// who still have to set up their account
+func Login(provider string, identity *Identity) (character *models.Character, firstTime bool, err error) {
+	characters := db.GetStore().Characters
+	characterID := identity.CharacterID
+
+	if characterID == "" {
+		if identity.Subject != "" {
+			characterID, err = characters.IDForIdentity(provider, identity.Subject)
+		} else if identity.Email != "" {
+			characterID, err = characters.IDForEmail(identity.Email)
+		} else {
+			return nil, false, ErrInvalidCredentials
+		}
+
+		if err == db.ErrNotFound {
+			character, err = createCharacter(provider, identity)
+			return character, true, err
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+
+	character, err = characters.Get(characterID)
+
+	if err == db.ErrNotFound {
+		return nil, false, ErrInvalidCredentials
+	}
+
+	return character, false, err
+}
+
+// Creates a character for someone who has never logged in before, and links
+// them to it so that they get the same one next time
+func createCharacter(provider string, identity *Identity) (*models.Character, error) {
+	character := identity.Character
+
+	if character == nil {
+		character = models.NewCharacter("Player")
+	}
+
+	character.ID = uuid.New().String()
+	character.Email = identity.Email
+
+	characters := db.GetStore().Characters
+
+	if err := characters.Create(character); err != nil {
+		return nil, err
+	}
+
+	if identity.Subject != "" {
+		if err := characters.LinkIdentity(provider, identity.Subject, character.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if identity.Email != "" {
+		if err := characters.LinkEmail(identity.Email, character.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return character, nil
+}
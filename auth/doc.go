@@ -0,0 +1,4 @@
+// Package auth logs people in through whichever identity providers are turned
+// on in the config (auth.providers), and issues the tokens that log them back
+// in afterwards
+package auth
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+)
+
+// Login codes are six digits
+const maxCode = 1000000
+
+// ErrTooManyCodes is returned by IssueCode when an email has asked for more
+// than auth.email.max_requests codes in the last
+// auth.email.request_window_minutes
+var ErrTooManyCodes = errors.New("too many login codes requested")
+
+func init() {
+	Register("email", func() (Authenticator, error) {
+		return emailAuthenticator{}, nil
+	})
+}
+
+// Logs in sponsors, mentors, and organizers with a code we emailed them
+type emailAuthenticator struct{}
+
+func (emailAuthenticator) Name() string {
+	return "email"
+}
+
+func (emailAuthenticator) Accepts(creds *Credentials) bool {
+	return creds.Email != ""
+}
+
+func (emailAuthenticator) Remote() bool {
+	return false
+}
+
+func (emailAuthenticator) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	email := strings.ToLower(strings.TrimSpace(creds.Email))
+	maxAttempts := config.GetConfig().GetInt("auth.email.max_attempts")
+	valid, err := db.GetStore().Logins.CheckCode(email, creds.Code, maxAttempts)
+
+	if err != nil {
+		return nil, err
+	} else if !valid {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{
+		Email:     email,
+		Character: newCharacterForEmail(email, models.Organizer),
+	}, nil
+}
+
+// IssueCode makes a new login code for an email, replacing whichever one it had
+// before. Codes expire after auth.email.code_ttl_minutes, and only work once
+func IssueCode(email string) (int, error) {
+	cfg := config.GetConfig()
+	logins := db.GetStore().Logins
+
+	window := time.Duration(cfg.GetInt("auth.email.request_window_minutes")) * time.Minute
+	requests, err := logins.CountCodeRequest(email, window)
+
+	if err != nil {
+		return 0, err
+	} else if requests > cfg.GetInt("auth.email.max_requests") {
+		return 0, ErrTooManyCodes
+	}
+
+	// Codes are all that stands between someone and an organizer's account,
+	// so they shouldn't be guessable
+	n, err := rand.Int(rand.Reader, big.NewInt(maxCode))
+
+	if err != nil {
+		return 0, err
+	}
+
+	code := int(n.Int64())
+	ttl := time.Duration(cfg.GetInt("auth.email.code_ttl_minutes")) * time.Minute
+
+	if err := logins.AddCode(email, code, ttl); err != nil {
+		return 0, err
+	}
+
+	return code, nil
+}
+
+// Starts a character for someone logging in for the first time, with whichever
+// role an organizer added their email under, or role if they weren't added
+func newCharacterForEmail(email string, role models.Role) *models.Character {
+	character := models.NewCharacter("Player")
+	character.Role = int(role)
+	logins := db.GetStore().Logins
+
+	if isSponsor, _ := logins.HasEmail(models.SponsorRep, email); isSponsor {
+		character.Role = int(models.SponsorRep)
+		character.SponsorID, _ = logins.SponsorForEmail(email)
+	} else if isMentor, _ := logins.HasEmail(models.Mentor, email); isMentor {
+		character.Role = int(models.Mentor)
+	} else if isOrganizer, _ := logins.HasEmail(models.Organizer, email); isOrganizer {
+		character.Role = int(models.Organizer)
+	}
+
+	return character
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+
+	"github.com/google/uuid"
+)
+
+// Returns a new email that nobody has used yet, since the store is shared
+// between tests
+func newTestEmail() string {
+	return uuid.New().String() + "@example.com"
+}
+
+func TestIssueCode(t *testing.T) {
+	email := newTestEmail()
+	a := emailAuthenticator{}
+
+	code, err := IssueCode(email)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code < 0 || code >= maxCode {
+		t.Errorf("expected a six digit code, got %d", code)
+	}
+
+	tests := []struct {
+		name  string
+		creds *Credentials
+		ok    bool
+	}{
+		{"wrong code", &Credentials{Email: email, Code: (code + 1) % maxCode}, false},
+		{"other email", &Credentials{Email: newTestEmail(), Code: code}, false},
+
+		// Emails are matched no matter how they're typed
+		{"right code", &Credentials{Email: "  " + email + " ", Code: code}, true},
+
+		// Codes only work once
+		{"used code", &Credentials{Email: email, Code: code}, false},
+	}
+
+	for _, test := range tests {
+		identity, err := a.Authenticate(context.Background(), test.creds)
+
+		if !test.ok {
+			if err != ErrInvalidCredentials {
+				t.Errorf("%s: expected ErrInvalidCredentials, got %v", test.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if identity.Email != email {
+			t.Errorf("%s: expected %s, got %s", test.name, email, identity.Email)
+		}
+	}
+}
+
+func TestIssueCodeLimit(t *testing.T) {
+	email := newTestEmail()
+	maxRequests := config.GetConfig().GetInt("auth.email.max_requests")
+
+	for i := 0; i < maxRequests; i++ {
+		if _, err := IssueCode(email); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+
+	if _, err := IssueCode(email); err != ErrTooManyCodes {
+		t.Errorf("expected ErrTooManyCodes, got %v", err)
+	}
+
+	// Other emails have their own limit
+	if _, err := IssueCode(newTestEmail()); err != nil {
+		t.Errorf("expected another email to get a code, got %v", err)
+	}
+}
+
+func TestEmailRoles(t *testing.T) {
+	logins := db.GetStore().Logins
+
+	tests := []struct {
+		role    models.Role
+		sponsor string
+	}{
+		{models.SponsorRep, "acme"},
+		{models.Mentor, ""},
+		{models.Organizer, ""},
+	}
+
+	for _, test := range tests {
+		email := newTestEmail()
+		logins.AddEmail(test.role, email, test.sponsor)
+		code, _ := IssueCode(email)
+
+		identity, err := emailAuthenticator{}.Authenticate(context.Background(), &Credentials{Email: email, Code: code})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if identity.Character.Role != int(test.role) || identity.Character.SponsorID != test.sponsor {
+			t.Errorf("%s: expected role %d with sponsor %q, got %d with %q", email, test.role, test.sponsor,
+				identity.Character.Role, identity.Character.SponsorID)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/jobs"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// How long we trust an issuer's keys before fetching them again
+	jwksMaxAge = time.Hour
+
+	// Tokens signed with a key we haven't seen make us fetch the keys again,
+	// but no more often than this, so bad tokens can't flood the issuer
+	jwksMinRefresh = 30 * time.Second
+)
+
+func init() {
+	Register("oidc", func() (Authenticator, error) {
+		issuer := strings.TrimSuffix(config.GetConfig().GetString("auth.oidc.issuer"), "/")
+		clientID := config.GetConfig().GetString("auth.oidc.client_id")
+
+		if issuer == "" || clientID == "" {
+			return nil, errors.New("auth.oidc.issuer and auth.oidc.client_id have to be set")
+		}
+
+		return &oidcAuthenticator{
+			issuer:   issuer,
+			clientID: clientID,
+			jwksURL:  config.GetConfig().GetString("auth.oidc.jwks_url"),
+		}, nil
+	})
+}
+
+// Logs people in with an ID token from any OpenID Connect provider, e.g. an
+// event's own registration system. Clients get the token from the provider
+// themselves, and we check its signature against the issuer's published keys
+type oidcAuthenticator struct {
+	issuer   string
+	clientID string
+
+	// Guards everything below
+	mu sync.Mutex
+
+	// Where the issuer publishes its keys. Looked up from the issuer's
+	// discovery document unless it's set in the config
+	jwksURL string
+
+	// The issuer's signing keys, keyed by ID, and when we last fetched them
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func (a *oidcAuthenticator) Name() string {
+	return "oidc"
+}
+
+func (a *oidcAuthenticator) Accepts(creds *Credentials) bool {
+	return creds.IDToken != ""
+}
+
+func (a *oidcAuthenticator) Remote() bool {
+	return true
+}
+
+func (a *oidcAuthenticator) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	// Problems reaching the issuer are worth retrying, unlike bad tokens
+	var fetchErr error
+
+	token, err := jwt.Parse(creds.IDToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, ErrInvalidCredentials
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, err := a.key(ctx, kid)
+
+		if err != nil && err != ErrInvalidCredentials {
+			fetchErr = err
+		}
+
+		return key, err
+	})
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	} else if err != nil || !token.Valid {
+		return nil, ErrInvalidCredentials
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != a.issuer {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !a.audienceMatches(claims) {
+		return nil, ErrInvalidCredentials
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	if subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	identity := &Identity{Subject: subject}
+
+	// Only trust emails the issuer has checked, since they link to existing
+	// characters and roles
+	if verified, _ := claims["email_verified"].(bool); verified {
+		identity.Email, _ = claims["email"].(string)
+		identity.Email = strings.ToLower(identity.Email)
+	}
+
+	// Anyone can have an account with the issuer, so they're only hackers
+	// unless an organizer added their email
+	if identity.Email != "" {
+		identity.Character = newCharacterForEmail(identity.Email, models.Hacker)
+	} else {
+		identity.Character = models.NewCharacter("Player")
+		identity.Character.Role = int(models.Hacker)
+	}
+
+	if name, _ := claims["name"].(string); name != "" {
+		identity.Character.Name = name
+	}
+
+	return identity, nil
+}
+
+// Returns true if the token was issued to us. aud can be a string or a list,
+// and tokens for several audiences say which one they're meant for in azp
+func (a *oidcAuthenticator) audienceMatches(claims jwt.MapClaims) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == a.clientID
+	case []interface{}:
+		found := false
+
+		for _, value := range aud {
+			if value == a.clientID {
+				found = true
+			}
+		}
+
+		if azp, ok := claims["azp"].(string); ok && len(aud) > 1 {
+			return found && azp == a.clientID
+		}
+
+		return found
+	}
+
+	return false
+}
+
+// Returns the issuer's key with this ID, fetching the keys again if they're
+// old or we haven't seen this one before. Tokens without a key ID are fine as
+// long as the issuer only has one key
+func (a *oidcAuthenticator) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, ok := a.lookupKey(kid)
+	age := time.Since(a.fetchedAt)
+
+	if (ok && age < jwksMaxAge) || (!ok && age < jwksMinRefresh) {
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+
+		return key, nil
+	}
+
+	if err := a.fetchKeys(ctx); err != nil {
+		if ok {
+			// Better to keep using old keys than to lock everyone out
+			return key, nil
+		}
+
+		return nil, err
+	}
+
+	if key, ok = a.lookupKey(kid); !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return key, nil
+}
+
+// Must be called while holding a.mu
+func (a *oidcAuthenticator) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+// Fetches the issuer's RSA signing keys. Must be called while holding a.mu
+func (a *oidcAuthenticator) fetchKeys(ctx context.Context) error {
+	// Even if this fails, wait a bit before trying again
+	a.fetchedAt = time.Now()
+
+	if a.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+
+		if err := getJSON(ctx, a.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return err
+		}
+
+		if discovery.JWKSURI == "" {
+			return errors.New("issuer's discovery document doesn't have a jwks_uri")
+		}
+
+		a.jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := getJSON(ctx, a.jwksURL, &jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+
+		if err != nil {
+			continue
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	a.keys = keys
+	return nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if err := jobs.CheckResponse(res); err != nil {
+		return err
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
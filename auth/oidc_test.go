@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testClientID = "playground"
+
+func TestMain(m *testing.M) {
+	// The config and seed data are loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
+	config.Init("test")
+	config.GetConfig().Set("db.backend", "memory")
+	db.Init(false)
+
+	os.Exit(m.Run())
+}
+
+// A fake OpenID Connect provider, serving a discovery document and a JWKS
+type testIssuer struct {
+	server *httptest.Server
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PrivateKey
+
+	// How many times the JWKS has been fetched
+	jwksFetches int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+	issuer.addKey(t, "key-1")
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issuer.jwksFetches, 1)
+
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+
+		keys := []map[string]string{}
+
+		for kid, key := range issuer.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// Generates a new signing key and starts publishing it
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.mu.Lock()
+	i.keys[kid] = key
+	i.mu.Unlock()
+}
+
+// Returns claims for a valid token from this issuer, which tests can change
+// before signing
+func (i *testIssuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            i.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"email":          "Hacker@Example.com",
+		"email_verified": true,
+		"name":           "Ada",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	i.mu.Lock()
+	key := i.keys[kid]
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func (i *testIssuer) authenticator() *oidcAuthenticator {
+	return &oidcAuthenticator{
+		issuer:   i.server.URL,
+		clientID: testClientID,
+	}
+}
+
+func TestOIDCValidToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a := issuer.authenticator()
+
+	identity, err := a.Authenticate(context.Background(), &Credentials{IDToken: issuer.sign(t, "key-1", issuer.claims())})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Subject != "user-1" {
+		t.Errorf("expected subject user-1, got %s", identity.Subject)
+	}
+
+	if identity.Email != "hacker@example.com" {
+		t.Errorf("expected the email to be lowercased, got %s", identity.Email)
+	}
+
+	if identity.Character.Name != "Ada" {
+		t.Errorf("expected the character to be named after the token, got %s", identity.Character.Name)
+	}
+
+	// Anyone can have an account with the issuer, so they're only hackers
+	if identity.Character.Role != int(models.Hacker) {
+		t.Errorf("expected the hacker role, got %d", identity.Character.Role)
+	}
+
+	// The keys were looked up through the discovery document
+	if a.jwksURL != issuer.server.URL+"/jwks" {
+		t.Errorf("unexpected JWKS URL %s", a.jwksURL)
+	}
+}
+
+func TestOIDCInvalidTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a := issuer.authenticator()
+
+	tests := []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+	}{
+		{"wrong audience", func(claims jwt.MapClaims) {
+			claims["aud"] = "someone-else"
+		}},
+		{"wrong audience in a list", func(claims jwt.MapClaims) {
+			claims["aud"] = []string{"someone-else", "another"}
+		}},
+		{"wrong issuer", func(claims jwt.MapClaims) {
+			claims["iss"] = "https://evil.example.com"
+		}},
+		{"expired", func(claims jwt.MapClaims) {
+			claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+		{"no subject", func(claims jwt.MapClaims) {
+			delete(claims, "sub")
+		}},
+	}
+
+	for _, test := range tests {
+		claims := issuer.claims()
+		test.change(claims)
+
+		_, err := a.Authenticate(context.Background(), &Credentials{IDToken: issuer.sign(t, "key-1", claims)})
+
+		if err != ErrInvalidCredentials {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", test.name, err)
+		}
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a := issuer.authenticator()
+
+	if err := db.GetStore().Logins.AddEmail(models.Organizer, "organizer@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.claims()
+	claims["email"] = "organizer@example.com"
+	claims["email_verified"] = false
+
+	identity, err := a.Authenticate(context.Background(), &Credentials{IDToken: issuer.sign(t, "key-1", claims)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unverified emails could belong to anyone, so they can't pick up roles
+	if identity.Email != "" {
+		t.Errorf("expected no email, got %s", identity.Email)
+	}
+
+	if identity.Character.Role != int(models.Hacker) {
+		t.Errorf("expected an unverified email to get the hacker role, got %d", identity.Character.Role)
+	}
+
+	// The same email does get the role once it's verified
+	claims["email_verified"] = true
+	identity, err = a.Authenticate(context.Background(), &Credentials{IDToken: issuer.sign(t, "key-1", claims)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Character.Role != int(models.Organizer) {
+		t.Errorf("expected the organizer role, got %d", identity.Character.Role)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a := issuer.authenticator()
+
+	if _, err := a.Authenticate(context.Background(), &Credentials{IDToken: issuer.sign(t, "key-1", issuer.claims())}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches := atomic.LoadInt32(&issuer.jwksFetches); fetches != 1 {
+		t.Fatalf("expected 1 JWKS fetch, got %d", fetches)
+	}
+
+	issuer.addKey(t, "key-2")
+	token := issuer.sign(t, "key-2", issuer.claims())
+
+	// Right after a fetch, unknown keys don't make us fetch again
+	if _, err := a.Authenticate(context.Background(), &Credentials{IDToken: token}); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	if fetches := atomic.LoadInt32(&issuer.jwksFetches); fetches != 1 {
+		t.Errorf("expected no refetch so soon, got %d fetches", fetches)
+	}
+
+	// Once the keys are old enough, an unknown key fetches them again
+	a.mu.Lock()
+	a.fetchedAt = time.Now().Add(-jwksMinRefresh)
+	a.mu.Unlock()
+
+	if _, err := a.Authenticate(context.Background(), &Credentials{IDToken: token}); err != nil {
+		t.Errorf("expected the new key to work, got %v", err)
+	}
+
+	if fetches := atomic.LoadInt32(&issuer.jwksFetches); fetches != 2 {
+		t.Errorf("expected the JWKS to be fetched again, got %d fetches", fetches)
+	}
+
+	// Keys the issuer never published still don't work
+	issuer.mu.Lock()
+	unpublished, _ := rsa.GenerateKey(rand.Reader, 2048)
+	issuer.mu.Unlock()
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims())
+	forged.Header["kid"] = "key-1"
+	signed, _ := forged.SignedString(unpublished)
+
+	if _, err := a.Authenticate(context.Background(), &Credentials{IDToken: signed}); err != ErrInvalidCredentials {
+		t.Errorf("expected a token signed with an unpublished key to fail, got %v", err)
+	}
+}
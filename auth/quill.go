@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/jobs"
+)
+
+func init() {
+	Register("quill", func() (Authenticator, error) {
+		exchangeURL := config.GetConfig().GetString("auth.quill.exchange_url")
+
+		if exchangeURL == "" {
+			return nil, errors.New("auth.quill.exchange_url isn't set")
+		}
+
+		return quillAuthenticator{exchangeURL}, nil
+	})
+}
+
+// Logs in hackers through Quill's single sign-on, by exchanging their SSO token
+// for their profile
+type quillAuthenticator struct {
+	exchangeURL string
+}
+
+func (quillAuthenticator) Name() string {
+	return "quill"
+}
+
+func (quillAuthenticator) Accepts(creds *Credentials) bool {
+	return creds.QuillToken != ""
+}
+
+func (quillAuthenticator) Remote() bool {
+	return true
+}
+
+func (a quillAuthenticator) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	quillBody, _ := json.Marshal(map[string]string{
+		"token": creds.QuillToken,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.exchangeURL, bytes.NewBuffer(quillBody))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if err := jobs.CheckResponse(res); err != nil {
+		if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			// Likely invalid SSO token
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var quillData models.QuillResponse
+
+	if err := json.Unmarshal(body, &quillData); err != nil || quillData.ID == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !quillData.Status.Admitted || !quillData.Status.Confirmed {
+		// Don't allow non-admitted hackers to access Playground
+		return nil, ErrNotAdmitted
+	}
+
+	return &Identity{
+		Subject:   quillData.ID,
+		Email:     quillData.Email,
+		Character: models.NewCharacterFromQuill(quillData.Profile),
+	}, nil
+}
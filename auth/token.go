@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// Tokens come in two kinds. Access tokens are short-lived, and are what
+// clients join with. Refresh tokens last longer, but can only be used once, to
+// get a new pair of tokens after the access token expires
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+func init() {
+	Register("jwt", func() (Authenticator, error) {
+		return tokenAuthenticator{}, nil
+	})
+}
+
+// Tokens are what IssueTokens gives out
+type Tokens struct {
+	Token        string
+	RefreshToken string
+}
+
+// Claims are what a token says about itself
+type Claims struct {
+	// Unique to each token, so that it can be revoked
+	ID string
+
+	CharacterID string
+	Refresh     bool
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+
+	// The character's token generation when this was issued (see RevokeAll)
+	Generation int
+}
+
+// IssueTokens returns a new access token and refresh token for a character, so
+// that they don't have to go through their provider every time they connect
+func IssueTokens(characterID string) (*Tokens, error) {
+	now := time.Now()
+	accessLifetime := time.Duration(config.GetConfig().GetInt("auth.tokens.access_minutes")) * time.Minute
+	refreshLifetime := time.Duration(config.GetConfig().GetInt("auth.tokens.refresh_days")) * 24 * time.Hour
+
+	generation, err := db.GetStore().Tokens.Generation(characterID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := signToken(characterID, accessToken, generation, now, accessLifetime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := signToken(characterID, refreshToken, generation, now, refreshLifetime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{token, refresh}, nil
+}
+
+// Signs a token with the current signing key, named in its kid header
+func signToken(characterID, kind string, generation int, now time.Time, lifetime time.Duration) (string, error) {
+	keyID := config.GetConfig().GetString("auth.tokens.key_id")
+	secret := signingKey(keyID)
+
+	if secret == "" {
+		return "", errors.New("no secret for signing key " + keyID)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  characterID,
+		"typ": kind,
+		"jti": uuid.New().String(),
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+		"gen": generation,
+	})
+
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+
+	return token.SignedString([]byte(secret))
+}
+
+// Returns the secret for a signing key. Keys are rotated by adding a new
+// JWT_SECRET_<key ID> and switching auth.tokens.key_id over to it, while
+// keeping the old key ID in auth.tokens.previous_key_ids until every token
+// signed with it has expired. Tokens without a key ID use JWT_SECRET
+func signingKey(keyID string) string {
+	if keyID == "" {
+		return config.GetSecret(config.JWTSecret)
+	}
+
+	return config.GetSecret(config.Secret(config.JWTSecret + "_" + keyID))
+}
+
+// Returns true if tokens signed with this key are still accepted
+func acceptedKey(keyID string) bool {
+	if keyID == config.GetConfig().GetString("auth.tokens.key_id") {
+		return true
+	}
+
+	for _, previous := range config.GetConfig().GetStringSlice("auth.tokens.previous_key_ids") {
+		if keyID == previous {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseToken checks an access token from IssueTokens, and returns what it says
+// about itself. Returns ErrInvalidCredentials for tokens that are expired or
+// revoked
+func ParseToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, accessToken)
+}
+
+// ParseRefreshToken is ParseToken for refresh tokens
+func ParseRefreshToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, refreshToken)
+}
+
+func parseToken(tokenString, kind string) (*Claims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		keyID, _ := token.Header["kid"].(string)
+
+		if !acceptedKey(keyID) {
+			return nil, fmt.Errorf("Unknown signing key: %v", keyID)
+		}
+
+		return []byte(signingKey(keyID)), nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidCredentials
+	}
+
+	mapClaims, _ := token.Claims.(jwt.MapClaims)
+	claims := &Claims{}
+	claims.ID, _ = mapClaims["jti"].(string)
+	claims.CharacterID, _ = mapClaims["id"].(string)
+	claims.Refresh = mapClaims["typ"] == refreshToken
+
+	// Tokens issued before they could expire don't have any of these, and
+	// aren't accepted anymore
+	issuedAt, _ := mapClaims["iat"].(float64)
+	expiresAt, _ := mapClaims["exp"].(float64)
+	claims.IssuedAt = time.Unix(int64(issuedAt), 0)
+	claims.ExpiresAt = time.Unix(int64(expiresAt), 0)
+
+	generation, _ := mapClaims["gen"].(float64)
+	claims.Generation = int(generation)
+
+	if claims.ID == "" || claims.CharacterID == "" || issuedAt == 0 || expiresAt == 0 || mapClaims["typ"] != kind {
+		return nil, ErrInvalidCredentials
+	}
+
+	if revoked, err := isRevoked(claims); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, ErrInvalidCredentials
+	}
+
+	return claims, nil
+}
+
+// Returns true if this token was revoked, either on its own or along with
+// every other token its character had at the time
+func isRevoked(claims *Claims) (bool, error) {
+	revoked, err := db.GetStore().Tokens.IsRevoked(claims.ID)
+
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	generation, err := db.GetStore().Tokens.Generation(claims.CharacterID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return claims.Generation < generation, nil
+}
+
+// Revoke makes a token unusable from now on. Returns false if it had already
+// been revoked
+func Revoke(claims *Claims) (bool, error) {
+	return db.GetStore().Tokens.Revoke(claims.ID, claims.ExpiresAt)
+}
+
+// RevokeAll makes every token a character has been issued so far unusable, so
+// they have to log in through their provider again everywhere
+func RevokeAll(characterID string) error {
+	return db.GetStore().Tokens.RevokeAll(characterID)
+}
+
+// Logs people back in with the tokens we gave them last time
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Name() string {
+	return "jwt"
+}
+
+func (tokenAuthenticator) Accepts(creds *Credentials) bool {
+	return creds.Token != "" || creds.RefreshToken != ""
+}
+
+func (tokenAuthenticator) Remote() bool {
+	return false
+}
+
+func (tokenAuthenticator) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	if creds.Token != "" {
+		claims, err := ParseToken(creds.Token)
+
+		if err == nil {
+			return &Identity{CharacterID: claims.CharacterID}, nil
+		} else if err != ErrInvalidCredentials || creds.RefreshToken == "" {
+			return nil, err
+		}
+
+		// Their access token has probably expired, so fall back to the
+		// refresh token
+	}
+
+	claims, err := ParseRefreshToken(creds.RefreshToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh tokens only work once, so a stolen one is no good after its
+	// owner has used it
+	if first, err := Revoke(claims); err != nil {
+		return nil, err
+	} else if !first {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{CharacterID: claims.CharacterID}, nil
+}
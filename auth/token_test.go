@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/config"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// Signs tokens with the given key for the rest of the test
+func useSigningKey(t *testing.T, keyID, secret string, previousKeyIDs ...string) {
+	secretName := string(config.JWTSecret)
+
+	if keyID != "" {
+		secretName += "_" + keyID
+	}
+
+	oldSecret, hadSecret := os.LookupEnv(secretName)
+	oldKeyID := config.GetConfig().GetString("auth.tokens.key_id")
+	oldPreviousKeyIDs := config.GetConfig().GetStringSlice("auth.tokens.previous_key_ids")
+
+	os.Setenv(secretName, secret)
+	config.GetConfig().Set("auth.tokens.key_id", keyID)
+	config.GetConfig().Set("auth.tokens.previous_key_ids", previousKeyIDs)
+
+	t.Cleanup(func() {
+		if hadSecret {
+			os.Setenv(secretName, oldSecret)
+		} else {
+			os.Unsetenv(secretName)
+		}
+
+		config.GetConfig().Set("auth.tokens.key_id", oldKeyID)
+		config.GetConfig().Set("auth.tokens.previous_key_ids", oldPreviousKeyIDs)
+	})
+}
+
+func TestIssueTokens(t *testing.T) {
+	useSigningKey(t, "", "secret")
+	characterID := uuid.New().String()
+
+	tokens, err := IssueTokens(characterID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseToken(tokens.Token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.CharacterID != characterID || claims.Refresh || claims.ID == "" {
+		t.Errorf("unexpected access token claims %+v", claims)
+	}
+
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt); lifetime != time.Hour {
+		t.Errorf("expected access tokens to last an hour, got %v", lifetime)
+	}
+
+	refreshClaims, err := ParseRefreshToken(tokens.RefreshToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshClaims.CharacterID != characterID || !refreshClaims.Refresh || refreshClaims.ID == claims.ID {
+		t.Errorf("unexpected refresh token claims %+v", refreshClaims)
+	}
+
+	// Each kind of token only works as itself
+	if _, err := ParseToken(tokens.RefreshToken); err != ErrInvalidCredentials {
+		t.Errorf("refresh tokens shouldn't work as access tokens, got %v", err)
+	}
+
+	if _, err := ParseRefreshToken(tokens.Token); err != ErrInvalidCredentials {
+		t.Errorf("access tokens shouldn't work as refresh tokens, got %v", err)
+	}
+}
+
+func TestParseTokenInvalid(t *testing.T) {
+	useSigningKey(t, "", "secret")
+	now := time.Now()
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"id":  uuid.New().String(),
+			"typ": accessToken,
+			"jti": uuid.New().String(),
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+	}
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not a token"},
+		{"wrong secret", sign(jwt.SigningMethodHS256, []byte("wrong"), claims())},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims())},
+		{"expired", func() string {
+			c := claims()
+			c["iat"] = now.Add(-2 * time.Hour).Unix()
+			c["exp"] = now.Add(-time.Hour).Unix()
+			return sign(jwt.SigningMethodHS256, []byte("secret"), c)
+		}()},
+		{"no expiry", func() string {
+			c := claims()
+			delete(c, "exp")
+			return sign(jwt.SigningMethodHS256, []byte("secret"), c)
+		}()},
+		{"no ID", func() string {
+			c := claims()
+			delete(c, "jti")
+			return sign(jwt.SigningMethodHS256, []byte("secret"), c)
+		}()},
+
+		// Tokens from before they could expire only had the character ID
+		{"old token", sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"id": uuid.New().String()})},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseToken(test.token); err != ErrInvalidCredentials {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", test.name, err)
+		}
+	}
+
+	if _, err := ParseToken(sign(jwt.SigningMethodHS256, []byte("secret"), claims())); err != nil {
+		t.Errorf("expected a valid token to work, got %v", err)
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	useSigningKey(t, "old", "old-secret")
+	tokens, _ := IssueTokens(uuid.New().String())
+
+	tests := []struct {
+		name     string
+		previous []string
+		ok       bool
+	}{
+		{"still listed", []string{"old"}, true},
+		{"retired", nil, false},
+	}
+
+	for _, test := range tests {
+		useSigningKey(t, "new", "new-secret", test.previous...)
+
+		if _, err := ParseToken(tokens.Token); (err == nil) != test.ok {
+			t.Errorf("%s: expected ok to be %v, got %v", test.name, test.ok, err)
+		}
+
+		// New tokens are signed with the new key either way
+		newTokens, err := IssueTokens(uuid.New().String())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseToken(newTokens.Token); err != nil {
+			t.Errorf("%s: expected new tokens to work, got %v", test.name, err)
+		}
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	useSigningKey(t, "", "secret")
+	characterID := uuid.New().String()
+	tokens, _ := IssueTokens(characterID)
+	a := tokenAuthenticator{}
+
+	tests := []struct {
+		name  string
+		creds *Credentials
+		ok    bool
+	}{
+		{"access token", &Credentials{Token: tokens.Token}, true},
+
+		// Access tokens can be used as often as we like
+		{"access token again", &Credentials{Token: tokens.Token}, true},
+
+		{"expired access token", &Credentials{Token: "expired", RefreshToken: tokens.RefreshToken}, true},
+
+		// Refresh tokens only work once
+		{"refresh token again", &Credentials{RefreshToken: tokens.RefreshToken}, false},
+		{"access token as a refresh token", &Credentials{RefreshToken: tokens.Token}, false},
+	}
+
+	for _, test := range tests {
+		identity, err := a.Authenticate(context.Background(), test.creds)
+
+		if !test.ok {
+			if err != ErrInvalidCredentials {
+				t.Errorf("%s: expected ErrInvalidCredentials, got %v", test.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if identity.CharacterID != characterID {
+			t.Errorf("%s: expected %s, got %s", test.name, characterID, identity.CharacterID)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	useSigningKey(t, "", "secret")
+	characterID := uuid.New().String()
+
+	first, _ := IssueTokens(characterID)
+	second, _ := IssueTokens(characterID)
+	claims, _ := ParseToken(first.Token)
+
+	if revoked, err := Revoke(claims); err != nil || !revoked {
+		t.Fatalf("expected the token to be revoked, got %v (%v)", revoked, err)
+	}
+
+	if revoked, _ := Revoke(claims); revoked {
+		t.Error("revoking twice should return false")
+	}
+
+	if _, err := ParseToken(first.Token); err != ErrInvalidCredentials {
+		t.Errorf("expected the revoked token to fail, got %v", err)
+	}
+
+	// Only that token was revoked
+	if _, err := ParseToken(second.Token); err != nil {
+		t.Errorf("expected the other token to work, got %v", err)
+	}
+
+	if err := RevokeAll(characterID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseToken(second.Token); err != ErrInvalidCredentials {
+		t.Errorf("expected every access token to be revoked, got %v", err)
+	}
+
+	if _, err := ParseRefreshToken(second.RefreshToken); err != ErrInvalidCredentials {
+		t.Errorf("expected every refresh token to be revoked, got %v", err)
+	}
+
+	// Tokens issued afterwards still work, even right away
+	third, _ := IssueTokens(characterID)
+
+	if _, err := ParseToken(third.Token); err != nil {
+		t.Errorf("expected tokens issued afterwards to work, got %v", err)
+	}
+}
@@ -14,6 +14,8 @@ const (
 	TwilioAccountSID Secret = "TWILIO_ACCOUNT_SID"
 	TwilioAuthToken         = "TWILIO_AUTH_TOKEN"
 	YouTubeKey              = "YOUTUBE_API_KEY"
+	JWTSecret               = "JWT_SECRET"
+	SMTPPassword            = "SMTP_PASSWORD"
 )
 
 var config *viper.Viper
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/techx/playground/auth"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/permissions"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireCapability only lets requests through if they have the token of
+// someone with this capability, the same one they use to join, in an
+// Authorization: Bearer header
+func RequireCapability(capability string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get("Authorization")
+
+			if !strings.HasPrefix(header, "Bearer ") {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+			}
+
+			claims, err := auth.ParseToken(strings.TrimPrefix(header, "Bearer "))
+
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+			}
+
+			character, err := db.GetStore().Characters.Get(claims.CharacterID)
+
+			if err != nil || !permissions.Can(character, capability) {
+				return echo.NewHTTPError(http.StatusForbidden, "missing "+capability)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/techx/playground/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LogController struct{}
+
+// GET /logs - search the packet log, filtered by characterId, type, since,
+// until, and limit
+func (l LogController) GetLogs(c echo.Context) error {
+	filter, err := db.ParseLogFilter(c.QueryParams())
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	logs, err := db.QueryLogs(filter)
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			"database error")
+	}
+
+	return c.JSON(http.StatusOK, logs)
+}
@@ -5,9 +5,7 @@ import (
 
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 
-	"github.com/go-redis/redis/v7"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,8 +13,8 @@ type RoomController struct{}
 
 // GET /rooms - get all rooms
 func (r RoomController) GetRooms(c echo.Context) error {
-	// Get all of the room names from Redis
-	roomNames, err := db.GetInstance().SMembers("rooms").Result()
+	// Get all of the room names from the database
+	roomNames, err := db.GetStore().Rooms.List()
 
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError,
@@ -24,19 +22,17 @@ func (r RoomController) GetRooms(c echo.Context) error {
 	}
 
 	// Load each room into this array
-	pip := db.GetInstance().Pipeline()
-	roomCmds := make([]*redis.StringStringMapCmd, len(roomNames))
+	rooms := make([]models.Room, 0, len(roomNames))
 
-	for i, name := range roomNames {
-		roomCmds[i] = pip.HGetAll("room:" + name)
-	}
+	for _, name := range roomNames {
+		room, err := db.GetStore().Rooms.Get(name)
 
-	pip.Exec()
-	rooms := make([]models.Room, len(roomNames))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				"database error")
+		}
 
-	for i, roomCmd := range roomCmds {
-		roomData, _ := roomCmd.Result()
-		utils.Bind(roomData, &rooms[i])
+		rooms = append(rooms, *room)
 	}
 
 	return c.JSON(http.StatusOK, rooms)
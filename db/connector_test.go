@@ -0,0 +1,39 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/techx/playground/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+)
+
+func TestMain(m *testing.M) {
+	// The config and seed data are loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
+	config.Init("test")
+	os.Exit(m.Run())
+}
+
+// Points the database at a fresh in-process Redis for the rest of the test,
+// as a newly started ingest
+func useTestRedis(t *testing.T) *miniredis.Miniredis {
+	server := miniredis.RunT(t)
+	oldInstance, oldIngestID := instance, ingestID
+
+	instance = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ingestID = uuid.New().String()
+
+	t.Cleanup(func() {
+		instance.Close()
+		instance, ingestID = oldInstance, oldIngestID
+	})
+
+	return server
+}
@@ -1,2 +1,2 @@
-// Package db provides functions for reading from and writing to our Redis-based database
+// Package db provides functions for reading from and writing to our database, which lives in Redis (or in memory, for development)
 package db
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/metrics"
+
+	"github.com/go-redis/redis/v7"
+)
+
+const (
+	// Holds "<ingest ID>:<term>" for the current leader, and expires unless
+	// the leader keeps renewing it
+	leaderKey = "leader"
+
+	// Counts up every time an ingest becomes leader, so that each lease has a
+	// higher term than the ones before it
+	leaderTermKey = "leader:term"
+)
+
+// ErrLeaseLost is returned when a leader-only write is attempted after this
+// ingest stopped being the leader
+var ErrLeaseLost = errors.New("leader lease lost")
+
+// Takes the lease if nobody holds it, returning the new term, or 0 if someone
+// else is already the leader. The term only goes up when the lease is taken
+var acquireLeaseScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+
+local term = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], ARGV[1] .. ":" .. term, "PX", ARGV[2])
+return term
+`)
+
+// Renews the lease, but only if we're still the ones holding it
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+
+return 0
+`)
+
+// Gives up the lease, but only if we're still the ones holding it
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+var (
+	// Closed by stopMonitoringLeader to stop MonitorLeader, which closes
+	// leaderStopped once it has given up the lease
+	stopLeader     = make(chan struct{})
+	stopLeaderOnce sync.Once
+	leaderStopped  = make(chan struct{})
+
+	// Set to 1 once MonitorLeader starts
+	monitoringLeader int32
+)
+
+// Lease is this ingest's claim on being the leader
+type Lease struct {
+	// Higher than the term of every lease before this one
+	Term int64
+
+	value string
+
+	mu        sync.Mutex
+	expiresAt time.Time
+
+	// Done once the lease is lost
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Context returns a context that's cancelled as soon as the lease is lost
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Held returns true if the lease is still ours, as far as we know. Writes that
+// must only happen on the leader should use Do instead
+func (l *Lease) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.ctx.Err() == nil && time.Now().Before(l.expiresAt)
+}
+
+// Do runs a transaction only if this lease is still held when it commits.
+// watch lists any other keys that should abort the transaction if they change
+// in the meantime. read runs first, and can look at the current state of the
+// keys before fn queues up the writes
+func (l *Lease) Do(read func(tx *redis.Tx) error, fn func(pip redis.Pipeliner) error, watch ...string) error {
+	if !l.Held() {
+		return ErrLeaseLost
+	}
+
+	return instance.Watch(func(tx *redis.Tx) error {
+		holder, err := tx.Get(leaderKey).Result()
+
+		if err != nil || holder != l.value {
+			return ErrLeaseLost
+		}
+
+		if read != nil {
+			if err := read(tx); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(fn)
+		return err
+	}, append(watch, leaderKey)...)
+}
+
+func (l *Lease) lose() {
+	l.cancel()
+}
+
+// Returns how long leases last before they have to be renewed
+func leaseDuration() time.Duration {
+	return time.Duration(config.GetConfig().GetInt("leader.lease_seconds")) * time.Second
+}
+
+// Tries to become the leader, returning nil if someone else already is
+func acquireLease() *Lease {
+	start := time.Now()
+	term, err := acquireLeaseScript.Run(instance, []string{leaderKey, leaderTermKey}, ingestID, leaseDuration().Milliseconds()).Int64()
+
+	if err != nil || term == 0 {
+		return nil
+	}
+
+	value := ingestID + ":" + strconv.FormatInt(term, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Lease{
+		Term:      term,
+		value:     value,
+		expiresAt: start.Add(leaseDuration()),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Extends the lease, returning false if it was lost
+func (l *Lease) renew() bool {
+	start := time.Now()
+	renewed, err := renewLeaseScript.Run(instance, []string{leaderKey}, l.value, leaseDuration().Milliseconds()).Int()
+
+	if err != nil || renewed == 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	l.expiresAt = start.Add(leaseDuration())
+	l.mu.Unlock()
+
+	return true
+}
+
+// Gives up the lease right away, so that another ingest can take over without
+// waiting for it to expire
+func (l *Lease) release() {
+	l.lose()
+
+	if err := releaseLeaseScript.Run(instance, []string{leaderKey}, l.value).Err(); err != nil {
+		log.Println("ERROR: Unable to release leader lease ->", err)
+	}
+}
+
+// MonitorLeader keeps this ingest's heartbeat alive, and competes to become the
+// leader. While we hold the lease, every registered leader task runs. Returns
+// once Deregister is called. Without Redis, this ingest is the only one, so it
+// starts the leader tasks that can run on their own and returns right away
+func MonitorLeader() {
+	if !UsesRedis() {
+		metrics.Leader.Set(1)
+		startLocalLeaderTasks()
+		return
+	}
+
+	atomic.StoreInt32(&monitoringLeader, 1)
+	defer close(leaderStopped)
+
+	var lease *Lease
+
+	ticker := time.NewTicker(leaseDuration() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopLeader:
+			if lease != nil {
+				log.Println("Giving up leader lease for term", lease.Term)
+				lease.release()
+				metrics.Leader.Set(0)
+			}
+
+			return
+		case <-ticker.C:
+		}
+
+		heartbeat()
+
+		if lease != nil {
+			if lease.Held() && lease.renew() {
+				continue
+			}
+
+			log.Println("Lost leader lease for term", lease.Term)
+			lease.lose()
+			lease = nil
+			metrics.Leader.Set(0)
+		}
+
+		if lease = acquireLease(); lease != nil {
+			log.Println("Became leader for term", lease.Term)
+			metrics.Leader.Set(1)
+			startLeaderTasks(lease)
+		}
+	}
+}
+
+// Stops MonitorLeader and waits for it to give up the lease, if it's running.
+// Safe to call more than once
+func stopMonitoringLeader() {
+	if atomic.LoadInt32(&monitoringLeader) == 0 {
+		return
+	}
+
+	stopLeaderOnce.Do(func() {
+		close(stopLeader)
+	})
+
+	<-leaderStopped
+}
+
+// LeaderTask is work that only one ingest should be doing at a time
+type LeaderTask struct {
+	Name string
+
+	// How often the task runs
+	Interval time.Duration
+
+	// Runs the task once. Writes that must not happen after the lease is lost
+	// should go through lease.Do
+	Run func(lease *Lease)
+
+	// Runs the task once on the memory store, where there's no lease to hold.
+	// Tasks that leave this out only run with Redis
+	RunLocal func()
+}
+
+var (
+	leaderTasksMu sync.Mutex
+	leaderTasks   []LeaderTask
+)
+
+// RegisterLeaderTask adds a task that runs on whichever ingest is the leader
+func RegisterLeaderTask(task LeaderTask) {
+	leaderTasksMu.Lock()
+	defer leaderTasksMu.Unlock()
+
+	leaderTasks = append(leaderTasks, task)
+}
+
+// Runs every leader task until the lease is lost
+func startLeaderTasks(lease *Lease) {
+	leaderTasksMu.Lock()
+	defer leaderTasksMu.Unlock()
+
+	for _, task := range leaderTasks {
+		go runLeaderTask(task, lease)
+	}
+}
+
+// Runs every leader task that can run without Redis, for as long as we're up
+func startLocalLeaderTasks() {
+	leaderTasksMu.Lock()
+	defer leaderTasksMu.Unlock()
+
+	for _, task := range leaderTasks {
+		if task.RunLocal == nil {
+			continue
+		}
+
+		go func(task LeaderTask) {
+			for range time.NewTicker(task.Interval).C {
+				task.RunLocal()
+			}
+		}(task)
+	}
+}
+
+func runLeaderTask(task LeaderTask, lease *Lease) {
+	ticker := time.NewTicker(task.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lease.Context().Done():
+			log.Println("Stopping leader task", task.Name)
+			return
+		case <-ticker.C:
+			if lease.Held() {
+				task.Run(lease)
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func init() {
+	RegisterLeaderTask(LeaderTask{
+		Name:     "dead_ingest_cleanup",
+		Interval: time.Second,
+		Run:      cleanUpDeadIngests,
+	})
+
+	RegisterLeaderTask(LeaderTask{
+		Name:     "jukebox",
+		Interval: time.Second,
+		Run:      advanceJukebox,
+		RunLocal: advanceJukeboxLocally,
+	})
+
+	RegisterLeaderTask(LeaderTask{
+		Name:     "tim",
+		Interval: 15 * time.Second,
+		Run: func(lease *Lease) {
+			moveTIM(leaderTIM{lease})
+		},
+		RunLocal: func() {
+			moveTIM(localTIM{})
+		},
+	})
+}
+
+// Takes care of ingest servers that stopped sending heartbeats
+func cleanUpDeadIngests(lease *Lease) {
+	ingestIDs, _ := instance.LRange("ingests", 0, -1).Result()
+
+	pip := instance.Pipeline()
+	aliveCmds := make([]*redis.IntCmd, len(ingestIDs))
+
+	for i, id := range ingestIDs {
+		aliveCmds[i] = pip.Exists("ingest:" + id + ":alive")
+	}
+
+	pip.Exec()
+
+	for i, id := range ingestIDs {
+		if alive, _ := aliveCmds[i].Result(); alive == 1 || !lease.Held() {
+			continue
+		}
+
+		fmt.Println("removing", id)
+
+		// Remove characters connected to this ingest from their rooms
+		characters, _ := instance.SMembers("ingest:" + id + ":characters").Result()
+
+		pip := instance.Pipeline()
+		roomCmds := make([]*redis.StringCmd, len(characters))
+
+		for j, characterID := range characters {
+			roomCmds[j] = pip.HGet("character:"+characterID, "room")
+		}
+
+		pip.Exec()
+
+		err := lease.Do(nil, func(pip redis.Pipeliner) error {
+			for j, roomCmd := range roomCmds {
+				room, _ := roomCmd.Result()
+				pip.SRem("room:"+room+":characters", characters[j])
+			}
+
+			// Ingest has been taken care of, remove from set
+			pip.Del("ingest:" + id + ":characters")
+			pip.Del("ingest:" + id + ":positions")
+			pip.LRem("ingests", 0, id)
+			return nil
+		})
+
+		if err != nil {
+			log.Println("ERROR: Unable to clean up ingest", id, "->", err)
+		}
+	}
+}
+
+// Starts the next song in the queue once the current one ends
+func advanceJukebox(lease *Lease) {
+	// Get song queue status
+	queueRes, _ := instance.Get("queuestatus").Result()
+	queueStatus, _ := strconv.ParseInt(queueRes, 10, 64)
+
+	songEnd := time.Unix(queueStatus, 0)
+
+	// If current song ended, start next song (if there is one)
+	if !songEnd.Before(time.Now()) {
+		return
+	}
+
+	var song models.Song
+
+	// Watching the queue means that two leaders can never pop the same song,
+	// or pop one right after the other
+	err := lease.Do(func(tx *redis.Tx) error {
+		songID, err := tx.LIndex("songs", 0).Result()
+
+		if err != nil {
+			return err
+		}
+
+		songRes, _ := tx.HGetAll("song:" + songID).Result()
+		utils.Bind(songRes, &song)
+		song.ID = songID
+		return nil
+	}, func(pip redis.Pipeliner) error {
+		// Pop the next song off the queue
+		pip.LPop("songs")
+		pip.Set("currentsong", song.ID, 0)
+
+		// Update queue status to reflect new song
+		endTime := (time.Now().Add(time.Second * time.Duration(song.Duration))).Unix()
+		pip.Set("queuestatus", endTime, 0)
+
+		// Send song packet to ingests
+		data := newPlaySongPacket(&song)
+		publish(pip, "", data, "all")
+		return nil
+	}, "songs", "queuestatus")
+
+	if err != nil && err != redis.Nil {
+		log.Println("ERROR: Unable to start next song ->", err)
+	}
+}
+
+// Returns the packet that tells everyone to start playing a song
+func newPlaySongPacket(song *models.Song) []byte {
+	playSongPacket := map[string]interface{}{
+		"type":  "play_song",
+		"song":  song,
+		"start": 0,
+		"end":   int(song.Duration),
+	}
+
+	data, _ := json.Marshal(playSongPacket)
+	return data
+}
+
+// Starts the next song in the queue once the current one ends, on the memory
+// store
+func advanceJukeboxLocally() {
+	_, songEnd, err := store.Songs.Current()
+
+	if err != nil || !songEnd.Before(time.Now()) {
+		return
+	}
+
+	song, err := store.Songs.Next()
+
+	if err == ErrNotFound {
+		return
+	} else if err != nil {
+		log.Println("ERROR: Unable to start next song ->", err)
+		return
+	}
+
+	store.Songs.SetCurrent(song.ID, time.Now().Add(time.Second*time.Duration(song.Duration)))
+	publishLocally(newPlaySongPacket(song), "all")
+}
+
+// Saves what TIM does, and tells the rooms he's in about it
+type timWriter interface {
+	// Moves TIM to a spot in a room, which can be the one he's already in
+	move(tim *models.Character, room string, x, y float64, data []byte)
+
+	// Sends a packet to TIM's room without changing anything
+	say(tim *models.Character, data []byte)
+}
+
+// Writes for TIM through Redis, as long as we're still the leader
+type leaderTIM struct {
+	lease *Lease
+}
+
+func (w leaderTIM) move(tim *models.Character, room string, x, y float64, data []byte) {
+	w.lease.Do(nil, func(pip redis.Pipeliner) error {
+		if room != tim.Room {
+			pip.SRem("room:"+tim.Room+":characters", "tim")
+			pip.SAdd("room:"+room+":characters", "tim")
+			pip.HSet("character:tim", "room", room)
+		}
+
+		pip.HSet("character:tim", "x", x)
+		pip.HSet("character:tim", "y", y)
+		publish(pip, "", data, timRooms(tim, room)...)
+		return nil
+	})
+}
+
+func (w leaderTIM) say(tim *models.Character, data []byte) {
+	w.lease.Do(nil, func(pip redis.Pipeliner) error {
+		publish(pip, "", data, "room:"+tim.Room)
+		return nil
+	})
+}
+
+// Writes for TIM on the memory store, where this ingest is the only one
+type localTIM struct{}
+
+func (w localTIM) move(tim *models.Character, room string, x, y float64, data []byte) {
+	fields := map[string]interface{}{"x": x, "y": y}
+
+	if room != tim.Room {
+		store.Rooms.RemoveCharacter(tim.Room, "tim")
+		store.Rooms.AddCharacter(room, "tim")
+		fields["room"] = room
+	}
+
+	store.Characters.Update("tim", fields)
+	publishLocally(data, timRooms(tim, room)...)
+}
+
+func (w localTIM) say(tim *models.Character, data []byte) {
+	publishLocally(data, "room:"+tim.Room)
+}
+
+// Returns the channels for the rooms TIM is moving between
+func timRooms(tim *models.Character, room string) []string {
+	if room == tim.Room {
+		return []string{"room:" + room}
+	}
+
+	return []string{"room:" + tim.Room, "room:" + room}
+}
+
+// Has TIM the beaver walk, talk, or wander into another room
+func moveTIM(w timWriter) {
+	tim, err := store.Characters.Get("tim")
+
+	if err != nil {
+		return
+	}
+
+	tim.ID = "tim"
+	whatToDo := rand.Float64()
+
+	walkProb := config.GetConfig().GetFloat64("tim.action_probs.walk")
+	talkProb := config.GetConfig().GetFloat64("tim.action_probs.talk")
+	teleportProb := config.GetConfig().GetFloat64("tim.action_probs.teleport")
+
+	if whatToDo < teleportProb {
+		hallways, _ := store.Rooms.Hallways(tim.Room)
+
+		// Make sure tim can only walk into rooms without walls
+		hallwayOptions := make([]*models.Hallway, 0)
+
+		for _, hallway := range hallways {
+			for _, allowedRoomID := range config.GetConfig().GetStringSlice("tim.allowed_rooms") {
+				if hallway.To == allowedRoomID {
+					hallwayOptions = append(hallwayOptions, hallway)
+					break
+				}
+			}
+		}
+
+		if len(hallwayOptions) == 0 {
+			return
+		}
+
+		// Teleport into the allowed room
+		hallway := hallwayOptions[rand.Intn(len(hallwayOptions))]
+
+		movePacket := map[string]interface{}{
+			"type": "move",
+			"id":   "tim",
+			"room": tim.Room,
+			"x":    hallway.X,
+			"y":    hallway.Y,
+		}
+		data, _ := json.Marshal(movePacket)
+
+		w.move(tim, tim.Room, hallway.X, hallway.Y, data)
+
+		time.AfterFunc(4*time.Second, func() {
+			timData, _ := tim.MarshalBinary()
+			var newTimData map[string]interface{}
+			json.Unmarshal(timData, &newTimData)
+
+			teleportPacket := map[string]interface{}{
+				"type":      "teleport",
+				"character": newTimData,
+				"from":      tim.Room,
+				"to":        hallway.To,
+				"x":         hallway.ToX,
+				"y":         hallway.ToY,
+			}
+
+			data, _ := json.Marshal(teleportPacket)
+			w.move(tim, hallway.To, hallway.ToX, hallway.ToY, data)
+		})
+	} else if whatToDo < teleportProb+walkProb {
+		x := rand.Float64()
+		y := rand.Float64()
+
+		movePacket := map[string]interface{}{
+			"type": "move",
+			"id":   "tim",
+			"room": tim.Room,
+			"x":    x,
+			"y":    y,
+		}
+		data, _ := json.Marshal(movePacket)
+
+		w.move(tim, tim.Room, x, y, data)
+	} else if whatToDo < teleportProb+walkProb+talkProb {
+		timLines := config.GetConfig().GetStringSlice("tim.chat_lines")
+		randomLine := timLines[rand.Intn(len(timLines))]
+
+		chatPacket := map[string]interface{}{
+			"type": "chat",
+			"id":   "tim",
+			"mssg": randomLine,
+			"room": tim.Room,
+		}
+
+		data, _ := json.Marshal(chatPacket)
+		w.say(tim, data)
+	}
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+)
+
+type localPacket struct {
+	channel string
+	Type    string `json:"type"`
+}
+
+// Collects what the leader tasks send without Redis, for the rest of the test
+func captureLocalPackets(t *testing.T) func() []localPacket {
+	var packets []localPacket
+
+	ListenForUpdates(func(channel string, msg []byte) {
+		packet := localPacket{channel: channel}
+		json.Unmarshal(msg, &packet)
+		packets = append(packets, packet)
+	})
+
+	t.Cleanup(func() {
+		streamsMu.Lock()
+		localCallback = nil
+		streamsMu.Unlock()
+	})
+
+	return func() []localPacket {
+		return packets
+	}
+}
+
+func TestAdvanceJukeboxLocally(t *testing.T) {
+	tests := []struct {
+		name    string
+		queued  bool
+		endsIn  time.Duration
+		started bool
+	}{
+		{"song ended", true, -time.Second, true},
+		{"song still playing", true, time.Minute, false},
+		{"nothing queued", false, -time.Second, false},
+	}
+
+	for _, test := range tests {
+		useStore(t, NewMemoryStore())
+		packets := captureLocalPackets(t)
+
+		store.Songs.SetCurrent("old", time.Now().Add(test.endsIn))
+
+		if test.queued {
+			store.Songs.Add(&models.Song{ID: "next", Duration: 60})
+		}
+
+		advanceJukeboxLocally()
+
+		current, endsAt, _ := store.Songs.Current()
+
+		if started := current.ID == "next"; started != test.started {
+			t.Errorf("%s: expected the next song to start: %v, got %s", test.name, test.started, current.ID)
+		}
+
+		if test.started && time.Until(endsAt) < 59*time.Second {
+			t.Errorf("%s: expected the song to end in a minute, got %v", test.name, endsAt)
+		}
+
+		if queue, _ := store.Songs.Queue(); test.started && len(queue) != 0 {
+			t.Errorf("%s: expected the song to leave the queue, got %d left", test.name, len(queue))
+		}
+
+		if sent := packets(); test.started && (len(sent) != 1 || sent[0] != (localPacket{"all", "play_song"})) {
+			t.Errorf("%s: expected a play_song packet to everyone, got %+v", test.name, sent)
+		} else if !test.started && len(sent) != 0 {
+			t.Errorf("%s: expected no packets, got %+v", test.name, sent)
+		}
+	}
+}
+
+func TestMoveTIMLocally(t *testing.T) {
+	tests := []struct {
+		action string
+		sent   string
+		moved  bool
+	}{
+		{"walk", "move", true},
+		{"talk", "chat", false},
+	}
+
+	for _, test := range tests {
+		useStore(t, NewMemoryStore())
+		packets := captureLocalPackets(t)
+
+		for _, action := range []string{"walk", "talk", "teleport"} {
+			key := "tim.action_probs." + action
+			old := config.GetConfig().GetFloat64(key)
+			defer config.GetConfig().Set(key, old)
+
+			if action == test.action {
+				config.GetConfig().Set(key, 1)
+			} else {
+				config.GetConfig().Set(key, 0)
+			}
+		}
+
+		store.Characters.Create(&models.Character{ID: "tim", Room: "home", X: 2, Y: 2})
+
+		moveTIM(localTIM{})
+
+		tim, _ := store.Characters.Get("tim")
+
+		if moved := tim.X != 2 || tim.Y != 2; moved != test.moved {
+			t.Errorf("%s: expected TIM to move: %v, got (%v, %v)", test.action, test.moved, tim.X, tim.Y)
+		}
+
+		if sent := packets(); len(sent) != 1 || sent[0] != (localPacket{"room:home", test.sent}) {
+			t.Errorf("%s: expected a %s packet to TIM's room, got %+v", test.action, test.sent, sent)
+		}
+	}
+}
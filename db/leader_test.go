@@ -0,0 +1,217 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Runs fn as if it were on another ingest
+func asIngest(id string, fn func()) {
+	ourID := ingestID
+	ingestID = id
+	defer func() { ingestID = ourID }()
+
+	fn()
+}
+
+func TestAcquireLease(t *testing.T) {
+	server := useTestRedis(t)
+	otherIngest := uuid.New().String()
+
+	lease := acquireLease()
+
+	if lease == nil {
+		t.Fatal("expected to become the leader")
+	}
+
+	if !lease.Held() {
+		t.Error("new lease should be held")
+	}
+
+	if holder, _ := instance.Get(leaderKey).Result(); holder != lease.value {
+		t.Errorf("expected %s to hold the lease, got %s", lease.value, holder)
+	}
+
+	if ttl := server.TTL(leaderKey); ttl <= 0 || ttl > leaseDuration() {
+		t.Errorf("expected the lease to expire within %v, got %v", leaseDuration(), ttl)
+	}
+
+	// Only one ingest can be the leader at a time
+	asIngest(otherIngest, func() {
+		if other := acquireLease(); other != nil {
+			t.Error("another ingest shouldn't get the lease while it's held")
+		}
+	})
+
+	// Once the leader stops renewing, someone else can take over
+	server.FastForward(leaseDuration())
+
+	asIngest(otherIngest, func() {
+		other := acquireLease()
+
+		if other == nil {
+			t.Fatal("expected another ingest to take over an expired lease")
+		}
+
+		if other.Term <= lease.Term {
+			t.Errorf("expected a term higher than %d, got %d", lease.Term, other.Term)
+		}
+	})
+}
+
+func TestRenewLease(t *testing.T) {
+	server := useTestRedis(t)
+	lease := acquireLease()
+
+	if lease == nil {
+		t.Fatal("expected to become the leader")
+	}
+
+	server.FastForward(leaseDuration() / 2)
+
+	if !lease.renew() {
+		t.Fatal("expected to renew a lease we still hold")
+	}
+
+	if ttl := server.TTL(leaderKey); ttl != leaseDuration() {
+		t.Errorf("expected renewing to reset the TTL to %v, got %v", leaseDuration(), ttl)
+	}
+
+	// Renewing after someone else took over fails, rather than stealing the
+	// lease back
+	server.FastForward(leaseDuration())
+
+	asIngest(uuid.New().String(), func() {
+		if acquireLease() == nil {
+			t.Fatal("expected another ingest to take over")
+		}
+	})
+
+	holder, _ := instance.Get(leaderKey).Result()
+
+	if lease.renew() {
+		t.Error("shouldn't be able to renew a lease someone else holds")
+	}
+
+	if after, _ := instance.Get(leaderKey).Result(); after != holder {
+		t.Errorf("renewing changed the holder from %s to %s", holder, after)
+	}
+}
+
+func TestLeaseFencing(t *testing.T) {
+	server := useTestRedis(t)
+	lease := acquireLease()
+
+	if lease == nil {
+		t.Fatal("expected to become the leader")
+	}
+
+	write := func(value string) func(pip redis.Pipeliner) error {
+		return func(pip redis.Pipeliner) error {
+			pip.Set("fenced", value, 0)
+			return nil
+		}
+	}
+
+	if err := lease.Do(nil, write("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to watched keys abort the write
+	err := lease.Do(func(tx *redis.Tx) error {
+		return instance.Set("watched", "changed", 0).Err()
+	}, write("second"), "watched")
+
+	if err != redis.TxFailedErr {
+		t.Errorf("expected the transaction to fail, got %v", err)
+	}
+
+	// Once another ingest takes over, writes from the old leader are fenced
+	// off even if the old leader hasn't noticed yet
+	server.FastForward(leaseDuration())
+
+	var newLease *Lease
+
+	asIngest(uuid.New().String(), func() {
+		newLease = acquireLease()
+	})
+
+	if newLease == nil {
+		t.Fatal("expected another ingest to take over")
+	}
+
+	lease.mu.Lock()
+	lease.expiresAt = time.Now().Add(time.Minute)
+	lease.mu.Unlock()
+
+	if err := lease.Do(nil, write("stale")); err != ErrLeaseLost {
+		t.Errorf("expected ErrLeaseLost, got %v", err)
+	}
+
+	if err := newLease.Do(nil, write("third")); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := instance.Get("fenced").Result(); value != "third" {
+		t.Errorf("expected only the current leader's writes, got %s", value)
+	}
+
+	// Leases we know we've lost don't even try
+	newLease.lose()
+
+	if newLease.Held() {
+		t.Error("lost lease shouldn't be held")
+	}
+
+	if err := newLease.Do(nil, write("lost")); err != ErrLeaseLost {
+		t.Errorf("expected ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestRunLeaderTask(t *testing.T) {
+	useTestRedis(t)
+	lease := acquireLease()
+
+	if lease == nil {
+		t.Fatal("expected to become the leader")
+	}
+
+	runs := make(chan struct{}, 100)
+	stopped := make(chan struct{})
+
+	task := LeaderTask{
+		Name:     "test",
+		Interval: time.Millisecond,
+		Run: func(lease *Lease) {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+		},
+	}
+
+	go func() {
+		runLeaderTask(task, lease)
+		close(stopped)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("expected the task to keep running while the lease is held")
+		}
+	}
+
+	lease.lose()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the task to stop once the lease is lost")
+	}
+}
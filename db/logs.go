@@ -0,0 +1,402 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Packet logs stay in Redis for logs.hot_minutes, so that recent ones are
+// quick to look up. After that, the leader packs them into gzipped NDJSON
+// archives, one per hour. Archives stay in Redis too, so that every ingest can
+// search them, until they expire after logs.retention_days. Without Redis,
+// logs stay in memory until they're past logs.retention_days
+
+// Archives are named after the hour their logs are from
+const logArchiveLayout = "2006010215"
+
+// Sorted set of the hours that have an archive, scored by when they start
+const logArchivesKey = "logs:archives"
+
+// How many logs to move out of Redis at once
+const logRotationBatchSize = 1000
+
+func init() {
+	RegisterLeaderTask(LeaderTask{
+		Name:     "log_rotation",
+		Interval: time.Minute,
+		Run:      rotateLogs,
+		RunLocal: expireLogsLocally,
+	})
+}
+
+// LogFilter picks out logs for an investigation. Empty fields match everything
+type LogFilter struct {
+	CharacterID string
+	Type        string
+	Since       time.Time
+	Until       time.Time
+
+	// Stop after this many logs
+	Limit int
+}
+
+// ParseLogFilter reads a filter from query parameters: characterId, type,
+// since and until (as RFC 3339 times or Unix timestamps), and limit
+func ParseLogFilter(query url.Values) (LogFilter, error) {
+	filter := LogFilter{
+		CharacterID: query.Get("characterId"),
+		Type:        query.Get("type"),
+	}
+
+	var err error
+
+	if filter.Since, err = parseLogTime(query.Get("since")); err != nil {
+		return filter, err
+	}
+
+	if filter.Until, err = parseLogTime(query.Get("until")); err != nil {
+		return filter, err
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return filter, errors.New("limit must be a number")
+		}
+	}
+
+	return filter, nil
+}
+
+func parseLogTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return t, errors.New("times must be RFC 3339 or Unix timestamps")
+	}
+
+	return t, nil
+}
+
+// Matches returns true if a log should be part of the results
+func (f LogFilter) Matches(log *models.Log) bool {
+	if f.CharacterID != "" && log.CharacterID != f.CharacterID {
+		return false
+	}
+
+	if f.Type != "" && log.Type != f.Type {
+		return false
+	}
+
+	if !f.Since.IsZero() && log.Timestamp < f.Since.Unix() {
+		return false
+	}
+
+	if !f.Until.IsZero() && log.Timestamp > f.Until.Unix() {
+		return false
+	}
+
+	return true
+}
+
+// Stands in for fields that were left out of a log
+const redacted = "[redacted]"
+
+// RedactFields replaces the top-level fields of a JSON packet that shouldn't be
+// logged, like login tokens. Returns the packet unchanged if there's nothing to
+// redact
+func RedactFields(msg []byte, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return msg, nil
+	}
+
+	var data map[string]interface{}
+
+	if err := json.Unmarshal(msg, &data); err != nil {
+		return nil, err
+	}
+
+	changed := false
+
+	for _, field := range fields {
+		if value, ok := data[field]; ok && value != nil && value != "" && value != redacted {
+			data[field] = redacted
+			changed = true
+		}
+	}
+
+	if !changed {
+		return msg, nil
+	}
+
+	return json.Marshal(data)
+}
+
+// QueryLogs finds logs matching the filter, both in the archive and in the
+// store, oldest first
+func QueryLogs(filter LogFilter) ([]*models.Log, error) {
+	var logs []*models.Log
+
+	hours, err := logArchiveHours(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hour := range hours {
+		chunks, err := instance.LRange(logArchiveKey(hour), 0, -1).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, chunk := range chunks {
+			if err := readLogArchive([]byte(chunk), func(entry *models.Log) bool {
+				if filter.Matches(entry) {
+					logs = append(logs, entry)
+				}
+
+				return filter.Limit == 0 || len(logs) < filter.Limit
+			}); err != nil {
+				return nil, err
+			}
+
+			if filter.Limit > 0 && len(logs) >= filter.Limit {
+				return logs, nil
+			}
+		}
+	}
+
+	recent, err := store.Logs.Query(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logs = append(logs, recent...)
+
+	if filter.Limit > 0 && len(logs) > filter.Limit {
+		logs = logs[:filter.Limit]
+	}
+
+	return logs, nil
+}
+
+func logArchiveKey(hour string) string {
+	return "logs:archive:" + hour
+}
+
+// Returns the hours with archives that could have matches for this filter,
+// oldest first. Only Redis keeps archives
+func logArchiveHours(filter LogFilter) ([]string, error) {
+	if !UsesRedis() {
+		return nil, nil
+	}
+
+	opt := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+
+	if !filter.Since.IsZero() {
+		opt.Min = strconv.FormatInt(filter.Since.Add(-time.Hour).Unix(), 10)
+	}
+
+	if !filter.Until.IsZero() {
+		opt.Max = strconv.FormatInt(filter.Until.Unix(), 10)
+	}
+
+	return instance.ZRangeByScore(logArchivesKey, opt).Result()
+}
+
+// Calls fn with each log in an archive chunk, until it returns false
+func readLogArchive(chunk []byte, fn func(entry *models.Log) bool) error {
+	reader, err := gzip.NewReader(bytes.NewReader(chunk))
+
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		entry := new(models.Log)
+
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			continue
+		}
+
+		if !fn(entry) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Moves logs that are past logs.hot_minutes out of the store and into the
+// archive, then forgets about archives past logs.retention_days
+func rotateLogs(lease *Lease) {
+	if !UsesRedis() {
+		return
+	}
+
+	cutoff := time.Now().Add(-time.Duration(config.GetConfig().GetInt("logs.hot_minutes")) * time.Minute).Unix()
+
+	for lease.Held() {
+		moved, err := archiveLogs(lease, cutoff)
+
+		if err != nil {
+			log.Println("ERROR: Unable to rotate logs ->", err)
+			return
+		}
+
+		if moved < logRotationBatchSize {
+			break
+		}
+	}
+
+	// The archives themselves expire on their own
+	if retention := logRetention(); retention > 0 {
+		oldest := time.Now().Add(-retention - time.Hour).Unix()
+
+		if err := instance.ZRemRangeByScore(logArchivesKey, "-inf", "("+strconv.FormatInt(oldest, 10)).Err(); err != nil {
+			log.Println("ERROR: Unable to delete expired log archives ->", err)
+		}
+	}
+}
+
+// Deletes logs past logs.retention_days from the memory store, which has no
+// archive to move them to
+func expireLogsLocally() {
+	if retention := logRetention(); retention > 0 {
+		if err := store.Logs.DeleteBefore(time.Now().Add(-retention)); err != nil {
+			log.Println("ERROR: Unable to delete expired logs ->", err)
+		}
+	}
+}
+
+func logRetention() time.Duration {
+	return time.Duration(config.GetConfig().GetInt("logs.retention_days")) * 24 * time.Hour
+}
+
+// Moves one batch of logs older than cutoff into the archive, and returns how
+// many were moved
+func archiveLogs(lease *Lease, cutoff int64) (int, error) {
+	logIDs, err := instance.LRange("logs", 0, logRotationBatchSize-1).Result()
+
+	if err != nil || len(logIDs) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, len(logIDs))
+
+	for i, logID := range logIDs {
+		keys[i] = "log:" + logID
+	}
+
+	entries := make([]*models.Log, len(logIDs))
+
+	err = getHashes(instance, keys, func(i int, res map[string]string) {
+		entries[i] = new(models.Log)
+		utils.Bind(res, entries[i])
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Logs are pushed in order, so stop at the first one that's still recent
+	moved := 0
+	var hours []time.Time
+	byHour := map[time.Time][]*models.Log{}
+
+	for _, entry := range entries {
+		if entry != nil {
+			if entry.Timestamp >= cutoff {
+				break
+			}
+
+			hour := time.Unix(entry.Timestamp, 0).UTC().Truncate(time.Hour)
+
+			if _, ok := byHour[hour]; !ok {
+				hours = append(hours, hour)
+			}
+
+			byHour[hour] = append(byHour[hour], entry)
+		}
+
+		moved++
+	}
+
+	if moved == 0 {
+		return 0, nil
+	}
+
+	chunks := make([][]byte, len(hours))
+
+	for i, hour := range hours {
+		if chunks[i], err = encodeLogArchive(byHour[hour]); err != nil {
+			return 0, err
+		}
+	}
+
+	// Archiving and trimming happen together, so logs are never in both places
+	// or in neither
+	retention := logRetention()
+
+	err = lease.Do(nil, func(pip redis.Pipeliner) error {
+		for i, hour := range hours {
+			key := logArchiveKey(hour.Format(logArchiveLayout))
+			pip.RPush(key, chunks[i])
+			pip.ZAdd(logArchivesKey, &redis.Z{Score: float64(hour.Unix()), Member: hour.Format(logArchiveLayout)})
+
+			if retention > 0 {
+				pip.ExpireAt(key, hour.Add(time.Hour+retention))
+			}
+		}
+
+		pip.LTrim("logs", int64(moved), -1)
+		pip.Del(keys[:moved]...)
+		return nil
+	})
+
+	return moved, err
+}
+
+// Packs logs into a chunk of an archive. Each chunk is a gzip stream of NDJSON
+func encodeLogArchive(entries []*models.Log) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
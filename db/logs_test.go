@@ -0,0 +1,246 @@
+package db
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/db/models"
+)
+
+func TestParseLogFilter(t *testing.T) {
+	since := time.Date(2020, 9, 18, 21, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query  string
+		ok     bool
+		filter LogFilter
+	}{
+		{"", true, LogFilter{}},
+		{"characterId=abc&type=chat&limit=10", true, LogFilter{CharacterID: "abc", Type: "chat", Limit: 10}},
+		{"since=2020-09-18T21:00:00Z", true, LogFilter{Since: since}},
+		{"since=1600462800&until=1600466400", true, LogFilter{Since: since, Until: since.Add(time.Hour)}},
+		{"since=yesterday", false, LogFilter{}},
+		{"until=2020-09-18", false, LogFilter{}},
+		{"limit=ten", false, LogFilter{}},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		filter, err := ParseLogFilter(query)
+
+		if (err == nil) != test.ok {
+			t.Errorf("%q: expected ok to be %v, got %v", test.query, test.ok, err)
+			continue
+		}
+
+		if !test.ok {
+			continue
+		}
+
+		if filter.CharacterID != test.filter.CharacterID || filter.Type != test.filter.Type ||
+			!filter.Since.Equal(test.filter.Since) || !filter.Until.Equal(test.filter.Until) ||
+			filter.Limit != test.filter.Limit {
+			t.Errorf("%q: expected %+v, got %+v", test.query, test.filter, filter)
+		}
+	}
+}
+
+func TestLogFilterMatches(t *testing.T) {
+	at := time.Date(2020, 9, 18, 21, 0, 0, 0, time.UTC)
+	entry := &models.Log{CharacterID: "abc", Type: "chat", Timestamp: at.Unix()}
+
+	tests := []struct {
+		name    string
+		filter  LogFilter
+		matches bool
+	}{
+		{"empty", LogFilter{}, true},
+		{"character", LogFilter{CharacterID: "abc"}, true},
+		{"other character", LogFilter{CharacterID: "def"}, false},
+		{"type", LogFilter{Type: "chat"}, true},
+		{"other type", LogFilter{Type: "move"}, false},
+		{"since", LogFilter{Since: at}, true},
+		{"too early", LogFilter{Since: at.Add(time.Second)}, false},
+		{"until", LogFilter{Until: at}, true},
+		{"too late", LogFilter{Until: at.Add(-time.Second)}, false},
+		{"everything", LogFilter{CharacterID: "abc", Type: "chat", Since: at.Add(-time.Hour), Until: at.Add(time.Hour)}, true},
+	}
+
+	for _, test := range tests {
+		if matches := test.filter.Matches(entry); matches != test.matches {
+			t.Errorf("%s: expected %v, got %v", test.name, test.matches, matches)
+		}
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		fields   []string
+		expected string
+	}{
+		{"nothing to redact", `{"type":"chat","mssg":"hi"}`, nil, `{"type":"chat","mssg":"hi"}`},
+		{"missing fields", `{"type":"chat","mssg":"hi"}`, []string{"token"}, `{"type":"chat","mssg":"hi"}`},
+		{"secret", `{"type":"join","token":"secret"}`, []string{"token"}, `{"token":"[redacted]","type":"join"}`},
+		{"several secrets", `{"type":"auth","email":"a@example.com","code":123456}`, []string{"email", "code", "token"}, `{"code":"[redacted]","email":"[redacted]","type":"auth"}`},
+
+		// Empty fields don't hide anything, so they're left as they are
+		{"empty", `{"type":"join","token":""}`, []string{"token"}, `{"type":"join","token":""}`},
+		{"null", `{"type":"join","token":null}`, []string{"token"}, `{"type":"join","token":null}`},
+	}
+
+	for _, test := range tests {
+		redactedMsg, err := RedactFields([]byte(test.msg), test.fields)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if string(redactedMsg) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, redactedMsg)
+		}
+	}
+
+	if _, err := RedactFields([]byte("not json"), []string{"token"}); err == nil {
+		t.Error("expected an error for a packet that isn't JSON")
+	}
+}
+
+func TestQueryLogs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		useStore(t, s)
+
+		start := time.Now().Add(-time.Hour).Unix()
+
+		entries := []*models.Log{
+			{CharacterID: "a", Type: "chat", Message: "1", Timestamp: start},
+			{CharacterID: "b", Type: "move", Message: "2", Timestamp: start + 60},
+			{CharacterID: "a", Type: "move", Message: "3", Timestamp: start + 120},
+			{CharacterID: "a", Type: "chat", Message: "4", Timestamp: start + 180},
+		}
+
+		for _, entry := range entries {
+			if err := store.Logs.Add(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name     string
+			filter   LogFilter
+			messages []string
+		}{
+			{"everything", LogFilter{}, []string{"1", "2", "3", "4"}},
+			{"character", LogFilter{CharacterID: "a"}, []string{"1", "3", "4"}},
+			{"type", LogFilter{Type: "move"}, []string{"2", "3"}},
+			{"time", LogFilter{Since: time.Unix(start+60, 0), Until: time.Unix(start+120, 0)}, []string{"2", "3"}},
+			{"limit", LogFilter{CharacterID: "a", Limit: 2}, []string{"1", "3"}},
+		}
+
+		for _, test := range tests {
+			logs, err := QueryLogs(test.filter)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages := make([]string, len(logs))
+
+			for i, entry := range logs {
+				messages[i] = entry.Message
+			}
+
+			if !equalStrings(messages, test.messages) {
+				t.Errorf("%s: expected %v, got %v", test.name, test.messages, messages)
+			}
+		}
+	})
+}
+
+func TestRotateLogs(t *testing.T) {
+	useTestRedis(t)
+	useStore(t, NewRedisStore(instance))
+
+	now := time.Now()
+
+	entries := []*models.Log{
+		// Past logs.retention_days, so its archive expires right away
+		{CharacterID: "a", Type: "chat", Message: "expired", Timestamp: now.Add(-40 * 24 * time.Hour).Unix()},
+
+		// Past logs.hot_minutes, so they're archived
+		{CharacterID: "a", Type: "chat", Message: "oldest", Timestamp: now.Add(-3 * time.Hour).Unix()},
+		{CharacterID: "b", Type: "chat", Message: "old", Timestamp: now.Add(-2 * time.Hour).Unix()},
+
+		// Still recent, so they stay in the store
+		{CharacterID: "a", Type: "chat", Message: "recent", Timestamp: now.Unix()},
+	}
+
+	for _, entry := range entries {
+		store.Logs.Add(entry)
+	}
+
+	lease := acquireLease()
+
+	if lease == nil {
+		t.Fatal("expected to become the leader")
+	}
+
+	rotateLogs(lease)
+
+	if length, _ := instance.LLen("logs").Result(); length != 1 {
+		t.Errorf("expected 1 log left in Redis, got %d", length)
+	}
+
+	hours, _ := instance.ZRange(logArchivesKey, 0, -1).Result()
+
+	if len(hours) != 2 {
+		t.Errorf("expected an archive for each hour left, got %v", hours)
+	}
+
+	for _, hour := range hours {
+		if ttl, _ := instance.TTL(logArchiveKey(hour)).Result(); ttl <= 0 {
+			t.Errorf("expected the archive for %s to expire, got %v", hour, ttl)
+		}
+	}
+
+	if keys, _ := instance.Keys(logArchiveKey("*")).Result(); len(keys) != 2 {
+		t.Errorf("expected the expired archive to be gone, got %v", keys)
+	}
+
+	// Queries read from the archive and the store, oldest first
+	logs, err := QueryLogs(LogFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make([]string, len(logs))
+
+	for i, entry := range logs {
+		messages[i] = entry.Message
+	}
+
+	if expected := []string{"oldest", "old", "recent"}; !equalStrings(messages, expected) {
+		t.Errorf("expected %v, got %v", expected, messages)
+	}
+
+	// Filters apply to archived logs too
+	if logs, _ := QueryLogs(LogFilter{CharacterID: "b"}); len(logs) != 1 || logs[0].Message != "old" {
+		t.Errorf("expected only b's log, got %v", logs)
+	}
+
+	// So do time windows, across the archive and the store
+	if logs, _ := QueryLogs(LogFilter{Since: now.Add(-150 * time.Minute), Until: now.Add(-time.Hour)}); len(logs) != 1 || logs[0].Message != "old" {
+		t.Errorf("expected only the log from two hours ago, got %v", logs)
+	}
+
+	// Rotating again doesn't archive anything twice
+	rotateLogs(lease)
+
+	if logs, _ := QueryLogs(LogFilter{}); len(logs) != 3 {
+		t.Errorf("expected 3 logs, got %d", len(logs))
+	}
+}
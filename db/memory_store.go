@@ -0,0 +1,1290 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+
+	"github.com/google/uuid"
+)
+
+// The memory store keeps everything in maps, for running a single server
+// without Redis and for tests. Records are kept as string fields, the same way
+// Redis keeps hashes, so that models bind the same way from both stores
+
+// NewMemoryStore returns an empty store that lives in this process
+func NewMemoryStore() *Store {
+	m := &memory{
+		characters:   map[string]map[string]string{},
+		emails:       map[string]string{},
+		identities:   map[string]string{},
+		active:       map[string]bool{},
+		achievements: map[string]map[string]string{},
+		settings:     map[string]map[string]string{},
+		projectIDs:   map[string]string{},
+		capabilities: map[string]map[string]bool{},
+		friends:      map[string]map[string]bool{},
+		teammates:    map[string]map[string]bool{},
+		requests:     map[string]map[string]bool{},
+		rooms:        map[string]map[string]string{},
+		roomChars:    map[string]map[string]bool{},
+		roomElements: map[string][]string{},
+		roomHalls:    map[string]map[string]bool{},
+		elements:     map[string]map[string]string{},
+		hallways:     map[string]map[string]string{},
+		messages:     map[string][]*models.Message{},
+		sponsors:     map[string]map[string]string{},
+		queues:       map[string][]*models.QueueSubscriber{},
+		watchers:     map[string]map[string]bool{},
+		songs:        map[string]*models.Song{},
+		cooldowns:    map[string]time.Time{},
+		events:       map[string]*models.Event{},
+		attendees:    map[string]map[string]bool{},
+		locations:    map[string]*models.Location{},
+		projects:     map[string]*models.Project{},
+		loginEmails:  map[models.Role]map[string]bool{},
+		emailSponsor: map[string]string{},
+		loginCodes:   map[string]*memoryLoginCode{},
+		codeRequests: map[string]*memoryCount{},
+		revoked:      map[string]bool{},
+		generations:  map[string]int{},
+	}
+
+	return &Store{
+		Characters: memoryCharacters{m},
+		Friends:    memoryFriends{m},
+		Rooms:      memoryRooms{m},
+		Messages:   memoryMessages{m},
+		Sponsors:   memorySponsors{m},
+		Songs:      memorySongs{m},
+		Events:     memoryEvents{m},
+		Locations:  memoryLocations{m},
+		Projects:   memoryProjects{m},
+		Logins:     memoryLogins{m},
+		Logs:       memoryLogs{m},
+		Tokens:     memoryTokens{m},
+	}
+}
+
+// Everything in a memory store, behind one lock
+type memory struct {
+	mu sync.Mutex
+
+	characters   map[string]map[string]string
+	emails       map[string]string
+	identities   map[string]string
+	active       map[string]bool
+	achievements map[string]map[string]string
+	settings     map[string]map[string]string
+	projectIDs   map[string]string
+	capabilities map[string]map[string]bool
+
+	friends   map[string]map[string]bool
+	teammates map[string]map[string]bool
+	requests  map[string]map[string]bool
+
+	rooms        map[string]map[string]string
+	roomChars    map[string]map[string]bool
+	roomElements map[string][]string
+	roomHalls    map[string]map[string]bool
+	elements     map[string]map[string]string
+	hallways     map[string]map[string]string
+
+	messages map[string][]*models.Message
+
+	sponsors map[string]map[string]string
+	queues   map[string][]*models.QueueSubscriber
+	watchers map[string]map[string]bool
+
+	songs       map[string]*models.Song
+	songQueue   []string
+	currentSong string
+	songEndsAt  time.Time
+	cooldowns   map[string]time.Time
+
+	events    map[string]*models.Event
+	attendees map[string]map[string]bool
+
+	locations map[string]*models.Location
+	projects  map[string]*models.Project
+
+	loginEmails  map[models.Role]map[string]bool
+	emailSponsor map[string]string
+	loginCodes   map[string]*memoryLoginCode
+	codeRequests map[string]*memoryCount
+
+	logs []*models.Log
+
+	revoked     map[string]bool
+	generations map[string]int
+}
+
+// Sets fields on a record the way Redis would, as strings
+func setFields(record map[string]string, fields map[string]interface{}) {
+	for field, value := range fields {
+		record[field] = fmt.Sprint(value)
+	}
+}
+
+// Returns the record with this ID, creating it if it doesn't exist yet
+func record(records map[string]map[string]string, id string) map[string]string {
+	if records[id] == nil {
+		records[id] = map[string]string{}
+	}
+
+	return records[id]
+}
+
+// Returns the set with this ID, creating it if it doesn't exist yet
+func set(sets map[string]map[string]bool, id string) map[string]bool {
+	if sets[id] == nil {
+		sets[id] = map[string]bool{}
+	}
+
+	return sets[id]
+}
+
+func members(s map[string]bool) []string {
+	ids := make([]string, 0, len(s))
+
+	for id := range s {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+type memoryCharacters struct {
+	*memory
+}
+
+func (s memoryCharacters) get(id string) *models.Character {
+	res, ok := s.characters[id]
+
+	if !ok {
+		return nil
+	}
+
+	character := new(models.Character)
+	utils.Bind(res, character)
+	character.ID = id
+	return character
+}
+
+func (s memoryCharacters) Get(id string) (*models.Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if character := s.get(id); character != nil {
+		return character, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s memoryCharacters) GetMany(ids []string) ([]*models.Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	characters := make([]*models.Character, 0, len(ids))
+
+	for _, id := range ids {
+		if character := s.get(id); character != nil {
+			characters = append(characters, character)
+		}
+	}
+
+	return characters, nil
+}
+
+func (s memoryCharacters) Create(character *models.Character) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.characters, character.ID), utils.StructToMap(character))
+	return nil
+}
+
+func (s memoryCharacters) Update(id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.characters, id), fields)
+	return nil
+}
+
+func (s memoryCharacters) Increment(id, field string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	character := record(s.characters, id)
+	count, _ := strconv.ParseInt(character[field], 10, 64)
+	count++
+	character[field] = strconv.FormatInt(count, 10)
+	return count, nil
+}
+
+func (s memoryCharacters) SetPositions(positions map[string]Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, position := range positions {
+		setFields(record(s.characters, id), map[string]interface{}{
+			"x": position.X,
+			"y": position.Y,
+		})
+	}
+
+	return nil
+}
+
+func (s memoryCharacters) IDForEmail(email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.emails[email]; ok {
+		return id, nil
+	}
+
+	return "", ErrNotFound
+}
+
+func (s memoryCharacters) IDForIdentity(provider, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.identities[provider+":"+subject]; ok {
+		return id, nil
+	}
+
+	return "", ErrNotFound
+}
+
+func (s memoryCharacters) LinkEmail(email, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.emails[email] = id
+	return nil
+}
+
+func (s memoryCharacters) LinkIdentity(provider, subject, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identities[provider+":"+subject] = id
+	return nil
+}
+
+func (s memoryCharacters) Connect(id, ingestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record(s.characters, id)["ingest"] = ingestID
+	s.active[id] = true
+	return nil
+}
+
+func (s memoryCharacters) Disconnect(id, ingestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(record(s.characters, id), "ingest")
+	delete(s.active, id)
+	return nil
+}
+
+func (s memoryCharacters) SetActive(id string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active[id] = active
+	return nil
+}
+
+func (s memoryCharacters) Active(ids []string) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make([]bool, len(ids))
+
+	for i, id := range ids {
+		active[i] = s.active[id]
+	}
+
+	return active, nil
+}
+
+func (s memoryCharacters) Achievements(id string) (*models.Achievements, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	achievements := new(models.Achievements)
+	utils.Bind(s.achievements[id], achievements)
+	return achievements, nil
+}
+
+func (s memoryCharacters) SetAchievement(id, achievement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record(s.achievements, id)[achievement] = "true"
+	return nil
+}
+
+func (s memoryCharacters) Settings(id string) (*models.Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := new(models.Settings)
+	utils.Bind(s.settings[id], settings)
+	return settings, nil
+}
+
+func (s memoryCharacters) UpdateSettings(id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.settings, id), fields)
+	return nil
+}
+
+func (s memoryCharacters) PhoneNumber(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings[id]["phoneNumber"], nil
+}
+
+func (s memoryCharacters) ProjectID(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.projectIDs[id], nil
+}
+
+func (s memoryCharacters) SetProjectID(id, projectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.projectIDs[id] = projectID
+	return nil
+}
+
+func (s memoryCharacters) Capabilities(id string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capabilities := make(map[string]bool, len(s.capabilities[id]))
+
+	for capability, granted := range s.capabilities[id] {
+		capabilities[capability] = granted
+	}
+
+	return capabilities, nil
+}
+
+func (s memoryCharacters) SetCapability(id, capability string, granted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.capabilities[id] == nil {
+		s.capabilities[id] = map[string]bool{}
+	}
+
+	s.capabilities[id][capability] = granted
+	return nil
+}
+
+func (s memoryCharacters) ClearCapability(id, capability string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.capabilities[id], capability)
+	return nil
+}
+
+type memoryFriends struct {
+	*memory
+}
+
+func (s memoryFriends) Friends(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return members(s.friends[id]), nil
+}
+
+func (s memoryFriends) Teammates(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return members(s.teammates[id]), nil
+}
+
+func (s memoryFriends) Requests(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return members(s.requests[id]), nil
+}
+
+func (s memoryFriends) IsFriend(id, otherID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.friends[id][otherID], nil
+}
+
+func (s memoryFriends) IsTeammate(id, otherID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.teammates[id][otherID], nil
+}
+
+func (s memoryFriends) HasRequest(id, fromID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[id][fromID], nil
+}
+
+func (s memoryFriends) AddRequest(id, fromID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set(s.requests, id)[fromID] = true
+	return nil
+}
+
+func (s memoryFriends) AcceptRequest(id, fromID string) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.requests[id], fromID)
+	set(s.friends, id)[fromID] = true
+	set(s.friends, fromID)[id] = true
+	return int64(len(s.friends[id])), int64(len(s.friends[fromID])), nil
+}
+
+type memoryRooms struct {
+	*memory
+}
+
+func (s memoryRooms) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.rooms))
+
+	for id := range s.rooms {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s memoryRooms) Exists(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.rooms[id]
+	return ok, nil
+}
+
+func (s memoryRooms) Get(id string) (*models.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := new(models.Room).Init()
+	utils.Bind(s.rooms[id], room)
+	room.ID = id
+	return room, nil
+}
+
+func (s memoryRooms) Create(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createRoom(room, elements, hallways)
+	return nil
+}
+
+func (s memoryRooms) Replace(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, elementID := range s.roomElements[room.ID] {
+		delete(s.elements, elementID)
+	}
+
+	for hallwayID := range s.roomHalls[room.ID] {
+		delete(s.hallways, hallwayID)
+	}
+
+	delete(s.rooms, room.ID)
+	delete(s.roomElements, room.ID)
+	delete(s.roomHalls, room.ID)
+	s.createRoom(room, elements, hallways)
+	return nil
+}
+
+// Must be called while holding s.mu
+func (s memoryRooms) createRoom(room *models.Room, elements []*models.Element, hallways []*models.Hallway) {
+	setFields(record(s.rooms, room.ID), utils.StructToMap(room))
+
+	for _, element := range elements {
+		elementID := uuid.New().String()
+		setFields(record(s.elements, elementID), utils.StructToMap(element))
+		s.roomElements[room.ID] = append(s.roomElements[room.ID], elementID)
+	}
+
+	for _, hallway := range hallways {
+		hallwayID := uuid.New().String()
+		setFields(record(s.hallways, hallwayID), utils.StructToMap(hallway))
+		set(s.roomHalls, room.ID)[hallwayID] = true
+	}
+}
+
+func (s memoryRooms) Characters(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return members(s.roomChars[id]), nil
+}
+
+func (s memoryRooms) AddCharacter(id, characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set(s.roomChars, id)[characterID] = true
+	return nil
+}
+
+func (s memoryRooms) RemoveCharacter(id, characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.roomChars[id], characterID)
+	return nil
+}
+
+func (s memoryRooms) Elements(id string) ([]*models.Element, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elements := make([]*models.Element, 0, len(s.roomElements[id]))
+
+	for _, elementID := range s.roomElements[id] {
+		if res, ok := s.elements[elementID]; ok {
+			element := new(models.Element)
+			utils.Bind(res, element)
+			element.ID = elementID
+			elements = append(elements, element)
+		}
+	}
+
+	return elements, nil
+}
+
+func (s memoryRooms) Element(elementID string) (*models.Element, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, ok := s.elements[elementID]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	element := new(models.Element)
+	utils.Bind(res, element)
+	element.ID = elementID
+	return element, nil
+}
+
+func (s memoryRooms) SaveElement(elementID string, element *models.Element) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.elements, elementID), utils.StructToMap(element))
+	return nil
+}
+
+func (s memoryRooms) SetElementState(elementID string, state int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record(s.elements, elementID)["state"] = strconv.Itoa(state)
+	return nil
+}
+
+func (s memoryRooms) Hallways(id string) (map[string]*models.Hallway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hallways := make(map[string]*models.Hallway, len(s.roomHalls[id]))
+
+	for hallwayID := range s.roomHalls[id] {
+		if res, ok := s.hallways[hallwayID]; ok {
+			hallways[hallwayID] = new(models.Hallway)
+			utils.Bind(res, hallways[hallwayID])
+		}
+	}
+
+	return hallways, nil
+}
+
+func (s memoryRooms) Hallway(hallwayID string) (*models.Hallway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, ok := s.hallways[hallwayID]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	hallway := new(models.Hallway)
+	utils.Bind(res, hallway)
+	return hallway, nil
+}
+
+func (s memoryRooms) AddHallway(id, hallwayID string, hallway *models.Hallway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.hallways, hallwayID), utils.StructToMap(hallway))
+	set(s.roomHalls, id)[hallwayID] = true
+	return nil
+}
+
+func (s memoryRooms) SaveHallway(hallwayID string, hallway *models.Hallway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.hallways, hallwayID), utils.StructToMap(hallway))
+	return nil
+}
+
+func (s memoryRooms) DeleteHallway(id, hallwayID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.hallways, hallwayID)
+	delete(s.roomHalls[id], hallwayID)
+	return nil
+}
+
+type memoryMessages struct {
+	*memory
+}
+
+func (s memoryMessages) Add(message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conversationKey(message.From, message.To)
+	saved := *message
+	s.messages[key] = append(s.messages[key], &saved)
+	return nil
+}
+
+func (s memoryMessages) Conversation(id, otherID string, limit int) ([]*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation := s.messages[conversationKey(id, otherID)]
+
+	if len(conversation) > limit {
+		conversation = conversation[len(conversation)-limit:]
+	}
+
+	messages := make([]*models.Message, len(conversation))
+
+	for i, message := range conversation {
+		saved := *message
+		messages[i] = &saved
+	}
+
+	return messages, nil
+}
+
+type memorySponsors struct {
+	*memory
+}
+
+func (s memorySponsors) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.sponsors))
+
+	for id := range s.sponsors {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s memorySponsors) Get(id string) (*models.Sponsor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, ok := s.sponsors[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	sponsor := new(models.Sponsor)
+	utils.Bind(res, sponsor)
+	sponsor.ID = id
+	return sponsor, nil
+}
+
+func (s memorySponsors) Create(sponsor *models.Sponsor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.sponsors, sponsor.ID), utils.StructToMap(sponsor))
+	return nil
+}
+
+func (s memorySponsors) Update(id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setFields(record(s.sponsors, id), fields)
+	return nil
+}
+
+func (s memorySponsors) Queue(id string) ([]*models.QueueSubscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscribers := make([]*models.QueueSubscriber, len(s.queues[id]))
+
+	for i, subscriber := range s.queues[id] {
+		saved := *subscriber
+		subscribers[i] = &saved
+	}
+
+	return subscribers, nil
+}
+
+func (s memorySponsors) Join(id string, subscriber *models.QueueSubscriber) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position := s.position(id, subscriber.ID); position > 0 {
+		return position, false, nil
+	}
+
+	saved := *subscriber
+	s.queues[id] = append(s.queues[id], &saved)
+	return len(s.queues[id]), true, nil
+}
+
+func (s memorySponsors) Position(id, characterID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.position(id, characterID), nil
+}
+
+func (s memorySponsors) Remove(id, characterID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	position := s.position(id, characterID)
+
+	if position == 0 {
+		return false, nil
+	}
+
+	s.queues[id] = append(s.queues[id][:position-1], s.queues[id][position:]...)
+	return true, nil
+}
+
+func (s memorySponsors) Next(id string) (*models.QueueSubscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queues[id]) == 0 {
+		return nil, ErrNotFound
+	}
+
+	subscriber := s.queues[id][0]
+	s.queues[id] = s.queues[id][1:]
+	return subscriber, nil
+}
+
+func (s memorySponsors) Move(id, characterID string, position int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from := s.position(id, characterID)
+
+	if from == 0 {
+		return 0, nil
+	}
+
+	queue := s.queues[id]
+
+	if position < 1 {
+		position = 1
+	} else if position > len(queue) {
+		position = len(queue)
+	}
+
+	subscriber := queue[from-1]
+	queue = append(queue[:from-1], queue[from:]...)
+	queue = append(queue[:position-1], append([]*models.QueueSubscriber{subscriber}, queue[position-1:]...)...)
+	s.queues[id] = queue
+	return position, nil
+}
+
+// Must be called while holding s.mu
+func (s memorySponsors) position(id, characterID string) int {
+	for i, subscriber := range s.queues[id] {
+		if subscriber.ID == characterID {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func (s memorySponsors) Watchers(id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return members(s.watchers[id]), nil
+}
+
+func (s memorySponsors) Watch(id, characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set(s.watchers, id)[characterID] = true
+	return nil
+}
+
+func (s memorySponsors) Unwatch(id, characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.watchers[id], characterID)
+	return nil
+}
+
+type memorySongs struct {
+	*memory
+}
+
+func (s memorySongs) Queue() ([]*models.Song, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	songs := make([]*models.Song, 0, len(s.songQueue))
+
+	for _, id := range s.songQueue {
+		if song, ok := s.songs[id]; ok {
+			saved := *song
+			songs = append(songs, &saved)
+		}
+	}
+
+	return songs, nil
+}
+
+func (s memorySongs) Add(song *models.Song) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *song
+	s.songs[song.ID] = &saved
+	s.songQueue = append(s.songQueue, song.ID)
+	return nil
+}
+
+func (s memorySongs) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.songs, id)
+
+	for i, songID := range s.songQueue {
+		if songID == id {
+			s.songQueue = append(s.songQueue[:i], s.songQueue[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s memorySongs) Next() (*models.Song, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.songQueue) == 0 {
+		return nil, ErrNotFound
+	}
+
+	id := s.songQueue[0]
+	s.songQueue = s.songQueue[1:]
+	song := &models.Song{ID: id}
+
+	if saved, ok := s.songs[id]; ok {
+		*song = *saved
+	}
+
+	return song, nil
+}
+
+func (s memorySongs) Current() (*models.Song, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	song := &models.Song{ID: s.currentSong}
+
+	if saved, ok := s.songs[s.currentSong]; ok {
+		*song = *saved
+	}
+
+	return song, s.songEndsAt, nil
+}
+
+func (s memorySongs) SetCurrent(id string, endsAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.currentSong = id
+	s.songEndsAt = endsAt
+	return nil
+}
+
+func (s memorySongs) Cooldown(characterID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.cooldowns[characterID]
+	return until, ok, nil
+}
+
+func (s memorySongs) SetCooldown(characterID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cooldowns[characterID] = until
+	return nil
+}
+
+type memoryEvents struct {
+	*memory
+}
+
+func (s memoryEvents) List() ([]*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*models.Event, 0, len(s.events))
+
+	for id, event := range s.events {
+		saved := *event
+		saved.ID = id
+		events = append(events, &saved)
+	}
+
+	return events, nil
+}
+
+func (s memoryEvents) Get(id string) (*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	saved := *event
+	saved.ID = id
+	return &saved, nil
+}
+
+func (s memoryEvents) Create(id string, event *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *event
+	s.events[id] = &saved
+	return nil
+}
+
+func (s memoryEvents) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, id)
+	return nil
+}
+
+func (s memoryEvents) Attend(id, characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set(s.attendees, id)[characterID] = true
+	return nil
+}
+
+type memoryLocations struct {
+	*memory
+}
+
+func (s memoryLocations) List() ([]*models.Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locations := make([]*models.Location, 0, len(s.locations))
+
+	for _, location := range s.locations {
+		saved := *location
+		locations = append(locations, &saved)
+	}
+
+	return locations, nil
+}
+
+func (s memoryLocations) Save(characterID string, location *models.Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *location
+	s.locations[characterID] = &saved
+	return nil
+}
+
+type memoryProjects struct {
+	*memory
+}
+
+func (s memoryProjects) Get(id string) (*models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project, ok := s.projects[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	saved := *project
+	return &saved, nil
+}
+
+func (s memoryProjects) Save(id string, project *models.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *project
+	s.projects[id] = &saved
+	return nil
+}
+
+type memoryLogins struct {
+	*memory
+}
+
+func (s memoryLogins) HasEmail(role models.Role, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.loginEmails[role][email], nil
+}
+
+func (s memoryLogins) AddEmail(role models.Role, email, sponsorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := loginEmailKeys[role]; !ok {
+		return nil
+	}
+
+	if s.loginEmails[role] == nil {
+		s.loginEmails[role] = map[string]bool{}
+	}
+
+	if role == models.SponsorRep {
+		s.emailSponsor[email] = sponsorID
+	}
+
+	s.loginEmails[role][email] = true
+	return nil
+}
+
+func (s memoryLogins) SponsorForEmail(email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.emailSponsor[email], nil
+}
+
+// A login code, and how many wrong guesses have been made at it
+type memoryLoginCode struct {
+	code      int
+	attempts  int
+	expiresAt time.Time
+}
+
+// A counter that starts over at the end of each window
+type memoryCount struct {
+	count     int
+	expiresAt time.Time
+}
+
+func (s memoryLogins) AddCode(email string, code int, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginCodes[email] = &memoryLoginCode{code: code, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s memoryLogins) CheckCode(email string, code int, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loginCode, ok := s.loginCodes[email]
+
+	if !ok || time.Now().After(loginCode.expiresAt) {
+		delete(s.loginCodes, email)
+		return false, nil
+	}
+
+	if loginCode.code == code {
+		delete(s.loginCodes, email)
+		return true, nil
+	}
+
+	loginCode.attempts++
+
+	if loginCode.attempts >= maxAttempts {
+		delete(s.loginCodes, email)
+	}
+
+	return false, nil
+}
+
+func (s memoryLogins) CountCodeRequest(email string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests, ok := s.codeRequests[email]
+
+	if !ok || time.Now().After(requests.expiresAt) {
+		requests = &memoryCount{expiresAt: time.Now().Add(window)}
+		s.codeRequests[email] = requests
+	}
+
+	requests.count++
+	return requests.count, nil
+}
+
+type memoryLogs struct {
+	*memory
+}
+
+func (s memoryLogs) Add(log *models.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *log
+	s.logs = append(s.logs, &saved)
+	return nil
+}
+
+func (s memoryLogs) Query(filter LogFilter) ([]*models.Log, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var logs []*models.Log
+
+	for _, entry := range s.logs {
+		if filter.Limit > 0 && len(logs) >= filter.Limit {
+			break
+		}
+
+		if filter.Matches(entry) {
+			saved := *entry
+			logs = append(logs, &saved)
+		}
+	}
+
+	return logs, nil
+}
+
+func (s memoryLogs) DeleteBefore(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Logs are added in order, so the old ones are all at the start
+	expired := 0
+
+	for expired < len(s.logs) && s.logs[expired].Timestamp < before.Unix() {
+		expired++
+	}
+
+	s.logs = s.logs[expired:]
+	return nil
+}
+
+type memoryTokens struct {
+	*memory
+}
+
+func (s memoryTokens) Revoke(tokenID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revoked[tokenID] {
+		return false, nil
+	}
+
+	s.revoked[tokenID] = true
+	return true, nil
+}
+
+func (s memoryTokens) IsRevoked(tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revoked[tokenID], nil
+}
+
+func (s memoryTokens) RevokeAll(characterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generations[characterID]++
+	return nil
+}
+
+func (s memoryTokens) Generation(characterID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generations[characterID], nil
+}
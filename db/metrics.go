@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/techx/playground/metrics"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "jukebox_queue_length",
+		Help:      "Songs waiting in the jukebox queue.",
+	}, jukeboxQueueLength)
+}
+
+// Reads the queue length from Redis directly, since listing the queue would
+// load every song in it on each scrape
+func jukeboxQueueLength() float64 {
+	if instance != nil {
+		length, err := instance.LLen("songs").Result()
+
+		if err != nil {
+			return 0
+		}
+
+		return float64(length)
+	}
+
+	if store == nil {
+		return 0
+	}
+
+	songs, err := store.Songs.Queue()
+
+	if err != nil {
+		return 0
+	}
+
+	return float64(len(songs))
+}
+
+type pipelineStartKey struct{}
+
+// Times every pipeline and transaction sent to Redis. Single commands aren't
+// timed, since nearly everything the hub does in bulk goes through a pipeline
+type metricsHook struct{}
+
+func (metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, pipelineStartKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(pipelineStartKey{}).(time.Time); ok {
+		metrics.RedisPipelineDuration.Observe(time.Since(start).Seconds())
+	}
+
+	return nil
+}
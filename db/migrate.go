@@ -0,0 +1,180 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/go-redis/redis/v7"
+)
+
+const (
+	// Holds the version of the newest migration applied to this database
+	schemaVersionKey = "schema_version"
+
+	// Held while migrations run, so that two servers don't run them at once
+	schemaLockKey = "schema_version:lock"
+)
+
+// ErrMigrationRunning is returned when another server is already migrating
+var ErrMigrationRunning = errors.New("another migration is already running")
+
+// Gives up the migration lock, but only if we're still the ones holding it. If
+// a migration outlives the lock, another server may have taken it since
+var releaseSchemaLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// Migration changes the layout of our data in Redis from one version to the
+// next. Migrations should be safe to run again if they're interrupted partway
+// through
+type Migration struct {
+	// Migrations run in order of version, starting from 1
+	Version int
+	Name    string
+
+	// Applies the migration, and returns how many keys it changed. If dryRun
+	// is true, nothing is changed and it returns how many keys it would change
+	Run func(client *redis.Client, dryRun bool) (int, error)
+}
+
+var migrations []Migration
+
+// RegisterMigration adds a migration. Call it from an init function
+func RegisterMigration(migration Migration) {
+	migrations = append(migrations, migration)
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// Returns the version of the newest migration we know about
+func latestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the newest migration applied to Redis
+func SchemaVersion() (int, error) {
+	res, err := instance.Get(schemaVersionKey).Result()
+
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(res)
+}
+
+// Marks every migration as applied, for databases that were just created in
+// the newest layout
+func setLatestSchemaVersion() {
+	instance.Set(schemaVersionKey, latestSchemaVersion(), 0)
+}
+
+// Logs a warning if Redis is missing some migrations
+func checkSchemaVersion() {
+	version, err := SchemaVersion()
+
+	if err != nil {
+		log.Println("ERROR: Unable to check schema version ->", err)
+	} else if version < latestSchemaVersion() {
+		log.Println("WARNING: Database is on schema version", version, "but the newest is", latestSchemaVersion(), "-- run with -migrate to update it")
+	}
+}
+
+// Migrate applies every migration that Redis doesn't have yet, in order. With
+// dryRun, it only reports how many keys each one would change
+func Migrate(dryRun bool) error {
+	if instance == nil {
+		log.Println("Nothing to migrate in memory")
+		return nil
+	}
+
+	if !dryRun {
+		token := uuid.New().String()
+		locked, err := instance.SetNX(schemaLockKey, token, 10*time.Minute).Result()
+
+		if err != nil {
+			return err
+		} else if !locked {
+			return ErrMigrationRunning
+		}
+
+		defer releaseSchemaLock(token)
+	}
+
+	version, err := SchemaVersion()
+
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		pending++
+		count, err := migration.Run(instance, dryRun)
+
+		if err != nil {
+			log.Println("ERROR: Migration", migration.Version, "("+migration.Name+") failed after changing", count, "keys")
+			return err
+		}
+
+		if dryRun {
+			log.Println("Migration", migration.Version, "("+migration.Name+") would change", count, "keys")
+			continue
+		}
+
+		// Record each migration as it finishes, so that a failure later on
+		// doesn't make us run this one again
+		if err := instance.Set(schemaVersionKey, migration.Version, 0).Err(); err != nil {
+			return err
+		}
+
+		log.Println("Migration", migration.Version, "("+migration.Name+") changed", count, "keys")
+	}
+
+	if pending == 0 {
+		log.Println("Database is already on schema version", version)
+	}
+
+	return nil
+}
+
+func releaseSchemaLock(token string) {
+	if err := releaseSchemaLockScript.Run(instance, []string{schemaLockKey}, token).Err(); err != nil {
+		log.Println("ERROR: Unable to release migration lock ->", err)
+	}
+}
+
+// Calls fn with every key matching a pattern, without blocking Redis like KEYS
+// would
+func scanKeys(client *redis.Client, pattern string, fn func(key string) error) error {
+	iter := client.Scan(0, pattern, 100).Iterator()
+
+	for iter.Next() {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
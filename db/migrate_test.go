@@ -0,0 +1,287 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Swaps in a different set of migrations for the rest of the test
+func useMigrations(t *testing.T, testMigrations ...Migration) {
+	oldMigrations := migrations
+	migrations = nil
+
+	for _, migration := range testMigrations {
+		RegisterMigration(migration)
+	}
+
+	t.Cleanup(func() {
+		migrations = oldMigrations
+	})
+}
+
+// Returns a migration that records when it runs by adding its version to the
+// "ran" list, unless it's a dry run
+func recordingMigration(version int) Migration {
+	return Migration{
+		Version: version,
+		Name:    "test",
+		Run: func(client *redis.Client, dryRun bool) (int, error) {
+			if !dryRun {
+				client.RPush("ran", version)
+			}
+
+			return 1, nil
+		},
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	useTestRedis(t)
+
+	// Registered out of order, but run in order
+	useMigrations(t, recordingMigration(2), recordingMigration(1), recordingMigration(3))
+
+	if version, _ := SchemaVersion(); version != 0 {
+		t.Fatalf("expected a new database to be on version 0, got %d", version)
+	}
+
+	if err := Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if ran, _ := instance.LRange("ran", 0, -1).Result(); !equalStrings(ran, []string{"1", "2", "3"}) {
+		t.Errorf("expected migrations to run in order, got %v", ran)
+	}
+
+	if version, _ := SchemaVersion(); version != 3 {
+		t.Errorf("expected version 3, got %d", version)
+	}
+
+	// Migrations that already ran are skipped, and only new ones run
+	RegisterMigration(recordingMigration(4))
+
+	if err := Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if ran, _ := instance.LRange("ran", 0, -1).Result(); !equalStrings(ran, []string{"1", "2", "3", "4"}) {
+		t.Errorf("expected only the new migration to run, got %v", ran)
+	}
+
+	// The lock is released once migrations finish
+	if exists, _ := instance.Exists(schemaLockKey).Result(); exists != 0 {
+		t.Error("expected the lock to be released")
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	useTestRedis(t)
+	useMigrations(t, recordingMigration(1), recordingMigration(2))
+
+	if err := Migrate(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if ran, _ := instance.LRange("ran", 0, -1).Result(); len(ran) != 0 {
+		t.Errorf("dry runs shouldn't change anything, got %v", ran)
+	}
+
+	if version, _ := SchemaVersion(); version != 0 {
+		t.Errorf("dry runs shouldn't change the version, got %d", version)
+	}
+
+	// Dry runs don't need the lock, so they work while a migration is running
+	instance.Set(schemaLockKey, "someone-else", time.Minute)
+
+	if err := Migrate(true); err != nil {
+		t.Errorf("expected dry runs to ignore the lock, got %v", err)
+	}
+}
+
+func TestMigrateLocked(t *testing.T) {
+	useTestRedis(t)
+	useMigrations(t, recordingMigration(1))
+
+	instance.Set(schemaLockKey, "someone-else", time.Minute)
+
+	if err := Migrate(false); err != ErrMigrationRunning {
+		t.Errorf("expected ErrMigrationRunning, got %v", err)
+	}
+
+	if ran, _ := instance.LRange("ran", 0, -1).Result(); len(ran) != 0 {
+		t.Errorf("nothing should run while another server is migrating, got %v", ran)
+	}
+
+	if holder, _ := instance.Get(schemaLockKey).Result(); holder != "someone-else" {
+		t.Errorf("expected the other server to keep the lock, got %s", holder)
+	}
+}
+
+func TestMigrateLockRelease(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Whether the lock runs out partway through, and another server takes
+		// it over
+		takenOver bool
+		holder    string
+	}{
+		{"held throughout", false, ""},
+		{"taken over", true, "someone-else"},
+	}
+
+	for _, test := range tests {
+		useTestRedis(t)
+
+		useMigrations(t, Migration{
+			Version: 1,
+			Name:    "test",
+			Run: func(client *redis.Client, dryRun bool) (int, error) {
+				if test.takenOver {
+					client.Set(schemaLockKey, "someone-else", time.Minute)
+				}
+
+				return 1, nil
+			},
+		})
+
+		if err := Migrate(false); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		// We only ever release our own lock
+		if holder, _ := instance.Get(schemaLockKey).Result(); holder != test.holder {
+			t.Errorf("%s: expected the lock to be held by %q, got %q", test.name, test.holder, holder)
+		}
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	useTestRedis(t)
+
+	failure := errors.New("failed")
+
+	useMigrations(t, recordingMigration(1), Migration{
+		Version: 2,
+		Name:    "broken",
+		Run: func(client *redis.Client, dryRun bool) (int, error) {
+			return 0, failure
+		},
+	}, recordingMigration(3))
+
+	if err := Migrate(false); err != failure {
+		t.Errorf("expected the migration's error, got %v", err)
+	}
+
+	// Migrations before the broken one stay applied, and nothing after it runs
+	if version, _ := SchemaVersion(); version != 1 {
+		t.Errorf("expected version 1, got %d", version)
+	}
+
+	if ran, _ := instance.LRange("ran", 0, -1).Result(); !equalStrings(ran, []string{"1"}) {
+		t.Errorf("expected only the first migration to run, got %v", ran)
+	}
+}
+
+func TestLowercaseLoginEmails(t *testing.T) {
+	useTestRedis(t)
+
+	instance.SAdd("sponsor_emails", "Rep@Example.com", "other@example.com")
+	instance.SAdd("mentor_emails", "mentor@example.com")
+	instance.HSet("emailToSponsor", "Rep@Example.com", "acme")
+	instance.HSet("emailToCharacter", "Old@Example.com", "old-character", "old@example.com", "new-character")
+
+	// Sponsor emails, emailToSponsor, and emailToCharacter need changes
+	if count, err := lowercaseLoginEmails(instance, true); err != nil || count != 3 {
+		t.Errorf("expected a dry run to count 3 keys, got %d (%v)", count, err)
+	}
+
+	if ok, _ := instance.SIsMember("sponsor_emails", "Rep@Example.com").Result(); !ok {
+		t.Fatal("dry run shouldn't change anything")
+	}
+
+	if count, err := lowercaseLoginEmails(instance, false); err != nil || count != 3 {
+		t.Errorf("expected 3 keys to change, got %d (%v)", count, err)
+	}
+
+	tests := []struct {
+		key     string
+		members []string
+	}{
+		{"sponsor_emails", []string{"other@example.com", "rep@example.com"}},
+		{"mentor_emails", []string{"mentor@example.com"}},
+	}
+
+	for _, test := range tests {
+		members, _ := instance.SMembers(test.key).Result()
+
+		if !equalStrings(sortedStrings(members), test.members) {
+			t.Errorf("%s: expected %v, got %v", test.key, test.members, members)
+		}
+	}
+
+	if sponsor, _ := instance.HGet("emailToSponsor", "rep@example.com").Result(); sponsor != "acme" {
+		t.Errorf("expected emailToSponsor to be lowercased, got %q", sponsor)
+	}
+
+	// Logins that already used the lowercase email keep their character
+	characters, _ := instance.HGetAll("emailToCharacter").Result()
+
+	if len(characters) != 1 || characters["old@example.com"] != "new-character" {
+		t.Errorf("expected the lowercase login to win, got %v", characters)
+	}
+
+	// Running it again changes nothing
+	if count, _ := lowercaseLoginEmails(instance, false); count != 0 {
+		t.Errorf("expected nothing left to change, got %d", count)
+	}
+}
+
+func TestRemoveStaleIngestKeys(t *testing.T) {
+	useTestRedis(t)
+
+	instance.RPush("ingests", "live")
+	instance.SAdd("ingest:live:characters", "a")
+	instance.SAdd("ingest:dead:characters", "b")
+	instance.HSet("ingest:dead:positions", "stream:all", "1-0")
+	instance.Set("ingest:dead:alive", "true", time.Minute)
+	instance.HSet("character:b", "room", "plaza")
+	instance.SAdd("room:plaza:characters", "b", "c")
+
+	if count, err := removeStaleIngestKeys(instance, true); err != nil || count != 2 {
+		t.Errorf("expected a dry run to count 2 keys, got %d (%v)", count, err)
+	}
+
+	if exists, _ := instance.Exists("ingest:dead:characters").Result(); exists != 1 {
+		t.Fatal("dry run shouldn't change anything")
+	}
+
+	if count, err := removeStaleIngestKeys(instance, false); err != nil || count != 2 {
+		t.Errorf("expected 2 keys to change, got %d (%v)", count, err)
+	}
+
+	tests := []struct {
+		key    string
+		exists bool
+	}{
+		{"ingest:live:characters", true},
+		{"ingest:dead:characters", false},
+		{"ingest:dead:positions", false},
+
+		// Heartbeats expire on their own
+		{"ingest:dead:alive", true},
+	}
+
+	for _, test := range tests {
+		if exists, _ := instance.Exists(test.key).Result(); (exists == 1) != test.exists {
+			t.Errorf("%s: expected exists to be %v", test.key, test.exists)
+		}
+	}
+
+	if members, _ := instance.SMembers("room:plaza:characters").Result(); !equalStrings(members, []string{"c"}) {
+		t.Errorf("expected the dead ingest's character to leave their room, got %v", members)
+	}
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/techx/playground/config"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 1,
+		Name:    "lowercase_login_emails",
+		Run:     lowercaseLoginEmails,
+	})
+
+	RegisterMigration(Migration{
+		Version: 2,
+		Name:    "remove_stale_ingest_keys",
+		Run:     removeStaleIngestKeys,
+	})
+
+	RegisterMigration(Migration{
+		Version: 3,
+		Name:    "index_sponsor_queues",
+		Run:     indexSponsorQueues,
+	})
+
+	RegisterMigration(Migration{
+		Version: 4,
+		Name:    "redact_packet_logs",
+		Run:     redactPacketLogs,
+	})
+
+	RegisterMigration(Migration{
+		Version: 5,
+		Name:    "remove_login_requests",
+		Run:     removeLoginRequests,
+	})
+}
+
+// Emails used to be saved the way they were typed, but logins look them up in
+// lowercase, so anyone added with a capital letter couldn't log in
+func lowercaseLoginEmails(client *redis.Client, dryRun bool) (int, error) {
+	touched := 0
+
+	for _, key := range loginEmailKeys {
+		emails, err := client.SMembers(key).Result()
+
+		if err != nil {
+			return touched, err
+		}
+
+		var mixed []string
+
+		for _, email := range emails {
+			if email != strings.ToLower(email) {
+				mixed = append(mixed, email)
+			}
+		}
+
+		if len(mixed) == 0 {
+			continue
+		}
+
+		touched++
+
+		if dryRun {
+			continue
+		}
+
+		pip := client.TxPipeline()
+
+		for _, email := range mixed {
+			pip.SRem(key, email)
+			pip.SAdd(key, strings.ToLower(email))
+		}
+
+		if _, err := pip.Exec(); err != nil {
+			return touched, err
+		}
+	}
+
+	for _, key := range []string{"emailToSponsor", "emailToCharacter"} {
+		emails, err := client.HGetAll(key).Result()
+
+		if err != nil {
+			return touched, err
+		}
+
+		var mixed []string
+
+		for email := range emails {
+			if email != strings.ToLower(email) {
+				mixed = append(mixed, email)
+			}
+		}
+
+		if len(mixed) == 0 {
+			continue
+		}
+
+		touched++
+
+		if dryRun {
+			continue
+		}
+
+		pip := client.TxPipeline()
+
+		for _, email := range mixed {
+			// If this person has already logged in with the lowercase email,
+			// keep what that login points to
+			pip.HSetNX(key, strings.ToLower(email), emails[email])
+			pip.HDel(key, email)
+		}
+
+		if _, err := pip.Exec(); err != nil {
+			return touched, err
+		}
+	}
+
+	return touched, nil
+}
+
+// Ingests that went away before the leader cleaned up after them (or before
+// there was a leader) left their characters and stream positions behind
+func removeStaleIngestKeys(client *redis.Client, dryRun bool) (int, error) {
+	ingestIDs, err := client.LRange("ingests", 0, -1).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	live := map[string]bool{}
+
+	for _, id := range ingestIDs {
+		live[id] = true
+	}
+
+	touched := 0
+
+	err = scanKeys(client, "ingest:*", func(key string) error {
+		parts := strings.Split(key, ":")
+
+		if len(parts) != 3 || parts[2] == "alive" || live[parts[1]] {
+			return nil
+		}
+
+		touched++
+
+		if dryRun {
+			return nil
+		}
+
+		pip := client.TxPipeline()
+
+		if parts[2] == "characters" {
+			// Nobody is connected to this ingest, so take its characters out
+			// of their rooms
+			characters, err := client.SMembers(key).Result()
+
+			if err != nil {
+				return err
+			}
+
+			for _, characterID := range characters {
+				room, err := client.HGet("character:"+characterID, "room").Result()
+
+				if err == nil {
+					pip.SRem("room:"+room+":characters", characterID)
+				}
+			}
+		}
+
+		pip.Del(key)
+		_, err := pip.Exec()
+		return err
+	})
+
+	return touched, err
+}
+
+// Sponsor queues now keep an index of where everyone is (see redis_queue.go).
+// Queues from before then can also have the same hacker in them twice, from
+// two ingests adding them at once
+func indexSponsorQueues(client *redis.Client, dryRun bool) (int, error) {
+	touched := 0
+
+	err := scanKeys(client, "sponsor:*:hackerqueue", func(key string) error {
+		characterIDs, err := client.LRange(key, 0, -1).Result()
+
+		if err != nil {
+			return err
+		}
+
+		// Keep everyone at the first spot they had
+		seen := map[string]bool{}
+		var queue []string
+
+		for _, characterID := range characterIDs {
+			if !seen[characterID] {
+				seen[characterID] = true
+				queue = append(queue, characterID)
+			}
+		}
+
+		touched += 2
+
+		if dryRun {
+			return nil
+		}
+
+		pip := client.TxPipeline()
+		pip.Del(key, key+":positions")
+
+		if len(queue) > 0 {
+			positions := make(map[string]interface{}, len(queue))
+
+			for i, characterID := range queue {
+				pip.RPush(key, characterID)
+				positions[characterID] = i + 1
+			}
+
+			pip.HSet(key+":positions", positions)
+		}
+
+		_, err = pip.Exec()
+		return err
+	})
+
+	return touched, err
+}
+
+// Packet logs used to keep everything clients sent, including login tokens and
+// codes. Redact them the same way new logs are, and fill in their packet types
+func redactPacketLogs(client *redis.Client, dryRun bool) (int, error) {
+	touched := 0
+
+	err := scanKeys(client, "log:*", func(key string) error {
+		fields, err := client.HMGet(key, "message", "type").Result()
+
+		if err != nil {
+			return err
+		}
+
+		message, _ := fields[0].(string)
+		packetType, _ := fields[1].(string)
+
+		var res struct {
+			Type string `json:"type"`
+		}
+
+		if err := json.Unmarshal([]byte(message), &res); err != nil {
+			return nil
+		}
+
+		redactedMessage, err := RedactFields([]byte(message), config.GetConfig().GetStringSlice("logs.redact."+res.Type))
+
+		if err != nil || (string(redactedMessage) == message && packetType == res.Type) {
+			return nil
+		}
+
+		touched++
+
+		if dryRun {
+			return nil
+		}
+
+		return client.HSet(key, "message", string(redactedMessage), "type", res.Type).Err()
+	})
+
+	return touched, err
+}
+
+// Login codes used to live in one set that was never cleaned up, and they
+// never expired. They're kept per email now (see redis_store.go)
+func removeLoginRequests(client *redis.Client, dryRun bool) (int, error) {
+	exists, err := client.Exists("login_requests").Result()
+
+	if err != nil || exists == 0 || dryRun {
+		return int(exists), err
+	}
+
+	return 1, client.Del("login_requests").Err()
+}
@@ -23,6 +23,23 @@ const (
 	defaultPantsColor = "#ecf0f1"
 )
 
+var roleNames = map[Role]string{
+	Guest:      "guest",
+	Organizer:  "organizer",
+	SponsorRep: "sponsor",
+	Mentor:     "mentor",
+	Hacker:     "hacker",
+}
+
+// String returns the name used for this role in config files, e.g. "sponsor"
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
 // Character is the digital representation of a client
 type Character struct {
 	ID             string  `json:"id" redis:"-"`
@@ -1,6 +1,7 @@
 package models
 
 type Event struct {
+	ID   string `json:"id" redis:"-"`
 	Name string `json:"name" redis:"name"`
 	URL  string `json:"url" redis:"url"`
 
@@ -7,13 +7,15 @@ import (
 
 type Log struct {
 	CharacterID string `json:"characterId" redis:"characterId"`
+	Type        string `json:"type" redis:"type"`
 	Message     string `json:"message" redis:"message"`
 	Timestamp   int64  `json:"timestamp" redis:"timestamp"`
 }
 
-func NewLog(characterID, message string) *Log {
+func NewLog(characterID, packetType, message string) *Log {
 	return &Log{
 		CharacterID: characterID,
+		Type:        packetType,
 		Message:     message,
 		Timestamp:   time.Now().Unix(),
 	}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Sponsor queues are a list of character IDs in order, along with a hash of
+// each character's position in the list (starting from 1), so that we can
+// check whether someone is in the queue without reading the whole thing. Every
+// change to a queue goes through one of these scripts, so the list and the
+// positions always agree, even with several ingests changing them at once
+
+// Adds a hacker to the end of the queue if they aren't already in it. Returns
+// whether they were added, and their position
+var joinQueueScript = redis.NewScript(`
+local position = redis.call("HGET", KEYS[2], ARGV[1])
+
+if position then
+	return {0, tonumber(position)}
+end
+
+position = redis.call("RPUSH", KEYS[1], ARGV[1])
+redis.call("HSET", KEYS[2], ARGV[1], position)
+
+if #ARGV > 1 then
+	redis.call("HSET", KEYS[3], unpack(ARGV, 2))
+end
+
+return {1, position}
+`)
+
+// Takes a hacker out of the queue, and moves everyone behind them up one.
+// Returns the position they were at, or 0 if they weren't in the queue
+var leaveQueueScript = redis.NewScript(`
+local position = tonumber(redis.call("HGET", KEYS[2], ARGV[1]))
+
+if not position then
+	return 0
+end
+
+redis.call("LREM", KEYS[1], 1, ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+
+local behind = redis.call("LRANGE", KEYS[1], position - 1, -1)
+
+for i, id in ipairs(behind) do
+	redis.call("HSET", KEYS[2], id, position + i - 1)
+end
+
+return position
+`)
+
+// Takes the hacker at the front of the queue out of it, and returns their ID
+var popQueueScript = redis.NewScript(`
+local id = redis.call("LPOP", KEYS[1])
+
+if not id then
+	return false
+end
+
+redis.call("HDEL", KEYS[2], id)
+
+local rest = redis.call("LRANGE", KEYS[1], 0, -1)
+
+for i, other in ipairs(rest) do
+	redis.call("HSET", KEYS[2], other, i)
+end
+
+return id
+`)
+
+// Moves a hacker to a new position in the queue, as close as it can get to
+// the one asked for. Returns their new position, or 0 if they aren't in the
+// queue
+var moveQueueScript = redis.NewScript(`
+local from = tonumber(redis.call("HGET", KEYS[2], ARGV[1]))
+
+if not from then
+	return 0
+end
+
+local ids = redis.call("LRANGE", KEYS[1], 0, -1)
+local to = math.max(1, math.min(tonumber(ARGV[2]), #ids))
+
+if from == to then
+	return to
+end
+
+table.remove(ids, from)
+table.insert(ids, to, ARGV[1])
+
+redis.call("DEL", KEYS[1])
+redis.call("RPUSH", KEYS[1], unpack(ids))
+
+for i = math.min(from, to), math.max(from, to) do
+	redis.call("HSET", KEYS[2], ids[i], i)
+end
+
+return to
+`)
+
+// Returns the keys for a sponsor's queue and its positions
+func queueKeys(id string) []string {
+	return []string{"sponsor:" + id + ":hackerqueue", "sponsor:" + id + ":hackerqueue:positions"}
+}
+
+func (s redisSponsors) Join(id string, subscriber *models.QueueSubscriber) (int, bool, error) {
+	args := []interface{}{subscriber.ID}
+
+	for field, value := range utils.StructToMap(subscriber) {
+		args = append(args, field, value)
+	}
+
+	keys := append(queueKeys(id), "subscriber:"+subscriber.ID)
+	res, err := joinQueueScript.Run(s.client, keys, args...).Result()
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	vals := res.([]interface{})
+	return int(vals[1].(int64)), vals[0].(int64) == 1, nil
+}
+
+func (s redisSponsors) Position(id, characterID string) (int, error) {
+	position, err := s.client.HGet(queueKeys(id)[1], characterID).Int()
+
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return position, err
+}
+
+func (s redisSponsors) Remove(id, characterID string) (bool, error) {
+	position, err := leaveQueueScript.Run(s.client, queueKeys(id), characterID).Int()
+	return position > 0, err
+}
+
+func (s redisSponsors) Next(id string) (*models.QueueSubscriber, error) {
+	characterID, err := popQueueScript.Run(s.client, queueKeys(id)).Text()
+
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	res, err := s.client.HGetAll("subscriber:" + characterID).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber := &models.QueueSubscriber{ID: characterID}
+	utils.Bind(res, subscriber)
+	return subscriber, nil
+}
+
+func (s redisSponsors) Move(id, characterID string, position int) (int, error) {
+	return moveQueueScript.Run(s.client, queueKeys(id), characterID, position).Int()
+}
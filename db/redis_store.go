@@ -0,0 +1,1099 @@
+package db
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+)
+
+// The Redis store keeps everything in the layout described in database.md.
+// Nothing outside of this file should need to know what the keys look like
+
+// NewRedisStore returns a store backed by the given Redis client
+func NewRedisStore(client *redis.Client) *Store {
+	return &Store{
+		Characters: redisCharacters{client},
+		Friends:    redisFriends{client},
+		Rooms:      redisRooms{client},
+		Messages:   redisMessages{client},
+		Sponsors:   redisSponsors{client},
+		Songs:      redisSongs{client},
+		Events:     redisEvents{client},
+		Locations:  redisLocations{client},
+		Projects:   redisProjects{client},
+		Logins:     redisLogins{client},
+		Logs:       redisLogs{client},
+		Tokens:     redisTokens{client},
+	}
+}
+
+// Loads a batch of hashes in one round trip, and binds each one that exists
+// with the given function
+func getHashes(client *redis.Client, keys []string, bind func(i int, res map[string]string)) error {
+	pip := client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+
+	for i, key := range keys {
+		cmds[i] = pip.HGetAll(key)
+	}
+
+	if _, err := pip.Exec(); err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, cmd := range cmds {
+		if res, _ := cmd.Result(); len(res) > 0 {
+			bind(i, res)
+		}
+	}
+
+	return nil
+}
+
+// Turns redis.Nil into ErrNotFound
+func notFound(err error) error {
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+type redisCharacters struct {
+	client *redis.Client
+}
+
+func (s redisCharacters) Get(id string) (*models.Character, error) {
+	res, err := s.client.HGetAll("character:" + id).Result()
+
+	if err != nil {
+		return nil, err
+	} else if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	character := new(models.Character)
+	utils.Bind(res, character)
+	character.ID = id
+	return character, nil
+}
+
+func (s redisCharacters) GetMany(ids []string) ([]*models.Character, error) {
+	keys := make([]string, len(ids))
+
+	for i, id := range ids {
+		keys[i] = "character:" + id
+	}
+
+	characters := make([]*models.Character, 0, len(ids))
+
+	err := getHashes(s.client, keys, func(i int, res map[string]string) {
+		character := new(models.Character)
+		utils.Bind(res, character)
+		character.ID = ids[i]
+		characters = append(characters, character)
+	})
+
+	return characters, err
+}
+
+func (s redisCharacters) Create(character *models.Character) error {
+	return s.client.HSet("character:"+character.ID, utils.StructToMap(character)).Err()
+}
+
+func (s redisCharacters) Update(id string, fields map[string]interface{}) error {
+	return s.client.HSet("character:"+id, fields).Err()
+}
+
+func (s redisCharacters) Increment(id, field string) (int64, error) {
+	return s.client.HIncrBy("character:"+id, field, 1).Result()
+}
+
+func (s redisCharacters) SetPositions(positions map[string]Position) error {
+	pip := s.client.Pipeline()
+
+	for id, position := range positions {
+		pip.HSet("character:"+id, "x", position.X, "y", position.Y)
+	}
+
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisCharacters) IDForEmail(email string) (string, error) {
+	id, err := s.client.HGet("emailToCharacter", email).Result()
+	return id, notFound(err)
+}
+
+func (s redisCharacters) IDForIdentity(provider, subject string) (string, error) {
+	id, err := s.client.HGet(provider+"ToCharacter", subject).Result()
+	return id, notFound(err)
+}
+
+func (s redisCharacters) LinkEmail(email, id string) error {
+	return s.client.HSet("emailToCharacter", email, id).Err()
+}
+
+func (s redisCharacters) LinkIdentity(provider, subject, id string) error {
+	return s.client.HSet(provider+"ToCharacter", subject, id).Err()
+}
+
+func (s redisCharacters) Connect(id, ingestID string) error {
+	pip := s.client.Pipeline()
+	pip.SAdd("ingest:"+ingestID+":characters", id)
+	pip.HSet("character:"+id, "ingest", ingestID)
+	pip.Set("character:"+id+":active", "true", 0)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisCharacters) Disconnect(id, ingestID string) error {
+	pip := s.client.Pipeline()
+	pip.Del("character:" + id + ":active")
+	pip.HDel("character:"+id, "ingest")
+	pip.SRem("ingest:"+ingestID+":characters", id)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisCharacters) SetActive(id string, active bool) error {
+	return s.client.Set("character:"+id+":active", strconv.FormatBool(active), 0).Err()
+}
+
+func (s redisCharacters) Active(ids []string) ([]bool, error) {
+	pip := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+
+	for i, id := range ids {
+		cmds[i] = pip.Get("character:" + id + ":active")
+	}
+
+	if _, err := pip.Exec(); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	active := make([]bool, len(ids))
+
+	for i, cmd := range cmds {
+		res, _ := cmd.Result()
+		active[i] = res == "true"
+	}
+
+	return active, nil
+}
+
+func (s redisCharacters) Achievements(id string) (*models.Achievements, error) {
+	res, err := s.client.HGetAll("character:" + id + ":achievements").Result()
+	achievements := new(models.Achievements)
+	utils.Bind(res, achievements)
+	return achievements, err
+}
+
+func (s redisCharacters) SetAchievement(id, achievement string) error {
+	return s.client.HSet("character:"+id+":achievements", achievement, true).Err()
+}
+
+func (s redisCharacters) Settings(id string) (*models.Settings, error) {
+	res, err := s.client.HGetAll("character:" + id + ":settings").Result()
+	settings := new(models.Settings)
+	utils.Bind(res, settings)
+	return settings, err
+}
+
+func (s redisCharacters) UpdateSettings(id string, fields map[string]interface{}) error {
+	return s.client.HSet("character:"+id+":settings", fields).Err()
+}
+
+func (s redisCharacters) PhoneNumber(id string) (string, error) {
+	phoneNumber, err := s.client.HGet("character:"+id+":settings", "phoneNumber").Result()
+
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return phoneNumber, err
+}
+
+func (s redisCharacters) ProjectID(id string) (string, error) {
+	projectID, err := s.client.Get("character:" + id + ":project").Result()
+
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return projectID, err
+}
+
+func (s redisCharacters) SetProjectID(id, projectID string) error {
+	return s.client.Set("character:"+id+":project", projectID, 0).Err()
+}
+
+func (s redisCharacters) Capabilities(id string) (map[string]bool, error) {
+	res, err := s.client.HGetAll("character:" + id + ":capabilities").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := make(map[string]bool, len(res))
+
+	for capability, granted := range res {
+		capabilities[capability] = granted == "1"
+	}
+
+	return capabilities, nil
+}
+
+func (s redisCharacters) SetCapability(id, capability string, granted bool) error {
+	value := "0"
+
+	if granted {
+		value = "1"
+	}
+
+	return s.client.HSet("character:"+id+":capabilities", capability, value).Err()
+}
+
+func (s redisCharacters) ClearCapability(id, capability string) error {
+	return s.client.HDel("character:"+id+":capabilities", capability).Err()
+}
+
+type redisFriends struct {
+	client *redis.Client
+}
+
+func (s redisFriends) Friends(id string) ([]string, error) {
+	return s.client.SMembers("character:" + id + ":friends").Result()
+}
+
+func (s redisFriends) Teammates(id string) ([]string, error) {
+	return s.client.SMembers("character:" + id + ":teammates").Result()
+}
+
+func (s redisFriends) Requests(id string) ([]string, error) {
+	return s.client.SMembers("character:" + id + ":requests").Result()
+}
+
+func (s redisFriends) IsFriend(id, otherID string) (bool, error) {
+	return s.client.SIsMember("character:"+id+":friends", otherID).Result()
+}
+
+func (s redisFriends) IsTeammate(id, otherID string) (bool, error) {
+	return s.client.SIsMember("character:"+id+":teammates", otherID).Result()
+}
+
+func (s redisFriends) HasRequest(id, fromID string) (bool, error) {
+	return s.client.SIsMember("character:"+id+":requests", fromID).Result()
+}
+
+func (s redisFriends) AddRequest(id, fromID string) error {
+	return s.client.SAdd("character:"+id+":requests", fromID).Err()
+}
+
+func (s redisFriends) AcceptRequest(id, fromID string) (int64, int64, error) {
+	pip := s.client.Pipeline()
+	pip.SRem("character:"+id+":requests", fromID)
+	pip.SAdd("character:"+id+":friends", fromID)
+	pip.SAdd("character:"+fromID+":friends", id)
+	firstCmd := pip.SCard("character:" + id + ":friends")
+	secondCmd := pip.SCard("character:" + fromID + ":friends")
+
+	if _, err := pip.Exec(); err != nil {
+		return 0, 0, err
+	}
+
+	return firstCmd.Val(), secondCmd.Val(), nil
+}
+
+type redisRooms struct {
+	client *redis.Client
+}
+
+func (s redisRooms) List() ([]string, error) {
+	return s.client.SMembers("rooms").Result()
+}
+
+func (s redisRooms) Exists(id string) (bool, error) {
+	return s.client.SIsMember("rooms", id).Result()
+}
+
+func (s redisRooms) Get(id string) (*models.Room, error) {
+	res, err := s.client.HGetAll("room:" + id).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	room := new(models.Room).Init()
+	utils.Bind(res, room)
+	room.ID = id
+	return room, nil
+}
+
+func (s redisRooms) Create(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error {
+	pip := s.client.Pipeline()
+	createRoom(pip, room, elements, hallways)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisRooms) Replace(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error {
+	elementIDs, err := s.client.LRange("room:"+room.ID+":elements", 0, -1).Result()
+
+	if err != nil {
+		return err
+	}
+
+	hallwayIDs, err := s.client.SMembers("room:" + room.ID + ":hallways").Result()
+
+	if err != nil {
+		return err
+	}
+
+	// Everyone sees either the old room or the new one, never a mix
+	pip := s.client.TxPipeline()
+
+	for _, elementID := range elementIDs {
+		pip.Del("element:" + elementID)
+	}
+
+	for _, hallwayID := range hallwayIDs {
+		pip.Del("hallway:" + hallwayID)
+	}
+
+	pip.Del("room:"+room.ID, "room:"+room.ID+":elements", "room:"+room.ID+":hallways")
+	createRoom(pip, room, elements, hallways)
+	_, err = pip.Exec()
+	return err
+}
+
+// Queues up the commands to add a room with new elements and hallways
+func createRoom(pip redis.Pipeliner, room *models.Room, elements []*models.Element, hallways []*models.Hallway) {
+	pip.HSet("room:"+room.ID, utils.StructToMap(room))
+
+	for _, element := range elements {
+		elementID := uuid.New().String()
+		pip.HSet("element:"+elementID, utils.StructToMap(element))
+		pip.RPush("room:"+room.ID+":elements", elementID)
+	}
+
+	for _, hallway := range hallways {
+		hallwayID := uuid.New().String()
+		pip.HSet("hallway:"+hallwayID, utils.StructToMap(hallway))
+		pip.SAdd("room:"+room.ID+":hallways", hallwayID)
+	}
+
+	pip.SAdd("rooms", room.ID)
+}
+
+func (s redisRooms) Characters(id string) ([]string, error) {
+	return s.client.SMembers("room:" + id + ":characters").Result()
+}
+
+func (s redisRooms) AddCharacter(id, characterID string) error {
+	return s.client.SAdd("room:"+id+":characters", characterID).Err()
+}
+
+func (s redisRooms) RemoveCharacter(id, characterID string) error {
+	return s.client.SRem("room:"+id+":characters", characterID).Err()
+}
+
+func (s redisRooms) Elements(id string) ([]*models.Element, error) {
+	elementIDs, err := s.client.LRange("room:"+id+":elements", 0, -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(elementIDs))
+
+	for i, elementID := range elementIDs {
+		keys[i] = "element:" + elementID
+	}
+
+	elements := make([]*models.Element, 0, len(elementIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		element := new(models.Element)
+		utils.Bind(res, element)
+		element.ID = elementIDs[i]
+		elements = append(elements, element)
+	})
+
+	return elements, err
+}
+
+func (s redisRooms) Element(elementID string) (*models.Element, error) {
+	res, err := s.client.HGetAll("element:" + elementID).Result()
+
+	if err != nil {
+		return nil, err
+	} else if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	element := new(models.Element)
+	utils.Bind(res, element)
+	element.ID = elementID
+	return element, nil
+}
+
+func (s redisRooms) SaveElement(elementID string, element *models.Element) error {
+	return s.client.HSet("element:"+elementID, utils.StructToMap(element)).Err()
+}
+
+func (s redisRooms) SetElementState(elementID string, state int) error {
+	return s.client.HSet("element:"+elementID, "state", state).Err()
+}
+
+func (s redisRooms) Hallways(id string) (map[string]*models.Hallway, error) {
+	hallwayIDs, err := s.client.SMembers("room:" + id + ":hallways").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(hallwayIDs))
+
+	for i, hallwayID := range hallwayIDs {
+		keys[i] = "hallway:" + hallwayID
+	}
+
+	hallways := make(map[string]*models.Hallway, len(hallwayIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		hallways[hallwayIDs[i]] = new(models.Hallway)
+		utils.Bind(res, hallways[hallwayIDs[i]])
+	})
+
+	return hallways, err
+}
+
+func (s redisRooms) Hallway(hallwayID string) (*models.Hallway, error) {
+	res, err := s.client.HGetAll("hallway:" + hallwayID).Result()
+
+	if err != nil {
+		return nil, err
+	} else if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	hallway := new(models.Hallway)
+	utils.Bind(res, hallway)
+	return hallway, nil
+}
+
+func (s redisRooms) AddHallway(id, hallwayID string, hallway *models.Hallway) error {
+	pip := s.client.Pipeline()
+	pip.HSet("hallway:"+hallwayID, utils.StructToMap(hallway))
+	pip.SAdd("room:"+id+":hallways", hallwayID)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisRooms) SaveHallway(hallwayID string, hallway *models.Hallway) error {
+	return s.client.HSet("hallway:"+hallwayID, utils.StructToMap(hallway)).Err()
+}
+
+func (s redisRooms) DeleteHallway(id, hallwayID string) error {
+	pip := s.client.Pipeline()
+	pip.Del("hallway:" + hallwayID)
+	pip.SRem("room:"+id+":hallways", hallwayID)
+	_, err := pip.Exec()
+	return err
+}
+
+type redisMessages struct {
+	client *redis.Client
+}
+
+// Both characters in a conversation share a key. Ordering of the IDs comes
+// from a hash of each one
+func conversationKey(id, otherID string) string {
+	ha := fnv.New32a()
+	ha.Write([]byte(id))
+	idHash := ha.Sum32()
+
+	ha.Reset()
+	ha.Write([]byte(otherID))
+	otherHash := ha.Sum32()
+
+	if otherHash < idHash {
+		return "conversation:" + otherID + ":" + id
+	}
+
+	return "conversation:" + id + ":" + otherID
+}
+
+func (s redisMessages) Add(message *models.Message) error {
+	messageID := uuid.New().String()
+
+	pip := s.client.Pipeline()
+	pip.HSet("message:"+messageID, utils.StructToMap(message))
+	pip.RPush(conversationKey(message.From, message.To), messageID)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisMessages) Conversation(id, otherID string, limit int) ([]*models.Message, error) {
+	messageIDs, err := s.client.LRange(conversationKey(id, otherID), int64(-limit), -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(messageIDs))
+
+	for i, messageID := range messageIDs {
+		keys[i] = "message:" + messageID
+	}
+
+	messages := make([]*models.Message, 0, len(messageIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		message := new(models.Message)
+		utils.Bind(res, message)
+		messages = append(messages, message)
+	})
+
+	return messages, err
+}
+
+type redisSponsors struct {
+	client *redis.Client
+}
+
+func (s redisSponsors) List() ([]string, error) {
+	return s.client.SMembers("sponsors").Result()
+}
+
+func (s redisSponsors) Get(id string) (*models.Sponsor, error) {
+	res, err := s.client.HGetAll("sponsor:" + id).Result()
+
+	if err != nil {
+		return nil, err
+	} else if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	sponsor := new(models.Sponsor)
+	utils.Bind(res, sponsor)
+	sponsor.ID = id
+	return sponsor, nil
+}
+
+func (s redisSponsors) Create(sponsor *models.Sponsor) error {
+	pip := s.client.Pipeline()
+	pip.HSet("sponsor:"+sponsor.ID, utils.StructToMap(sponsor))
+	pip.SAdd("sponsors", sponsor.ID)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisSponsors) Update(id string, fields map[string]interface{}) error {
+	return s.client.HSet("sponsor:"+id, fields).Err()
+}
+
+func (s redisSponsors) Queue(id string) ([]*models.QueueSubscriber, error) {
+	hackerIDs, err := s.client.LRange("sponsor:"+id+":hackerqueue", 0, -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(hackerIDs))
+
+	for i, hackerID := range hackerIDs {
+		keys[i] = "subscriber:" + hackerID
+	}
+
+	subscribers := make([]*models.QueueSubscriber, len(hackerIDs))
+
+	for i, hackerID := range hackerIDs {
+		subscribers[i] = &models.QueueSubscriber{ID: hackerID}
+	}
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		utils.Bind(res, subscribers[i])
+	})
+
+	return subscribers, err
+}
+
+func (s redisSponsors) Watchers(id string) ([]string, error) {
+	return s.client.SMembers("sponsor:" + id + ":subscribed").Result()
+}
+
+func (s redisSponsors) Watch(id, characterID string) error {
+	return s.client.SAdd("sponsor:"+id+":subscribed", characterID).Err()
+}
+
+func (s redisSponsors) Unwatch(id, characterID string) error {
+	return s.client.SRem("sponsor:"+id+":subscribed", characterID).Err()
+}
+
+type redisSongs struct {
+	client *redis.Client
+}
+
+func (s redisSongs) Queue() ([]*models.Song, error) {
+	songIDs, err := s.client.LRange("songs", 0, -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(songIDs))
+
+	for i, songID := range songIDs {
+		keys[i] = "song:" + songID
+	}
+
+	songs := make([]*models.Song, 0, len(songIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		song := new(models.Song)
+		utils.Bind(res, song)
+		song.ID = songIDs[i]
+		songs = append(songs, song)
+	})
+
+	return songs, err
+}
+
+func (s redisSongs) Add(song *models.Song) error {
+	pip := s.client.Pipeline()
+	pip.HSet("song:"+song.ID, utils.StructToMap(song))
+	pip.RPush("songs", song.ID)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisSongs) Remove(id string) error {
+	pip := s.client.Pipeline()
+	pip.Del("song:" + id)
+	pip.LRem("songs", 1, id)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisSongs) Next() (*models.Song, error) {
+	songID, err := s.client.LPop("songs").Result()
+
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	song := new(models.Song)
+	res, err := s.client.HGetAll("song:" + songID).Result()
+	utils.Bind(res, song)
+	song.ID = songID
+	return song, err
+}
+
+func (s redisSongs) Current() (*models.Song, time.Time, error) {
+	pip := s.client.Pipeline()
+	songIDCmd := pip.Get("currentsong")
+	queueStatusCmd := pip.Get("queuestatus")
+
+	if _, err := pip.Exec(); err != nil && err != redis.Nil {
+		return nil, time.Time{}, err
+	}
+
+	queueStatus, _ := strconv.ParseInt(queueStatusCmd.Val(), 10, 64)
+	song := new(models.Song)
+	song.ID = songIDCmd.Val()
+
+	res, err := s.client.HGetAll("song:" + song.ID).Result()
+	utils.Bind(res, song)
+	return song, time.Unix(queueStatus, 0), err
+}
+
+func (s redisSongs) SetCurrent(id string, endsAt time.Time) error {
+	pip := s.client.Pipeline()
+	pip.Set("currentsong", id, 0)
+	pip.Set("queuestatus", endsAt.Unix(), 0)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisSongs) Cooldown(characterID string) (time.Time, bool, error) {
+	res, err := s.client.Get("character:" + characterID + ":jukeboxTimestamp").Result()
+
+	if err == redis.Nil {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		return time.Time{}, false, err
+	}
+
+	until, _ := time.Parse(time.RFC3339, res)
+	return until, true, nil
+}
+
+func (s redisSongs) SetCooldown(characterID string, until time.Time) error {
+	return s.client.Set("character:"+characterID+":jukeboxTimestamp", until.Format(time.RFC3339), 0).Err()
+}
+
+type redisEvents struct {
+	client *redis.Client
+}
+
+func (s redisEvents) List() ([]*models.Event, error) {
+	eventIDs, err := s.client.SMembers("events").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(eventIDs))
+
+	for i, eventID := range eventIDs {
+		keys[i] = "event:" + eventID
+	}
+
+	events := make([]*models.Event, 0, len(eventIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		event := new(models.Event)
+		utils.Bind(res, event)
+		event.ID = eventIDs[i]
+		events = append(events, event)
+	})
+
+	return events, err
+}
+
+func (s redisEvents) Get(id string) (*models.Event, error) {
+	pip := s.client.Pipeline()
+	validCmd := pip.SIsMember("events", id)
+	eventCmd := pip.HGetAll("event:" + id)
+
+	if _, err := pip.Exec(); err != nil {
+		return nil, err
+	} else if !validCmd.Val() {
+		return nil, ErrNotFound
+	}
+
+	event := new(models.Event)
+	utils.Bind(eventCmd.Val(), event)
+	event.ID = id
+	return event, nil
+}
+
+func (s redisEvents) Create(id string, event *models.Event) error {
+	pip := s.client.Pipeline()
+	pip.HSet("event:"+id, utils.StructToMap(event))
+	pip.SAdd("events", id)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisEvents) Delete(id string) error {
+	pip := s.client.Pipeline()
+	pip.Del("event:" + id)
+	pip.SRem("events", id)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisEvents) Attend(id, characterID string) error {
+	pip := s.client.Pipeline()
+	pip.SAdd("event:"+id+":attendees", characterID)
+	pip.SAdd("character:"+characterID+":events", id)
+	_, err := pip.Exec()
+	return err
+}
+
+type redisLocations struct {
+	client *redis.Client
+}
+
+func (s redisLocations) List() ([]*models.Location, error) {
+	locationIDs, err := s.client.SMembers("locations").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(locationIDs))
+
+	for i, locationID := range locationIDs {
+		keys[i] = "location:" + locationID
+	}
+
+	locations := make([]*models.Location, 0, len(locationIDs))
+
+	err = getHashes(s.client, keys, func(i int, res map[string]string) {
+		location := new(models.Location)
+		utils.Bind(res, location)
+		locations = append(locations, location)
+	})
+
+	return locations, err
+}
+
+func (s redisLocations) Save(characterID string, location *models.Location) error {
+	pip := s.client.Pipeline()
+	pip.HSet("location:"+characterID, utils.StructToMap(location))
+	pip.SAdd("locations", characterID)
+	_, err := pip.Exec()
+	return err
+}
+
+type redisProjects struct {
+	client *redis.Client
+}
+
+func (s redisProjects) Get(id string) (*models.Project, error) {
+	res, err := s.client.HGetAll("project:" + id).Result()
+
+	if err != nil {
+		return nil, err
+	} else if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	project := new(models.Project)
+	utils.Bind(res, project)
+	return project, nil
+}
+
+func (s redisProjects) Save(id string, project *models.Project) error {
+	return s.client.HSet("project:"+id, utils.StructToMap(project)).Err()
+}
+
+type redisLogins struct {
+	client *redis.Client
+}
+
+// Sets of emails that can log in with each role
+var loginEmailKeys = map[models.Role]string{
+	models.SponsorRep: "sponsor_emails",
+	models.Mentor:     "mentor_emails",
+	models.Organizer:  "organizer_emails",
+}
+
+func (s redisLogins) HasEmail(role models.Role, email string) (bool, error) {
+	key, ok := loginEmailKeys[role]
+
+	if !ok {
+		return false, nil
+	}
+
+	return s.client.SIsMember(key, email).Result()
+}
+
+func (s redisLogins) AddEmail(role models.Role, email, sponsorID string) error {
+	key, ok := loginEmailKeys[role]
+
+	if !ok {
+		return nil
+	}
+
+	pip := s.client.Pipeline()
+
+	if role == models.SponsorRep {
+		pip.HSet("emailToSponsor", email, sponsorID)
+	}
+
+	pip.SAdd(key, email)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisLogins) SponsorForEmail(email string) (string, error) {
+	sponsorID, err := s.client.HGet("emailToSponsor", email).Result()
+
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return sponsorID, err
+}
+
+// Uses up a login code if it's right, and counts the guess against it if it
+// isn't. Returns 1 for the right code
+var checkCodeScript = redis.NewScript(`
+local code = redis.call("HGET", KEYS[1], "code")
+
+if not code then
+	return 0
+end
+
+if code == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+
+if redis.call("HINCRBY", KEYS[1], "attempts", 1) >= tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// Counts a request, starting a new window with the first one
+var countRequestScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+return count
+`)
+
+func (s redisLogins) AddCode(email string, code int, ttl time.Duration) error {
+	key := "login_code:" + email
+
+	pip := s.client.TxPipeline()
+	pip.Del(key)
+	pip.HSet(key, "code", strconv.Itoa(code), "attempts", 0)
+	pip.PExpire(key, ttl)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisLogins) CheckCode(email string, code int, maxAttempts int) (bool, error) {
+	valid, err := checkCodeScript.Run(s.client, []string{"login_code:" + email}, strconv.Itoa(code), maxAttempts).Int()
+	return valid == 1, err
+}
+
+func (s redisLogins) CountCodeRequest(email string, window time.Duration) (int, error) {
+	return countRequestScript.Run(s.client, []string{"login_code:" + email + ":requests"}, window.Milliseconds()).Int()
+}
+
+type redisLogs struct {
+	client *redis.Client
+}
+
+func (s redisLogs) Add(log *models.Log) error {
+	logID := uuid.New().String()
+
+	pip := s.client.Pipeline()
+	pip.HSet("log:"+logID, utils.StructToMap(log))
+	pip.RPush("logs", logID)
+	_, err := pip.Exec()
+	return err
+}
+
+func (s redisLogs) Query(filter LogFilter) ([]*models.Log, error) {
+	var logs []*models.Log
+
+	// Page through them a batch at a time, so that one query can't hold Redis
+	// up. Logs are pushed in order, so we can stop once we're past the filter
+	for start := int64(0); ; start += logRotationBatchSize {
+		logIDs, err := s.client.LRange("logs", start, start+logRotationBatchSize-1).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, len(logIDs))
+
+		for i, logID := range logIDs {
+			keys[i] = "log:" + logID
+		}
+
+		done := len(logIDs) < logRotationBatchSize
+
+		err = getHashes(s.client, keys, func(i int, res map[string]string) {
+			entry := new(models.Log)
+			utils.Bind(res, entry)
+
+			if !filter.Until.IsZero() && entry.Timestamp > filter.Until.Unix() {
+				done = true
+			} else if filter.Matches(entry) {
+				logs = append(logs, entry)
+			}
+		})
+
+		if err != nil {
+			return nil, err
+		} else if filter.Limit > 0 && len(logs) >= filter.Limit {
+			return logs[:filter.Limit], nil
+		} else if done {
+			return logs, nil
+		}
+	}
+}
+
+func (s redisLogs) DeleteBefore(before time.Time) error {
+	for {
+		logIDs, err := s.client.LRange("logs", 0, logRotationBatchSize-1).Result()
+
+		if err != nil || len(logIDs) == 0 {
+			return err
+		}
+
+		keys := make([]string, len(logIDs))
+
+		for i, logID := range logIDs {
+			keys[i] = "log:" + logID
+		}
+
+		expired := len(logIDs)
+
+		// Logs are pushed in order, so stop at the first one that's recent enough
+		err = getHashes(s.client, keys, func(i int, res map[string]string) {
+			entry := new(models.Log)
+			utils.Bind(res, entry)
+
+			if i < expired && entry.Timestamp >= before.Unix() {
+				expired = i
+			}
+		})
+
+		if err != nil || expired == 0 {
+			return err
+		}
+
+		pip := s.client.TxPipeline()
+		pip.LTrim("logs", int64(expired), -1)
+		pip.Del(keys[:expired]...)
+
+		if _, err := pip.Exec(); err != nil || expired < len(logIDs) {
+			return err
+		}
+	}
+}
+
+type redisTokens struct {
+	client *redis.Client
+}
+
+func (s redisTokens) Revoke(tokenID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+
+	if ttl <= 0 {
+		// Already unusable
+		return true, nil
+	}
+
+	return s.client.SetNX("token:"+tokenID+":revoked", "true", ttl).Result()
+}
+
+func (s redisTokens) IsRevoked(tokenID string) (bool, error) {
+	revoked, err := s.client.Exists("token:" + tokenID + ":revoked").Result()
+	return revoked == 1, err
+}
+
+func (s redisTokens) RevokeAll(characterID string) error {
+	return s.client.Incr("character:" + characterID + ":token_generation").Err()
+}
+
+func (s redisTokens) Generation(characterID string) (int, error) {
+	generation, err := s.client.Get("character:" + characterID + ":token_generation").Int()
+
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return generation, err
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/utils"
+)
+
+// Reseed rebuilds part of the world from the config files, comparing it against
+// what's already there. Only rooms, events, and sponsor details from the config
+// files change, so characters, friends, messages, projects, and queues are
+// left alone. parts is a comma separated list of "events", "sponsors", "rooms",
+// or "room:<room_id>" for a single room
+func Reseed(parts string) error {
+	var roomIDs []string
+	allRooms := false
+
+	for _, part := range strings.Split(parts, ",") {
+		part = strings.TrimSpace(part)
+
+		switch {
+		case part == "events":
+			if err := reseedEvents(); err != nil {
+				return err
+			}
+		case part == "sponsors":
+			if err := reseedSponsors(); err != nil {
+				return err
+			}
+		case part == "rooms":
+			allRooms = true
+		case strings.HasPrefix(part, "room:"):
+			roomIDs = append(roomIDs, strings.TrimPrefix(part, "room:"))
+		default:
+			return errors.New("unknown part of the world to reseed: " + part)
+		}
+	}
+
+	if allRooms || len(roomIDs) > 0 {
+		return reseedRooms(allRooms, roomIDs)
+	}
+
+	return nil
+}
+
+// Matches events from the config file up with saved events by name, so that
+// events keep their IDs (and attendees) when their details change
+func reseedEvents() error {
+	events, err := loadEvents()
+
+	if err != nil {
+		return err
+	}
+
+	saved, err := store.Events.List()
+
+	if err != nil {
+		return err
+	}
+
+	savedByName := map[string][]*models.Event{}
+
+	for _, event := range saved {
+		savedByName[event.Name] = append(savedByName[event.Name], event)
+	}
+
+	added, updated, unchanged := 0, 0, 0
+
+	for _, event := range events {
+		if matches := savedByName[event.Name]; len(matches) > 0 {
+			savedByName[event.Name] = matches[1:]
+			event.ID = matches[0].ID
+
+			if *event == *matches[0] {
+				unchanged++
+				continue
+			}
+
+			updated++
+		} else {
+			event.ID = newEventID()
+			added++
+		}
+
+		if err := store.Events.Create(event.ID, event); err != nil {
+			return err
+		}
+	}
+
+	// Anything left over isn't on the schedule anymore
+	removed := 0
+
+	for _, matches := range savedByName {
+		for _, event := range matches {
+			if err := store.Events.Delete(event.ID); err != nil {
+				return err
+			}
+
+			removed++
+		}
+	}
+
+	log.Println("Reseeded events:", added, "added,", updated, "updated,", removed, "removed,", unchanged, "unchanged")
+	return nil
+}
+
+// Only sets the fields that each sponsor has in the config file, since reps can
+// change the rest themselves
+func reseedSponsors() error {
+	sponsorsData, err := loadSponsors()
+
+	if err != nil {
+		return err
+	}
+
+	added, updated, unchanged := 0, 0, 0
+	configured := map[string]bool{}
+
+	for _, sponsorData := range sponsorsData {
+		var sponsor models.Sponsor
+		fromTemplate(sponsorData, &sponsor)
+		configured[sponsor.ID] = true
+
+		saved, err := store.Sponsors.Get(sponsor.ID)
+
+		if err == ErrNotFound {
+			if err := store.Sponsors.Create(&sponsor); err != nil {
+				return err
+			}
+
+			added++
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		savedFields := utils.StructToMap(saved)
+		fields := map[string]interface{}{}
+
+		for field, value := range utils.StructToMap(&sponsor) {
+			if _, ok := sponsorData[field]; ok && fmt.Sprint(value) != fmt.Sprint(savedFields[field]) {
+				fields[field] = value
+			}
+		}
+
+		if len(fields) == 0 {
+			unchanged++
+			continue
+		}
+
+		if err := store.Sponsors.Update(sponsor.ID, fields); err != nil {
+			return err
+		}
+
+		updated++
+	}
+
+	sponsorIDs, err := store.Sponsors.List()
+
+	if err != nil {
+		return err
+	}
+
+	for _, sponsorID := range sponsorIDs {
+		if !configured[sponsorID] {
+			// Sponsors have queues and reps attached to them, so removing one
+			// is up to an organizer
+			log.Println("WARNING: Sponsor", sponsorID, "isn't in config/sponsors.json anymore, leaving it alone")
+		}
+	}
+
+	log.Println("Reseeded sponsors:", added, "added,", updated, "updated,", unchanged, "unchanged")
+	return nil
+}
+
+// Rebuilds rooms from their templates, replacing only the ones that don't match
+func reseedRooms(all bool, roomIDs []string) error {
+	rooms := worldRooms()
+	known := map[string]bool{}
+
+	for _, worldRoom := range rooms {
+		known[worldRoom.id] = true
+	}
+
+	wanted := map[string]bool{}
+
+	for _, roomID := range roomIDs {
+		if !known[roomID] {
+			return errors.New("no room in the world is called " + roomID)
+		}
+
+		wanted[roomID] = true
+	}
+
+	replaced, unchanged := 0, 0
+
+	for _, worldRoom := range rooms {
+		if !all && !wanted[worldRoom.id] {
+			continue
+		}
+
+		room, elements, hallways, err := buildRoom(worldRoom.id, worldRoom.roomType, worldRoom.data)
+
+		if err != nil {
+			return err
+		}
+
+		same, err := roomMatches(room, elements, hallways)
+
+		if err != nil {
+			return err
+		} else if same {
+			unchanged++
+			continue
+		}
+
+		if err := store.Rooms.Replace(room, elements, hallways); err != nil {
+			return err
+		}
+
+		log.Println("Reseeded room", room.ID)
+		replaced++
+	}
+
+	log.Println("Reseeded rooms:", replaced, "replaced,", unchanged, "unchanged")
+	return nil
+}
+
+// Returns true if the saved room already looks exactly like this one
+func roomMatches(room *models.Room, elements []*models.Element, hallways []*models.Hallway) (bool, error) {
+	exists, err := store.Rooms.Exists(room.ID)
+
+	if err != nil || !exists {
+		return false, err
+	}
+
+	saved, err := snapshotRoom(room.ID)
+
+	if err != nil {
+		return false, err
+	}
+
+	savedJSON, _ := json.Marshal(saved)
+	builtJSON, _ := json.Marshal(newRoomSnapshot(room, elements, hallways))
+	return string(savedJSON) == string(builtJSON), nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/techx/playground/db/models"
+)
+
+// Returns saved events keyed by name
+func eventsByName(t *testing.T) map[string]*models.Event {
+	events, err := store.Events.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]*models.Event{}
+
+	for _, event := range events {
+		byName[event.Name] = event
+	}
+
+	return byName
+}
+
+func TestReseed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		useStore(t, s)
+		seed()
+
+		configEvents, err := loadEvents()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Drift away from the config files in every way reseeding should fix
+		opening := eventsByName(t)["Opening Ceremony"]
+		changed := *opening
+		changed.URL = "https://example.com"
+		store.Events.Create(opening.ID, &changed)
+		store.Events.Delete(eventsByName(t)["Team Formation"].ID)
+		store.Events.Create("old", &models.Event{Name: "Old Event"})
+
+		store.Sponsors.Update("ieee", map[string]interface{}{
+			"name":        "Changed",
+			"description": "Set by a rep",
+		})
+
+		store.Rooms.Replace(&models.Room{ID: "home", Background: "changed.png"}, nil, nil)
+		store.Rooms.AddCharacter("home", "someone")
+
+		if err := Reseed("events, sponsors, rooms"); err != nil {
+			t.Fatal(err)
+		}
+
+		events := eventsByName(t)
+
+		if len(events) != len(configEvents) {
+			t.Errorf("expected %d events, got %d", len(configEvents), len(events))
+		}
+
+		if _, ok := events["Old Event"]; ok {
+			t.Error("expected events that aren't in the config file to be removed")
+		}
+
+		if _, ok := events["Team Formation"]; !ok {
+			t.Error("expected missing events to be added back")
+		}
+
+		// Events that changed keep their IDs
+		if event := events["Opening Ceremony"]; event.ID != opening.ID || event.URL != opening.URL {
+			t.Errorf("expected %+v, got %+v", opening, event)
+		}
+
+		// Only fields from the config file change
+		sponsor, _ := store.Sponsors.Get("ieee")
+
+		if sponsor.Name != "IEEE" || sponsor.Description != "Set by a rep" {
+			t.Errorf("expected the name to be reset and the description kept, got %+v", sponsor)
+		}
+
+		// Rooms match their templates again, and keep the characters in them
+		for _, worldRoom := range worldRooms() {
+			room, elements, hallways, _ := buildRoom(worldRoom.id, worldRoom.roomType, worldRoom.data)
+
+			if same, err := roomMatches(room, elements, hallways); err != nil || !same {
+				t.Errorf("%s: expected the room to match its template (%v)", worldRoom.id, err)
+			}
+		}
+
+		if characters, _ := store.Rooms.Characters("home"); !equalStrings(characters, []string{"someone"}) {
+			t.Errorf("expected someone to stay in home, got %v", characters)
+		}
+	})
+}
+
+func TestReseedParts(t *testing.T) {
+	tests := []struct {
+		parts    string
+		ok       bool
+		reseeded []string
+	}{
+		{"room:home", true, []string{"home"}},
+		{"room:home,room:plaza", true, []string{"home", "plaza"}},
+		{"rooms", true, []string{"home", "plaza"}},
+		{"events", true, nil},
+		{"room:nowhere", false, nil},
+		{"everything", false, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.parts, func(t *testing.T) {
+			useStore(t, NewMemoryStore())
+			seed()
+
+			for _, roomID := range []string{"home", "plaza"} {
+				store.Rooms.Replace(&models.Room{ID: roomID, Background: "changed.png"}, nil, nil)
+			}
+
+			if err := Reseed(test.parts); (err == nil) != test.ok {
+				t.Fatalf("expected ok to be %v, got %v", test.ok, err)
+			}
+
+			var reseeded []string
+
+			for _, roomID := range []string{"home", "plaza"} {
+				if room, _ := store.Rooms.Get(roomID); room.Background != "changed.png" {
+					reseeded = append(reseeded, roomID)
+				}
+			}
+
+			if !equalStrings(reseeded, test.reseeded) {
+				t.Errorf("expected %v to be reseeded, got %v", test.reseeded, reseeded)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package db
 import (
 	"encoding/json"
 	"io/ioutil"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
 )
 
 // RoomType is an enum representing all possible room templates
@@ -66,14 +68,29 @@ const (
 	Auditorium = "auditorium"
 )
 
-// CreateRoom builds a room with the given ID from a template file
+// Builds a room with the given ID from a template file
 func createRoomWithData(id string, roomType RoomType, data map[string]interface{}) {
-	dat, err := ioutil.ReadFile("config/rooms/" + string(roomType) + ".json")
+	room, elements, hallways, err := buildRoom(id, roomType, data)
 
 	if err != nil {
 		return
 	}
 
+	store.Rooms.Create(room, elements, hallways)
+}
+
+// Fills in a room template, without saving anything
+func buildRoom(id string, roomType RoomType, data map[string]interface{}) (*models.Room, []*models.Element, []*models.Hallway, error) {
+	dat, err := ioutil.ReadFile("config/rooms/" + string(roomType) + ".json")
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
 	var roomData map[string]interface{}
 	json.Unmarshal(dat, &roomData)
 	data["background"] = roomData["background"]
@@ -90,8 +107,6 @@ func createRoomWithData(id string, roomType RoomType, data map[string]interface{
 		}
 	}
 
-	instance.HSet("room:"+id, data)
-
 	elements := roomData["elements"].([]interface{})
 
 	// If this is the nightclub, add floor tiles
@@ -117,8 +132,9 @@ func createRoomWithData(id string, roomType RoomType, data map[string]interface{
 		elements = append(newTiles, elements...)
 	}
 
+	roomElements := make([]*models.Element, 0, len(elements))
+
 	for _, val := range elements {
-		elementID := uuid.New().String()
 		elementData := val.(map[string]interface{})
 
 		if _, ok := elementData["tile"]; ok {
@@ -172,10 +188,13 @@ func createRoomWithData(id string, roomType RoomType, data map[string]interface{
 			elementData["path"] = strings.ReplaceAll(elementData["path"].(string), "<id>", id)
 		}
 
-		instance.HSet("element:"+elementID, elementData)
-		instance.RPush("room:"+id+":elements", elementID)
+		element := new(models.Element)
+		fromTemplate(elementData, element)
+		roomElements = append(roomElements, element)
 	}
 
+	var hallways []*models.Hallway
+
 	for _, val := range roomData["hallways"].([]interface{}) {
 		hallwayData := val.(map[string]interface{})
 
@@ -188,31 +207,49 @@ func createRoomWithData(id string, roomType RoomType, data map[string]interface{
 			}
 		}
 
-		hallwayID := uuid.New().String()
-		instance.HSet("hallway:"+hallwayID, val)
-		instance.SAdd("room:"+id+":hallways", hallwayID)
+		hallway := new(models.Hallway)
+		fromTemplate(hallwayData, hallway)
+		hallways = append(hallways, hallway)
 	}
 
-	instance.SAdd("rooms", id)
+	room := new(models.Room)
+	fromTemplate(data, room)
+	room.ID = id
+	return room, roomElements, hallways, nil
+}
+
+// Fills in a model from template data, which uses the same field names as the
+// model's JSON
+func fromTemplate(data interface{}, model interface{}) {
+	dat, _ := json.Marshal(data)
+	json.Unmarshal(dat, model)
 }
 
 func createSponsors() {
-	dat, err := ioutil.ReadFile("config/sponsors.json")
+	sponsorsData, err := loadSponsors()
 
 	if err != nil {
 		return
 	}
 
-	var sponsorsData []map[string]interface{}
-	json.Unmarshal(dat, &sponsorsData)
-
 	for _, sponsor := range sponsorsData {
-		sponsorID := sponsor["id"].(string)
-		delete(sponsor, "id")
+		var sponsorModel models.Sponsor
+		fromTemplate(sponsor, &sponsorModel)
+		store.Sponsors.Create(&sponsorModel)
+	}
+}
+
+// Reads config/sponsors.json, keeping only the fields each sponsor sets
+func loadSponsors() ([]map[string]interface{}, error) {
+	dat, err := ioutil.ReadFile("config/sponsors.json")
 
-		instance.HSet("sponsor:"+sponsorID, sponsor)
-		instance.SAdd("sponsors", sponsorID)
+	if err != nil {
+		return nil, err
 	}
+
+	var sponsorsData []map[string]interface{}
+	err = json.Unmarshal(dat, &sponsorsData)
+	return sponsorsData, err
 }
 
 func CreateRoom(id string, roomType RoomType) {
@@ -220,123 +257,160 @@ func CreateRoom(id string, roomType RoomType) {
 }
 
 func createEvents() {
-	dat, err := ioutil.ReadFile("config/events.json")
+	events, err := loadEvents()
 
 	if err != nil {
+		log.Println("ERROR: Unable to load events ->", err)
 		return
 	}
 
+	for _, event := range events {
+		store.Events.Create(newEventID(), event)
+	}
+}
+
+// Reads config/events.json
+func loadEvents() ([]*models.Event, error) {
+	dat, err := ioutil.ReadFile("config/events.json")
+
+	if err != nil {
+		return nil, err
+	}
+
 	var eventsData []map[string]interface{}
-	json.Unmarshal(dat, &eventsData)
 
-	for _, event := range eventsData {
+	if err := json.Unmarshal(dat, &eventsData); err != nil {
+		return nil, err
+	}
+
+	events := make([]*models.Event, len(eventsData))
+
+	for i, event := range eventsData {
 		startTime, err := time.Parse("2006-01-02T15:04:05-0700", event["start_time"].(string))
 
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
 		event["startTime"] = int(startTime.Unix())
 
-		eventID := uuid.New().String()[:4]
-		instance.HSet("event:"+eventID, event)
-		instance.SAdd("events", eventID)
+		events[i] = new(models.Event)
+		fromTemplate(event, events[i])
 	}
+
+	return events, nil
+}
+
+func newEventID() string {
+	return uuid.New().String()[:4]
 }
 
+// Clears out Redis and fills it back in with the world from the config files
 func reset() {
 	instance.FlushDB()
-	CreateRoom("home", Home)
-	CreateRoom("nightclub", Nightclub)
-	CreateRoom("nonprofits", Nonprofits)
-	CreateRoom("plat_area", PlatArea)
-	CreateRoom("left_field", LeftField)
-	CreateRoom("right_field", RightField)
-	CreateRoom("plaza", Plaza)
-	CreateRoom("coffee_shop", CoffeeShop)
-	CreateRoom("mall", Mall)
-	CreateRoom("auditorium", Auditorium)
-
-	createRoomWithData("arena:connectivity", Arena, map[string]interface{}{
-		"id": "connectivity",
-	})
-
-	createRoomWithData("arena:education", Arena, map[string]interface{}{
-		"id": "education",
-	})
-
-	createRoomWithData("arena:health", Arena, map[string]interface{}{
-		"id": "health",
-	})
-
-	createRoomWithData("arena:urban", Arena, map[string]interface{}{
-		"id": "urban",
-	})
-
-	createRoomWithData("sponsor:beaverworks", Gold, map[string]interface{}{
-		"id":  "beaverworks",
-		"to": "left_field",
-		"toX": 0.3042,
-		"toY": 0.6834,
-	})
-
-	createRoomWithData("sponsor:ieee", Gold, map[string]interface{}{
-		"id":  "ieee",
-		"to": "left_field",
-		"toX": 0.1137,
-		"toY": 0.4796,
-	})
-
-	createRoomWithData("sponsor:kodewithklossy", Gold, map[string]interface{}{
-		"id":  "kodewithklossy",
-		"to":  "left_field",
-		"toX": 0.6958,
-		"toY": 0.6834,
-	})
-
-	createRoomWithData("sponsor:ktbyte", Gold, map[string]interface{}{
-		"id":  "ktbyte",
-		"to":  "left_field",
-		"toX": 0.8969,
-		"toY": 0.4657,
-	})
-
-	createRoomWithData("sponsor:leah", Gold, map[string]interface{}{
-		"id":  "leah",
-		"to":  "right_field",
-		"toX": 0.1,
-		"toY": 0.4598,
-	})
-
-	createRoomWithData("sponsor:lsa", Gold, map[string]interface{}{
-		"id":  "lsa",
-		"to":  "right_field",
-		"toX": 0.3108,
-		"toY": 0.6903,
-	})
-
-	createRoomWithData("sponsor:medscience", Gold, map[string]interface{}{
-		"id":  "medscience",
-		"to":  "right_field",
-		"toX": 0.7037,
-		"toY": 0.6647,
-	})
-
-	createRoomWithData("sponsor:lincoln", Gold, map[string]interface{}{
-		"id":  "lincoln",
-		"to":  "right_field",
-		"toX": 0.9152,
-		"toY": 0.4563,
-	})
-
-	createRoomWithData("sponsor:misti", MISTI, map[string]interface{}{
-		"id": "misti",
-	})
+	seed()
+
+	// Everything was just created in the newest layout
+	setLatestSchemaVersion()
+}
+
+// A room that's part of the world, and the template it's built from
+type worldRoom struct {
+	id       string
+	roomType RoomType
+	data     map[string]interface{}
+}
+
+// Returns every room in the world besides personal rooms. Building a room
+// fills in its data, so this makes new maps every time
+func worldRooms() []worldRoom {
+	return []worldRoom{
+		{"home", Home, nil},
+		{"nightclub", Nightclub, nil},
+		{"nonprofits", Nonprofits, nil},
+		{"plat_area", PlatArea, nil},
+		{"left_field", LeftField, nil},
+		{"right_field", RightField, nil},
+		{"plaza", Plaza, nil},
+		{"coffee_shop", CoffeeShop, nil},
+		{"mall", Mall, nil},
+		{"auditorium", Auditorium, nil},
+		{"arena:connectivity", Arena, map[string]interface{}{
+			"id": "connectivity",
+		}},
+		{"arena:education", Arena, map[string]interface{}{
+			"id": "education",
+		}},
+		{"arena:health", Arena, map[string]interface{}{
+			"id": "health",
+		}},
+		{"arena:urban", Arena, map[string]interface{}{
+			"id": "urban",
+		}},
+		{"sponsor:beaverworks", Gold, map[string]interface{}{
+			"id":  "beaverworks",
+			"to":  "left_field",
+			"toX": 0.3042,
+			"toY": 0.6834,
+		}},
+		{"sponsor:ieee", Gold, map[string]interface{}{
+			"id":  "ieee",
+			"to":  "left_field",
+			"toX": 0.1137,
+			"toY": 0.4796,
+		}},
+		{"sponsor:kodewithklossy", Gold, map[string]interface{}{
+			"id":  "kodewithklossy",
+			"to":  "left_field",
+			"toX": 0.6958,
+			"toY": 0.6834,
+		}},
+		{"sponsor:ktbyte", Gold, map[string]interface{}{
+			"id":  "ktbyte",
+			"to":  "left_field",
+			"toX": 0.8969,
+			"toY": 0.4657,
+		}},
+		{"sponsor:leah", Gold, map[string]interface{}{
+			"id":  "leah",
+			"to":  "right_field",
+			"toX": 0.1,
+			"toY": 0.4598,
+		}},
+		{"sponsor:lsa", Gold, map[string]interface{}{
+			"id":  "lsa",
+			"to":  "right_field",
+			"toX": 0.3108,
+			"toY": 0.6903,
+		}},
+		{"sponsor:medscience", Gold, map[string]interface{}{
+			"id":  "medscience",
+			"to":  "right_field",
+			"toX": 0.7037,
+			"toY": 0.6647,
+		}},
+		{"sponsor:lincoln", Gold, map[string]interface{}{
+			"id":  "lincoln",
+			"to":  "right_field",
+			"toX": 0.9152,
+			"toY": 0.4563,
+		}},
+		{"sponsor:misti", MISTI, map[string]interface{}{
+			"id": "misti",
+		}},
+	}
+}
+
+// Builds the world from the config files
+func seed() {
+	for _, room := range worldRooms() {
+		createRoomWithData(room.id, room.roomType, room.data)
+	}
 
 	createEvents()
 	createSponsors()
 
 	if len(config.GetSecret("EMAIL")) > 0 {
-		instance.SAdd("organizer_emails", config.GetSecret("EMAIL"))
+		store.Logins.AddEmail(models.Organizer, config.GetSecret("EMAIL"), "")
 	}
 }
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/techx/playground/db/models"
+)
+
+// ErrNotFound is returned when looking up something that doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Store holds every kind of data that Playground keeps around. Use GetStore to
+// get the one this server is using -- Redis in production (see
+// redis_store.go), or memory when running a single server for development and
+// tests (see memory_store.go)
+type Store struct {
+	Characters CharacterStore
+	Friends    FriendStore
+	Rooms      RoomStore
+	Messages   MessageStore
+	Sponsors   SponsorQueueStore
+	Songs      SongQueueStore
+	Events     EventStore
+	Locations  LocationStore
+	Projects   ProjectStore
+	Logins     LoginStore
+	Logs       LogStore
+	Tokens     TokenStore
+}
+
+// Position is where a character is standing in their room
+type Position struct {
+	X float64
+	Y float64
+}
+
+// CharacterStore keeps track of characters and everything attached to them
+type CharacterStore interface {
+	// Get returns ErrNotFound if there's no character with this ID
+	Get(id string) (*models.Character, error)
+
+	// GetMany skips over IDs that don't exist
+	GetMany(ids []string) ([]*models.Character, error)
+
+	Create(character *models.Character) error
+
+	// Update sets the given fields, named by their redis tags in
+	// models.Character
+	Update(id string, fields map[string]interface{}) error
+
+	// Increment adds one to a counter field and returns its new value
+	Increment(id, field string) (int64, error)
+
+	SetPositions(positions map[string]Position) error
+
+	// IDForEmail and IDForIdentity return ErrNotFound for people who have
+	// never logged in. Identities are someone's ID within a login provider,
+	// e.g. their Quill ID
+	IDForEmail(email string) (string, error)
+	IDForIdentity(provider, subject string) (string, error)
+	LinkEmail(email, id string) error
+	LinkIdentity(provider, subject, id string) error
+
+	// Connect marks a character as online on this ingest, and Disconnect
+	// marks them as offline
+	Connect(id, ingestID string) error
+	Disconnect(id, ingestID string) error
+
+	SetActive(id string, active bool) error
+
+	// Active returns whether each of these characters is online and active
+	Active(ids []string) ([]bool, error)
+
+	Achievements(id string) (*models.Achievements, error)
+
+	// SetAchievement marks an achievement as earned, named by its redis tag
+	// in models.Achievements
+	SetAchievement(id, achievement string) error
+
+	Settings(id string) (*models.Settings, error)
+
+	// UpdateSettings sets the given settings, named by their redis tags in
+	// models.Settings (plus "phoneNumber")
+	UpdateSettings(id string, fields map[string]interface{}) error
+
+	// PhoneNumber returns an empty string if this character hasn't given one
+	PhoneNumber(id string) (string, error)
+
+	// ProjectID returns an empty string if this character hasn't submitted a
+	// project
+	ProjectID(id string) (string, error)
+	SetProjectID(id, projectID string) error
+
+	// Capabilities returns the capabilities that have been granted (true) or
+	// denied (false) to this character on top of their role's (see the
+	// permissions package)
+	Capabilities(id string) (map[string]bool, error)
+
+	// SetCapability grants or denies a capability to this character, no
+	// matter what their role says
+	SetCapability(id, capability string, granted bool) error
+
+	// ClearCapability goes back to whatever this character's role says about
+	// a capability
+	ClearCapability(id, capability string) error
+}
+
+// FriendStore keeps track of who's friends (or teammates) with who
+type FriendStore interface {
+	Friends(id string) ([]string, error)
+	Teammates(id string) ([]string, error)
+
+	// Requests returns the IDs of people who have added this character as a
+	// friend, but haven't been added back yet
+	Requests(id string) ([]string, error)
+
+	IsFriend(id, otherID string) (bool, error)
+	IsTeammate(id, otherID string) (bool, error)
+	HasRequest(id, fromID string) (bool, error)
+
+	AddRequest(id, fromID string) error
+
+	// AcceptRequest makes two characters friends, and returns how many
+	// friends each of them has now
+	AcceptRequest(id, fromID string) (int64, int64, error)
+}
+
+// RoomStore keeps track of rooms, along with the elements and hallways inside
+// of them
+type RoomStore interface {
+	// List returns the ID of every room
+	List() ([]string, error)
+	Exists(id string) (bool, error)
+
+	// Get only fills in the room's own fields. Use Characters, Elements, and
+	// Hallways for the rest
+	Get(id string) (*models.Room, error)
+
+	// Create adds a room along with its elements (bottom layer first) and
+	// hallways
+	Create(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error
+
+	// Replace swaps out a room's fields, elements, and hallways all at once,
+	// leaving the characters in it alone. The room is created if it doesn't
+	// exist yet
+	Replace(room *models.Room, elements []*models.Element, hallways []*models.Hallway) error
+
+	Characters(id string) ([]string, error)
+	AddCharacter(id, characterID string) error
+	RemoveCharacter(id, characterID string) error
+
+	// Elements returns this room's elements, bottom layer first
+	Elements(id string) ([]*models.Element, error)
+	Element(elementID string) (*models.Element, error)
+	SaveElement(elementID string, element *models.Element) error
+	SetElementState(elementID string, state int) error
+
+	// Hallways returns this room's hallways, keyed by their IDs
+	Hallways(id string) (map[string]*models.Hallway, error)
+	Hallway(hallwayID string) (*models.Hallway, error)
+	AddHallway(id, hallwayID string, hallway *models.Hallway) error
+	SaveHallway(hallwayID string, hallway *models.Hallway) error
+	DeleteHallway(id, hallwayID string) error
+}
+
+// MessageStore keeps track of direct messages between characters
+type MessageStore interface {
+	Add(message *models.Message) error
+
+	// Conversation returns the last few messages between two characters,
+	// oldest first
+	Conversation(id, otherID string, limit int) ([]*models.Message, error)
+}
+
+// SponsorQueueStore keeps track of sponsors and the hackers waiting to talk to
+// them
+type SponsorQueueStore interface {
+	// List returns the ID of every sponsor
+	List() ([]string, error)
+	Get(id string) (*models.Sponsor, error)
+	Create(sponsor *models.Sponsor) error
+
+	// Update sets the given fields, named by their redis tags in
+	// models.Sponsor
+	Update(id string, fields map[string]interface{}) error
+
+	// Queue returns the hackers waiting to talk to this sponsor, in order
+	Queue(id string) ([]*models.QueueSubscriber, error)
+
+	// Join adds a hacker to the end of the queue, and returns their position
+	// (starting from 1) along with false if they were already in it
+	Join(id string, subscriber *models.QueueSubscriber) (int, bool, error)
+
+	// Position returns where a hacker is in the queue, starting from 1, or 0
+	// if they aren't in it
+	Position(id, characterID string) (int, error)
+
+	// Remove returns false if the hacker wasn't in the queue
+	Remove(id, characterID string) (bool, error)
+
+	// Next takes the hacker at the front of the queue out of it, and returns
+	// ErrNotFound if the queue is empty
+	Next(id string) (*models.QueueSubscriber, error)
+
+	// Move puts a hacker as close as it can to a new position in the queue,
+	// and returns the position they ended up at, or 0 if they aren't in it
+	Move(id, characterID string, position int) (int, error)
+
+	// Watchers are the sponsor reps who get updates about the queue
+	Watchers(id string) ([]string, error)
+	Watch(id, characterID string) error
+	Unwatch(id, characterID string) error
+}
+
+// SongQueueStore keeps track of the jukebox
+type SongQueueStore interface {
+	// Queue returns the songs waiting to be played, in order
+	Queue() ([]*models.Song, error)
+	Add(song *models.Song) error
+	Remove(id string) error
+
+	// Next takes the song at the front of the queue out of it, and returns
+	// ErrNotFound if the queue is empty. Unlike Remove, the song is kept
+	// around so that it can be played
+	Next() (*models.Song, error)
+
+	// Current returns the song that's playing (if any), and when it ends
+	Current() (*models.Song, time.Time, error)
+	SetCurrent(id string, endsAt time.Time) error
+
+	// Cooldown returns when this character can add another song, and false
+	// if they've never added one
+	Cooldown(characterID string) (time.Time, bool, error)
+	SetCooldown(characterID string, until time.Time) error
+}
+
+// EventStore keeps track of events and who attended them
+type EventStore interface {
+	List() ([]*models.Event, error)
+	Get(id string) (*models.Event, error)
+
+	// Create also replaces the details of an event that already exists
+	Create(id string, event *models.Event) error
+
+	// Delete takes an event off the schedule, but keeps track of who attended
+	// it
+	Delete(id string) error
+
+	Attend(id, characterID string) error
+}
+
+// LocationStore keeps track of where in the world people are
+type LocationStore interface {
+	List() ([]*models.Location, error)
+	Save(characterID string, location *models.Location) error
+}
+
+// ProjectStore keeps track of projects submitted by hackers
+type ProjectStore interface {
+	Get(id string) (*models.Project, error)
+	Save(id string, project *models.Project) error
+}
+
+// LoginStore keeps track of who can log in with an email address, rather than
+// through Quill
+type LoginStore interface {
+	// HasEmail returns true if this email can log in with the given role
+	HasEmail(role models.Role, email string) (bool, error)
+
+	// AddEmail lets an email log in with the given role. Sponsor reps also
+	// need their sponsor's ID
+	AddEmail(role models.Role, email, sponsorID string) error
+
+	// SponsorForEmail returns an empty string for emails that don't belong to
+	// a sponsor rep
+	SponsorForEmail(email string) (string, error)
+
+	// AddCode replaces whatever login code this email had with a new one,
+	// which expires after ttl
+	AddCode(email string, code int, ttl time.Duration) error
+
+	// CheckCode returns true if code is this email's current login code, and
+	// uses it up. Codes are also used up after maxAttempts wrong guesses
+	CheckCode(email string, code int, maxAttempts int) (bool, error)
+
+	// CountCodeRequest records that this email asked for a login code, and
+	// returns how many it has asked for (including this one) since the
+	// current window started
+	CountCodeRequest(email string, window time.Duration) (int, error)
+}
+
+// LogStore keeps a record of the packets clients have sent. Older logs are
+// moved out to the archive (see logs.go)
+type LogStore interface {
+	Add(log *models.Log) error
+
+	// Query returns the logs that are still in the store and match the
+	// filter, oldest first
+	Query(filter LogFilter) ([]*models.Log, error)
+
+	// DeleteBefore deletes the logs in the store from before this time, for
+	// when there's no archive to move them to
+	DeleteBefore(before time.Time) error
+}
+
+// TokenStore keeps track of login tokens that can't be used anymore. Tokens
+// are only remembered until they would have expired anyway
+type TokenStore interface {
+	// Revoke returns false if the token was already revoked
+	Revoke(tokenID string, expiresAt time.Time) (bool, error)
+	IsRevoked(tokenID string) (bool, error)
+
+	// Tokens are issued with their character's current generation.
+	// RevokeAll moves the character on to the next generation, which revokes
+	// every token issued to them so far
+	RevokeAll(characterID string) error
+	Generation(characterID string) (int, error)
+}
+
+// GetStore returns the store this server is using
+func GetStore() *Store {
+	return store
+}
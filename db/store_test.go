@@ -0,0 +1,566 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/db/models"
+)
+
+// Runs a test against every store implementation, so they all behave the same
+func forEachStore(t *testing.T, test func(t *testing.T, s *Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		useTestRedis(t)
+		test(t, NewRedisStore(instance))
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestAcceptRequest(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		friends := s.Friends
+
+		if err := friends.AddRequest("alice", "bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, _ := friends.HasRequest("alice", "bob"); !ok {
+			t.Fatal("expected alice to have a request from bob")
+		}
+
+		if ok, _ := friends.IsFriend("alice", "bob"); ok {
+			t.Fatal("alice and bob shouldn't be friends until the request is accepted")
+		}
+
+		aliceCount, bobCount, err := friends.AcceptRequest("alice", "bob")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if aliceCount != 1 || bobCount != 1 {
+			t.Errorf("expected both to have 1 friend, got %d and %d", aliceCount, bobCount)
+		}
+
+		if ok, _ := friends.HasRequest("alice", "bob"); ok {
+			t.Error("request should be gone once it's accepted")
+		}
+
+		for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+			if ok, _ := friends.IsFriend(pair[0], pair[1]); !ok {
+				t.Errorf("expected %s to be friends with %s", pair[0], pair[1])
+			}
+		}
+
+		// Friend counts go up for each new friend
+		friends.AddRequest("alice", "carol")
+		aliceCount, carolCount, _ := friends.AcceptRequest("alice", "carol")
+
+		if aliceCount != 2 || carolCount != 1 {
+			t.Errorf("expected alice to have 2 friends and carol 1, got %d and %d", aliceCount, carolCount)
+		}
+	})
+}
+
+// Returns the IDs of everyone in a sponsor's queue, in order
+func queueIDs(t *testing.T, sponsors SponsorQueueStore, id string) []string {
+	queue, err := sponsors.Queue(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, len(queue))
+
+	for i, subscriber := range queue {
+		ids[i] = subscriber.ID
+	}
+
+	return ids
+}
+
+func TestSponsorQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		sponsors := s.Sponsors
+
+		tests := []struct {
+			action   string
+			id       string
+			ok       bool
+			position int
+			queue    []string
+		}{
+			{"join", "a", true, 1, []string{"a"}},
+			{"join", "b", true, 2, []string{"a", "b"}},
+			{"join", "c", true, 3, []string{"a", "b", "c"}},
+
+			// Joining again keeps their place
+			{"join", "a", false, 1, []string{"a", "b", "c"}},
+
+			{"remove", "b", true, 0, []string{"a", "c"}},
+			{"remove", "b", false, 0, []string{"a", "c"}},
+			{"join", "b", true, 3, []string{"a", "c", "b"}},
+		}
+
+		for _, test := range tests {
+			switch test.action {
+			case "join":
+				position, joined, err := sponsors.Join("sponsor", &models.QueueSubscriber{ID: test.id, Name: "Hacker " + test.id})
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if joined != test.ok || position != test.position {
+					t.Errorf("%s %s: expected %v at %d, got %v at %d", test.action, test.id, test.ok, test.position, joined, position)
+				}
+			case "remove":
+				removed, err := sponsors.Remove("sponsor", test.id)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if removed != test.ok {
+					t.Errorf("%s %s: expected %v, got %v", test.action, test.id, test.ok, removed)
+				}
+			}
+
+			if ids := queueIDs(t, sponsors, "sponsor"); !equalStrings(ids, test.queue) {
+				t.Errorf("%s %s: expected %v, got %v", test.action, test.id, test.queue, ids)
+			}
+
+			// Positions stay in line with the queue
+			for i, id := range test.queue {
+				if position, _ := sponsors.Position("sponsor", id); position != i+1 {
+					t.Errorf("%s %s: expected %s at %d, got %d", test.action, test.id, id, i+1, position)
+				}
+			}
+		}
+
+		// Subscriber details come back with the queue
+		if queue, _ := sponsors.Queue("sponsor"); queue[0].Name != "Hacker a" {
+			t.Errorf("expected subscriber details to be saved, got %+v", queue[0])
+		}
+
+		if position, _ := sponsors.Position("sponsor", "nobody"); position != 0 {
+			t.Errorf("expected hackers outside the queue to be at 0, got %d", position)
+		}
+
+		// Other sponsors' queues are separate
+		if ids := queueIDs(t, sponsors, "other"); len(ids) != 0 {
+			t.Errorf("expected an empty queue, got %v", ids)
+		}
+
+		sponsors.Watch("sponsor", "rep")
+
+		if watchers, _ := sponsors.Watchers("sponsor"); !equalStrings(watchers, []string{"rep"}) {
+			t.Errorf("expected rep to be watching, got %v", watchers)
+		}
+
+		sponsors.Unwatch("sponsor", "rep")
+
+		if watchers, _ := sponsors.Watchers("sponsor"); len(watchers) != 0 {
+			t.Errorf("expected nobody to be watching, got %v", watchers)
+		}
+	})
+}
+
+func TestSponsorQueueNext(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		sponsors := s.Sponsors
+
+		if _, err := sponsors.Next("sponsor"); err != ErrNotFound {
+			t.Errorf("expected ErrNotFound from an empty queue, got %v", err)
+		}
+
+		for _, id := range []string{"a", "b", "c"} {
+			sponsors.Join("sponsor", &models.QueueSubscriber{ID: id, Name: "Hacker " + id})
+		}
+
+		for i, id := range []string{"a", "b", "c"} {
+			next, err := sponsors.Next("sponsor")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if next.ID != id || next.Name != "Hacker "+id {
+				t.Errorf("expected %s to be next, got %+v", id, next)
+			}
+
+			if position, _ := sponsors.Position("sponsor", id); position != 0 {
+				t.Errorf("expected %s to leave the queue, got %d", id, position)
+			}
+
+			if ids := queueIDs(t, sponsors, "sponsor"); len(ids) != 2-i {
+				t.Errorf("expected %d left in the queue, got %v", 2-i, ids)
+			}
+		}
+
+		if _, err := sponsors.Next("sponsor"); err != ErrNotFound {
+			t.Errorf("expected ErrNotFound once the queue is empty, got %v", err)
+		}
+	})
+}
+
+func TestSponsorQueueMove(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		sponsors := s.Sponsors
+
+		for _, id := range []string{"a", "b", "c"} {
+			sponsors.Join("sponsor", &models.QueueSubscriber{ID: id})
+		}
+
+		tests := []struct {
+			id       string
+			position int
+			expected int
+			queue    []string
+		}{
+			{"c", 1, 1, []string{"c", "a", "b"}},
+			{"c", 3, 3, []string{"a", "b", "c"}},
+			{"b", 2, 2, []string{"a", "b", "c"}},
+
+			// Positions past either end are as close as they can get
+			{"a", 0, 1, []string{"a", "b", "c"}},
+			{"a", 10, 3, []string{"b", "c", "a"}},
+
+			{"nobody", 1, 0, []string{"b", "c", "a"}},
+		}
+
+		for _, test := range tests {
+			position, err := sponsors.Move("sponsor", test.id, test.position)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if position != test.expected {
+				t.Errorf("moving %s to %d: expected to end up at %d, got %d", test.id, test.position, test.expected, position)
+			}
+
+			if ids := queueIDs(t, sponsors, "sponsor"); !equalStrings(ids, test.queue) {
+				t.Errorf("moving %s to %d: expected %v, got %v", test.id, test.position, test.queue, ids)
+			}
+
+			for i, id := range test.queue {
+				if position, _ := sponsors.Position("sponsor", id); position != i+1 {
+					t.Errorf("moving %s to %d: expected %s at %d, got %d", test.id, test.position, id, i+1, position)
+				}
+			}
+		}
+	})
+}
+
+func TestConversation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		messages := s.Messages
+		texts := []string{"hi", "hey", "how's it going", "good, you?"}
+
+		for i, text := range texts {
+			from, to := "alice", "bob"
+
+			if i%2 == 1 {
+				from, to = to, from
+			}
+
+			if err := messages.Add(&models.Message{From: from, To: to, Text: text}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Someone else's conversation shouldn't show up
+		messages.Add(&models.Message{From: "alice", To: "carol", Text: "hello"})
+
+		// Both sides see the same conversation, oldest first
+		for _, pair := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+			conversation, err := messages.Conversation(pair[0], pair[1], 10)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(conversation) != len(texts) {
+				t.Fatalf("expected %d messages, got %d", len(texts), len(conversation))
+			}
+
+			for i, message := range conversation {
+				if message.Text != texts[i] {
+					t.Errorf("message %d: expected %q, got %q", i, texts[i], message.Text)
+				}
+			}
+		}
+
+		// Limits keep the most recent messages
+		conversation, _ := messages.Conversation("alice", "bob", 2)
+
+		if len(conversation) != 2 || conversation[0].Text != texts[2] || conversation[1].Text != texts[3] {
+			t.Errorf("expected the last two messages, got %v", conversation)
+		}
+	})
+}
+
+// Like forEachStore, but also passes a function that moves the store's clock
+// forward, for testing things that expire
+func forEachStoreWithClock(t *testing.T, test func(t *testing.T, s *Store, elapse func(d time.Duration))) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore(), time.Sleep)
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		server := useTestRedis(t)
+		test(t, NewRedisStore(instance), server.FastForward)
+	})
+}
+
+func TestLoginCodes(t *testing.T) {
+	forEachStoreWithClock(t, func(t *testing.T, s *Store, elapse func(d time.Duration)) {
+		logins := s.Logins
+
+		if ok, _ := logins.CheckCode("a@example.com", 123456, 5); ok {
+			t.Error("code shouldn't work before it's added")
+		}
+
+		logins.AddCode("a@example.com", 123456, time.Minute)
+
+		if ok, _ := logins.CheckCode("b@example.com", 123456, 5); ok {
+			t.Error("codes should only work for their own email")
+		}
+
+		if ok, _ := logins.CheckCode("a@example.com", 123456, 5); !ok {
+			t.Error("expected the code to work")
+		}
+
+		if ok, _ := logins.CheckCode("a@example.com", 123456, 5); ok {
+			t.Error("codes should only work once")
+		}
+
+		// Asking for a new code replaces the old one
+		logins.AddCode("a@example.com", 111111, time.Minute)
+		logins.AddCode("a@example.com", 222222, time.Minute)
+
+		if ok, _ := logins.CheckCode("a@example.com", 111111, 5); ok {
+			t.Error("replaced code shouldn't work")
+		}
+
+		if ok, _ := logins.CheckCode("a@example.com", 222222, 5); !ok {
+			t.Error("expected the new code to work")
+		}
+
+		logins.AddCode("a@example.com", 123456, 10*time.Millisecond)
+		elapse(20 * time.Millisecond)
+
+		if ok, _ := logins.CheckCode("a@example.com", 123456, 5); ok {
+			t.Error("expired code shouldn't work")
+		}
+	})
+}
+
+func TestLoginCodeAttempts(t *testing.T) {
+	tests := []struct {
+		wrongGuesses int
+		ok           bool
+	}{
+		{0, true},
+		{2, true},
+
+		// The code is used up once there are as many wrong guesses as allowed
+		{3, false},
+		{4, false},
+	}
+
+	forEachStore(t, func(t *testing.T, s *Store) {
+		logins := s.Logins
+
+		for _, test := range tests {
+			logins.AddCode("a@example.com", 123456, time.Minute)
+
+			for i := 0; i < test.wrongGuesses; i++ {
+				if ok, _ := logins.CheckCode("a@example.com", 654321, 3); ok {
+					t.Fatal("wrong code shouldn't work")
+				}
+			}
+
+			if ok, _ := logins.CheckCode("a@example.com", 123456, 3); ok != test.ok {
+				t.Errorf("after %d wrong guesses: expected %v, got %v", test.wrongGuesses, test.ok, ok)
+			}
+		}
+	})
+}
+
+func TestCountCodeRequest(t *testing.T) {
+	forEachStoreWithClock(t, func(t *testing.T, s *Store, elapse func(d time.Duration)) {
+		logins := s.Logins
+
+		for i := 1; i <= 3; i++ {
+			if count, _ := logins.CountCodeRequest("a@example.com", 10*time.Millisecond); count != i {
+				t.Errorf("expected count %d, got %d", i, count)
+			}
+		}
+
+		// Every email has its own count
+		if count, _ := logins.CountCodeRequest("b@example.com", time.Minute); count != 1 {
+			t.Errorf("expected another email to start at 1, got %d", count)
+		}
+
+		elapse(20 * time.Millisecond)
+
+		if count, _ := logins.CountCodeRequest("a@example.com", time.Minute); count != 1 {
+			t.Errorf("expected the count to start over once the window ends, got %d", count)
+		}
+	})
+}
+
+func TestLoginEmails(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		logins := s.Logins
+
+		logins.AddEmail(models.SponsorRep, "rep@example.com", "acme")
+		logins.AddEmail(models.Mentor, "mentor@example.com", "")
+
+		tests := []struct {
+			role    models.Role
+			email   string
+			allowed bool
+			sponsor string
+		}{
+			{models.SponsorRep, "rep@example.com", true, "acme"},
+			{models.Mentor, "rep@example.com", false, "acme"},
+			{models.Mentor, "mentor@example.com", true, ""},
+			{models.Organizer, "someone@example.com", false, ""},
+		}
+
+		for _, test := range tests {
+			if allowed, _ := logins.HasEmail(test.role, test.email); allowed != test.allowed {
+				t.Errorf("%s as %s: expected %v, got %v", test.email, test.role, test.allowed, allowed)
+			}
+
+			if sponsor, _ := logins.SponsorForEmail(test.email); sponsor != test.sponsor {
+				t.Errorf("%s: expected sponsor %q, got %q", test.email, test.sponsor, sponsor)
+			}
+		}
+	})
+}
+
+func TestTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		tokens := s.Tokens
+		expiresAt := time.Now().Add(time.Hour)
+
+		if revoked, _ := tokens.IsRevoked("a"); revoked {
+			t.Error("tokens shouldn't start out revoked")
+		}
+
+		if first, err := tokens.Revoke("a", expiresAt); err != nil || !first {
+			t.Errorf("expected the first revoke to return true, got %v (%v)", first, err)
+		}
+
+		if first, _ := tokens.Revoke("a", expiresAt); first {
+			t.Error("expected revoking again to return false")
+		}
+
+		if revoked, _ := tokens.IsRevoked("a"); !revoked {
+			t.Error("expected the token to be revoked")
+		}
+
+		if revoked, _ := tokens.IsRevoked("b"); revoked {
+			t.Error("other tokens shouldn't be revoked")
+		}
+
+		for generation := 0; generation < 3; generation++ {
+			if current, _ := tokens.Generation("character"); current != generation {
+				t.Errorf("expected generation %d, got %d", generation, current)
+			}
+
+			tokens.RevokeAll("character")
+		}
+
+		if generation, _ := tokens.Generation("other"); generation != 0 {
+			t.Errorf("expected other characters to stay on generation 0, got %d", generation)
+		}
+	})
+}
+
+func TestSongQueueNext(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		songs := s.Songs
+
+		for _, id := range []string{"first", "second"} {
+			songs.Add(&models.Song{ID: id, Title: id, Duration: 180})
+		}
+
+		for _, id := range []string{"first", "second"} {
+			song, err := songs.Next()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The song is still around to be played
+			if song.ID != id || song.Title != id || song.Duration != 180 {
+				t.Errorf("expected %s, got %+v", id, song)
+			}
+
+			songs.SetCurrent(song.ID, time.Now())
+
+			if current, _, _ := songs.Current(); current.Title != id {
+				t.Errorf("expected %s to be playing, got %+v", id, current)
+			}
+		}
+
+		if _, err := songs.Next(); err != ErrNotFound {
+			t.Errorf("expected ErrNotFound once the queue is empty, got %v", err)
+		}
+	})
+}
+
+func TestLogsDeleteBefore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		now := time.Now()
+
+		for i, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour, 0} {
+			s.Logs.Add(&models.Log{Message: strconv.Itoa(i), Timestamp: now.Add(-age).Unix()})
+		}
+
+		if err := s.Logs.DeleteBefore(now.Add(-90 * time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		logs, _ := s.Logs.Query(LogFilter{})
+		messages := make([]string, len(logs))
+
+		for i, entry := range logs {
+			messages[i] = entry.Message
+		}
+
+		if expected := []string{"2", "3"}; !equalStrings(messages, expected) {
+			t.Errorf("expected %v, got %v", expected, messages)
+		}
+	})
+}
+
+func sortedStrings(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/metrics"
+	"github.com/techx/playground/wire"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Ingests send packets to each other through Redis streams, one per channel
+// (e.g. "room:<id>", "character:<id>", or "all"). Each ingest only reads the
+// streams it cares about, and remembers how far it's read so that it can pick
+// up where it left off if it loses its connection to Redis, or restarts with
+// the same ingest ID
+
+const (
+	// How long to wait for new packets before checking for new subscriptions
+	streamBlock = 200 * time.Millisecond
+
+	// Most packets to read from Redis at once
+	streamBatchSize = 256
+)
+
+var (
+	// Guards streamPositions
+	streamsMu sync.Mutex
+
+	// ID of the last entry we've read from each stream we're subscribed to,
+	// keyed by stream key
+	streamPositions = map[string]string{}
+
+	// Where we'd gotten to in each stream before we restarted, for streams we
+	// haven't subscribed to again yet
+	savedPositions = map[string]string{}
+
+	// Handles packets from leader tasks when there's no Redis, in which case
+	// they run on this ingest
+	localCallback func(channel string, msg []byte)
+)
+
+func streamKey(channel string) string {
+	return "stream:" + channel
+}
+
+// Subscribe starts reading packets on more channels, e.g. when a client enters
+// a room that nobody else on this ingest is in. Only packets sent after this
+// call are read, unless we were reading the channel before we restarted
+func Subscribe(channels ...string) error {
+	for _, channel := range channels {
+		key := streamKey(channel)
+
+		// Start from the newest entry so far. If Redis is unreachable, start
+		// from now instead (entry IDs are timestamps), so that we don't miss
+		// anything once it comes back
+		position := fmt.Sprintf("%d-0", time.Now().UnixNano()/int64(time.Millisecond))
+		entries, err := instance.XRevRangeN(key, "+", "-", 1).Result()
+
+		if err != nil {
+			log.Println("ERROR: Unable to find the end of", key, "->", err)
+		} else if len(entries) > 0 {
+			position = entries[0].ID
+		} else {
+			position = "0-0"
+		}
+
+		streamsMu.Lock()
+
+		if _, ok := streamPositions[key]; !ok {
+			if saved, ok := savedPositions[key]; ok {
+				position = saved
+				delete(savedPositions, key)
+			}
+
+			streamPositions[key] = position
+		}
+
+		streamsMu.Unlock()
+	}
+
+	return nil
+}
+
+// Unsubscribe stops reading channels that none of our clients care about
+// anymore
+func Unsubscribe(channels ...string) error {
+	keys := make([]string, len(channels))
+	streamsMu.Lock()
+
+	for i, channel := range channels {
+		keys[i] = streamKey(channel)
+		delete(streamPositions, keys[i])
+	}
+
+	streamsMu.Unlock()
+	return instance.HDel("ingest:"+ingestID+":positions", keys...).Err()
+}
+
+// ListenForUpdates reads packets from other ingests on the channels we're
+// subscribed to, plus "all", and passes them to callback along with the channel
+// they came in on. Errors from Redis are retried with backoff. Without Redis,
+// only packets from the leader tasks come in, and this returns right away
+func ListenForUpdates(callback func(channel string, msg []byte)) {
+	if instance == nil {
+		streamsMu.Lock()
+		localCallback = callback
+		streamsMu.Unlock()
+		return
+	}
+
+	loadPositions()
+	Subscribe("all")
+
+	// Let the leader know about this ingest
+	heartbeat()
+	instance.RPush("ingests", ingestID)
+
+	go savePositions()
+
+	backoff := 100 * time.Millisecond
+
+	for {
+		streams := readStreams()
+
+		if streams == nil {
+			time.Sleep(backoff)
+
+			if backoff < 5*time.Second {
+				backoff *= 2
+			}
+
+			continue
+		}
+
+		backoff = 100 * time.Millisecond
+
+		for _, stream := range streams {
+			channel := stream.Stream[len("stream:"):]
+
+			for _, entry := range stream.Messages {
+				if !advancePosition(stream.Stream, entry.ID) {
+					// We unsubscribed while this batch was being read
+					break
+				}
+
+				origin, _ := entry.Values["origin"].(string)
+
+				if origin == ingestID {
+					// We already handled our own packets before sending them
+					continue
+				}
+
+				payload, _ := entry.Values["packet"].(string)
+				data, err := wire.Expand([]byte(payload))
+
+				if err != nil {
+					log.Println("ERROR: Unable to decode packet from", channel, "->", err)
+					continue
+				}
+
+				metrics.StreamMessagesReceived.WithLabelValues(strings.SplitN(channel, ":", 2)[0]).Inc()
+				callback(channel, data)
+			}
+		}
+	}
+}
+
+// Reads the next batch of packets from every stream we're subscribed to.
+// Returns nil if something went wrong
+func readStreams() []redis.XStream {
+	streamsMu.Lock()
+	args := make([]string, 0, 2*len(streamPositions))
+	ids := make([]string, 0, len(streamPositions))
+
+	for key, position := range streamPositions {
+		args = append(args, key)
+		ids = append(ids, position)
+	}
+
+	streamsMu.Unlock()
+
+	streams, err := instance.XRead(&redis.XReadArgs{
+		Streams: append(args, ids...),
+		Count:   streamBatchSize,
+		Block:   streamBlock,
+	}).Result()
+
+	if err == redis.Nil {
+		return []redis.XStream{}
+	} else if err != nil {
+		log.Println("ERROR: Unable to read packets from other ingests ->", err)
+		return nil
+	}
+
+	return streams
+}
+
+// Moves our position in a stream forward, returning false if we're no longer
+// subscribed to it
+func advancePosition(key, id string) bool {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	if _, ok := streamPositions[key]; !ok {
+		return false
+	}
+
+	streamPositions[key] = id
+	return true
+}
+
+// Loads how far we'd read in each stream the last time we ran with this ingest
+// ID. The leader cleans up after ingests that are gone for too long, so there
+// are only positions to load after a quick restart
+func loadPositions() {
+	key := "ingest:" + ingestID + ":positions"
+
+	// Positions are saved again once we subscribe, so any we don't use are
+	// forgotten rather than loaded after the next restart too
+	pip := instance.TxPipeline()
+	positionsCmd := pip.HGetAll(key)
+	pip.Del(key)
+
+	if _, err := pip.Exec(); err != nil {
+		log.Println("ERROR: Unable to load stream positions ->", err)
+		return
+	}
+
+	streamsMu.Lock()
+	savedPositions = positionsCmd.Val()
+	streamsMu.Unlock()
+}
+
+// Periodically saves how far we've read in each stream, so it's visible to
+// other ingests and survives us reconnecting to Redis
+func savePositions() {
+	for range time.NewTicker(time.Second).C {
+		streamsMu.Lock()
+		positions := make(map[string]interface{}, len(streamPositions))
+
+		for key, position := range streamPositions {
+			positions[key] = position
+		}
+
+		streamsMu.Unlock()
+
+		if len(positions) == 0 {
+			continue
+		}
+
+		instance.HSet("ingest:"+ingestID+":positions", positions)
+	}
+}
+
+// Publication is a packet along with the channels it goes out on
+type Publication struct {
+	Data     []byte
+	Channels []string
+}
+
+// Publish sends a packet to the other ingests reading these channels, in a more
+// compact encoding than JSON
+func Publish(data []byte, channels ...string) {
+	PublishAll([]Publication{{data, channels}})
+}
+
+// PublishAll sends a batch of packets to the other ingests in one round trip
+func PublishAll(publications []Publication) {
+	if instance == nil {
+		// There aren't any other ingests without Redis
+		return
+	}
+
+	pip := instance.Pipeline()
+
+	for _, publication := range publications {
+		publish(pip, ingestID, publication.Data, publication.Channels...)
+	}
+
+	if _, err := pip.Exec(); err != nil {
+		log.Println("ERROR: Unable to send packets to other ingests ->", err)
+	}
+}
+
+// Hands a packet from a leader task straight to this ingest, for when there's
+// no Redis to send it through
+func publishLocally(data []byte, channels ...string) {
+	streamsMu.Lock()
+	callback := localCallback
+	streamsMu.Unlock()
+
+	if callback == nil {
+		return
+	}
+
+	for _, channel := range channels {
+		callback(channel, data)
+	}
+}
+
+// Adds a packet to each channel's stream. The origin lets ingests skip packets
+// they sent themselves -- packets from the leader have no origin, since every
+// ingest (the leader included) needs to handle them
+func publish(pip redis.Pipeliner, origin string, data []byte, channels ...string) {
+	maxLen := config.GetConfig().GetInt64("streams.max_length")
+	ttl := time.Duration(config.GetConfig().GetInt("streams.ttl_seconds")) * time.Second
+	payload := wire.Compact(data)
+
+	// Entry IDs start with when they were added, in milliseconds
+	minID := fmt.Sprintf("%d-0", time.Now().Add(-ttl).UnixNano()/int64(time.Millisecond))
+
+	for _, channel := range channels {
+		key := streamKey(channel)
+
+		pip.XAdd(&redis.XAddArgs{
+			Stream:       key,
+			MaxLenApprox: maxLen,
+			Values: map[string]interface{}{
+				"origin": origin,
+				"packet": payload,
+			},
+		})
+
+		// Packets older than the TTL are dropped, and streams for rooms that
+		// have gone quiet clean themselves up
+		pip.Do("XTRIM", key, "MINID", "~", minID)
+		pip.Expire(key, ttl)
+	}
+}
@@ -0,0 +1,302 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/wire"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Forgets every stream we were subscribed to, as if the ingest just started
+func resetStreams(t *testing.T) {
+	streamsMu.Lock()
+	streamPositions = map[string]string{}
+	savedPositions = map[string]string{}
+	streamsMu.Unlock()
+
+	t.Cleanup(func() {
+		streamsMu.Lock()
+		streamPositions = map[string]string{}
+		savedPositions = map[string]string{}
+		streamsMu.Unlock()
+	})
+}
+
+// Reads whatever is waiting in the streams we're subscribed to, moving our
+// positions forward like ListenForUpdates does, and returns the packets by
+// channel
+func readPackets(t *testing.T) map[string][]string {
+	streams := readStreams()
+
+	if streams == nil {
+		t.Fatal("unable to read streams")
+	}
+
+	packets := map[string][]string{}
+
+	for _, stream := range streams {
+		for _, entry := range stream.Messages {
+			if !advancePosition(stream.Stream, entry.ID) {
+				break
+			}
+
+			payload, _ := entry.Values["packet"].(string)
+			data, err := wire.Expand([]byte(payload))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channel := stream.Stream[len("stream:"):]
+			packets[channel] = append(packets[channel], string(data))
+		}
+	}
+
+	return packets
+}
+
+func TestPublish(t *testing.T) {
+	server := useTestRedis(t)
+	resetStreams(t)
+
+	data := `{"type":"chat","mssg":"hi"}`
+	Publish([]byte(data), "room:home", "character:abc")
+
+	tests := []struct {
+		channel string
+		key     string
+	}{
+		{"room:home", "stream:room:home"},
+		{"character:abc", "stream:character:abc"},
+	}
+
+	for _, test := range tests {
+		entries, err := instance.XRange(test.key, "-", "+").Result()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 {
+			t.Fatalf("%s: expected 1 entry, got %d", test.channel, len(entries))
+		}
+
+		if origin := entries[0].Values["origin"]; origin != ingestID {
+			t.Errorf("%s: expected origin %s, got %v", test.channel, ingestID, origin)
+		}
+
+		payload, _ := entries[0].Values["packet"].(string)
+
+		if !wire.IsMessagePack([]byte(payload)) {
+			t.Errorf("%s: expected a compact packet, got %q", test.channel, payload)
+		}
+
+		if ttl := server.TTL(test.key); ttl <= 0 {
+			t.Errorf("%s: expected the stream to expire, got TTL %v", test.channel, ttl)
+		}
+	}
+
+	// Packets from the leader have no origin
+	pip := instance.Pipeline()
+	publish(pip, "", []byte(data), "all")
+	pip.Exec()
+
+	if entries, _ := instance.XRange("stream:all", "-", "+").Result(); len(entries) != 1 || entries[0].Values["origin"] != "" {
+		t.Errorf("expected a packet without an origin, got %v", entries)
+	}
+}
+
+func TestStreamMaxLength(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	config.GetConfig().Set("streams.max_length", 3)
+	defer config.GetConfig().Set("streams.max_length", 1000)
+
+	for i := 0; i < 10; i++ {
+		Publish([]byte(`{"type":"move"}`), "room:home")
+	}
+
+	if length, _ := instance.XLen("stream:room:home").Result(); length > 3 {
+		t.Errorf("expected the stream to be capped at 3 entries, got %d", length)
+	}
+}
+
+func TestStreamTTL(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	ttl := time.Duration(config.GetConfig().GetInt("streams.ttl_seconds")) * time.Second
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		kept bool
+	}{
+		{"past the TTL", ttl + time.Minute, false},
+		{"within the TTL", ttl - time.Minute, true},
+	}
+
+	ids := make([]string, len(tests))
+
+	for i, test := range tests {
+		ids[i] = fmt.Sprintf("%d-0", time.Now().Add(-test.age).UnixNano()/int64(time.Millisecond))
+		instance.XAdd(&redis.XAddArgs{Stream: "stream:room:home", ID: ids[i], Values: map[string]interface{}{"packet": "{}"}})
+	}
+
+	// Old packets are trimmed whenever a new one comes in
+	Publish([]byte(`{"type":"move"}`), "room:home")
+
+	for i, test := range tests {
+		entries, _ := instance.XRange("stream:room:home", ids[i], ids[i]).Result()
+
+		if kept := len(entries) > 0; kept != test.kept {
+			t.Errorf("%s: expected the packet to be kept: %v, got %v", test.name, test.kept, kept)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	// Packets sent before we subscribed aren't read
+	Publish([]byte(`{"type":"chat","mssg":"before"}`), "room:home")
+
+	if err := Subscribe("room:home", "room:plaza"); err != nil {
+		t.Fatal(err)
+	}
+
+	asIngest(uuid.New().String(), func() {
+		Publish([]byte(`{"type":"chat","mssg":"home"}`), "room:home")
+		Publish([]byte(`{"type":"chat","mssg":"plaza"}`), "room:plaza")
+		Publish([]byte(`{"type":"chat","mssg":"elsewhere"}`), "room:elsewhere")
+	})
+
+	packets := readPackets(t)
+
+	expected := map[string][]string{
+		"room:home":  {`{"mssg":"home","type":"chat"}`},
+		"room:plaza": {`{"mssg":"plaza","type":"chat"}`},
+	}
+
+	if len(packets) != len(expected) {
+		t.Errorf("expected packets from %d channels, got %v", len(expected), packets)
+	}
+
+	for channel, want := range expected {
+		if got := packets[channel]; len(got) != len(want) || got[0] != want[0] {
+			t.Errorf("%s: expected %v, got %v", channel, want, got)
+		}
+	}
+
+	// Positions move forward, so nothing is read twice
+	Publish([]byte(`{"type":"chat","mssg":"again"}`), "room:home")
+
+	packets = readPackets(t)
+
+	if got := packets["room:home"]; len(got) != 1 || got[0] != `{"mssg":"again","type":"chat"}` {
+		t.Errorf("expected only the new packet, got %v", packets)
+	}
+
+	// Subscribing again doesn't move our position back
+	streamsMu.Lock()
+	before := streamPositions["stream:room:home"]
+	streamsMu.Unlock()
+
+	Subscribe("room:home")
+
+	streamsMu.Lock()
+	after := streamPositions["stream:room:home"]
+	streamsMu.Unlock()
+
+	if before != after {
+		t.Errorf("expected position %s to stay put, got %s", before, after)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	Subscribe("room:home", "room:plaza")
+
+	if err := Unsubscribe("room:plaza"); err != nil {
+		t.Fatal(err)
+	}
+
+	if advancePosition("stream:room:plaza", "1-0") {
+		t.Error("positions shouldn't move in streams we unsubscribed from")
+	}
+
+	Publish([]byte(`{"type":"chat"}`), "room:home", "room:plaza")
+
+	packets := readPackets(t)
+
+	if len(packets["room:plaza"]) != 0 || len(packets["room:home"]) != 1 {
+		t.Errorf("expected only packets from room:home, got %v", packets)
+	}
+}
+
+func TestLoadPositions(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	// Read a packet, then go away for a bit
+	Subscribe("room:home")
+	Publish([]byte(`{"type":"chat","mssg":"seen"}`), "room:home")
+	readPackets(t)
+
+	streamsMu.Lock()
+	instance.HSet("ingest:"+ingestID+":positions", "stream:room:home", streamPositions["stream:room:home"],
+		"stream:room:plaza", "0-0")
+	streamsMu.Unlock()
+
+	resetStreams(t)
+	Publish([]byte(`{"type":"chat","mssg":"missed"}`), "room:home")
+
+	// Coming back with the same ID picks up where we left off, but only in
+	// streams we subscribe to again
+	loadPositions()
+	Subscribe("room:home")
+	Publish([]byte(`{"type":"chat","mssg":"after"}`), "room:plaza")
+
+	packets := readPackets(t)
+
+	if expected := []string{`{"mssg":"missed","type":"chat"}`}; !equalStrings(packets["room:home"], expected) {
+		t.Errorf("expected %v, got %v", expected, packets["room:home"])
+	}
+
+	if len(packets["room:plaza"]) != 0 {
+		t.Errorf("expected nothing from room:plaza, got %v", packets["room:plaza"])
+	}
+
+	// Positions are only loaded once
+	if saved, _ := instance.HLen("ingest:" + ingestID + ":positions").Result(); saved != 0 {
+		t.Errorf("expected the saved positions to be used up, got %d", saved)
+	}
+}
+
+func TestReadStreamsWaits(t *testing.T) {
+	useTestRedis(t)
+	resetStreams(t)
+
+	Subscribe("room:home")
+
+	// Nothing new, so reading waits a bit and comes back empty
+	start := time.Now()
+	streams := readStreams()
+
+	if streams == nil || len(streams) != 0 {
+		t.Errorf("expected no packets, got %v", streams)
+	}
+
+	if time.Since(start) < streamBlock/2 {
+		t.Errorf("expected reading to wait for new packets, returned after %v", time.Since(start))
+	}
+}
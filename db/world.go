@@ -0,0 +1,208 @@
+package db
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/techx/playground/db/models"
+)
+
+// A room in the same format as the templates in config/rooms, along with the
+// ID of the room it came from. Snapshots are already filled in, so they don't
+// have any placeholders like <id> or shortcuts like "tile"
+type roomSnapshot struct {
+	ID         string             `json:"id"`
+	Background string             `json:"background"`
+	Sponsor    bool               `json:"sponsor"`
+	SponsorID  string             `json:"sponsorId,omitempty"`
+	Corners    string             `json:"corners,omitempty"`
+	Elements   []*elementSnapshot `json:"elements"`
+	Hallways   []*models.Hallway  `json:"hallways"`
+}
+
+// An element as it's written in the templates, leaving out the fields most
+// elements don't use
+type elementSnapshot struct {
+	X                 float64 `json:"x"`
+	Y                 float64 `json:"y"`
+	Width             float64 `json:"width,omitempty"`
+	Path              string  `json:"path"`
+	ChangingImagePath bool    `json:"changingImagePath,omitempty"`
+	ChangingPaths     string  `json:"changingPaths,omitempty"`
+	ChangingInterval  int     `json:"changingInterval,omitempty"`
+	ChangingRandomly  bool    `json:"changingRandomly,omitempty"`
+	Action            int     `json:"action,omitempty"`
+	Hoverable         bool    `json:"hoverable,omitempty"`
+	Toggleable        bool    `json:"toggleable,omitempty"`
+	State             int     `json:"state,omitempty"`
+}
+
+// ExportWorld writes every room, with its elements and hallways, to a JSON file
+// in dir. Returns how many rooms were written
+func ExportWorld(dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	roomIDs, err := store.Rooms.List()
+
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Strings(roomIDs)
+
+	for i, roomID := range roomIDs {
+		snapshot, err := snapshotRoom(roomID)
+
+		if err != nil {
+			return i, err
+		}
+
+		dat, err := json.MarshalIndent(snapshot, "", "  ")
+
+		if err != nil {
+			return i, err
+		}
+
+		if err := ioutil.WriteFile(snapshotPath(dir, roomID), append(dat, '\n'), 0644); err != nil {
+			return i, err
+		}
+	}
+
+	return len(roomIDs), nil
+}
+
+// ImportWorld replaces rooms with the snapshots in dir, as written by
+// ExportWorld. Rooms that aren't in dir are left alone, and characters stay in
+// the rooms they're in. Returns how many rooms were replaced
+func ImportWorld(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Make sure every snapshot is readable before we change anything
+	snapshots := make([]*roomSnapshot, len(paths))
+
+	for i, path := range paths {
+		dat, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return 0, err
+		}
+
+		snapshots[i] = new(roomSnapshot)
+
+		if err := json.Unmarshal(dat, snapshots[i]); err != nil {
+			return 0, err
+		}
+
+		if snapshots[i].ID == "" {
+			snapshots[i].ID = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+	}
+
+	for i, snapshot := range snapshots {
+		room := &models.Room{
+			Background: snapshot.Background,
+			Corners:    snapshot.Corners,
+			ID:         snapshot.ID,
+			SponsorID:  snapshot.SponsorID,
+		}
+
+		elements := make([]*models.Element, len(snapshot.Elements))
+
+		for j, elementData := range snapshot.Elements {
+			elements[j] = new(models.Element)
+			fromTemplate(elementData, elements[j])
+		}
+
+		if err := store.Rooms.Replace(room, elements, snapshot.Hallways); err != nil {
+			return i, err
+		}
+
+		log.Println("Imported room", snapshot.ID, "with", len(elements), "elements and", len(snapshot.Hallways), "hallways")
+	}
+
+	return len(snapshots), nil
+}
+
+// Reads a room and everything in it back into the template format
+func snapshotRoom(roomID string) (*roomSnapshot, error) {
+	room, err := store.Rooms.Get(roomID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	elements, err := store.Rooms.Elements(roomID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hallways, err := store.Rooms.Hallways(roomID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hallwayList := make([]*models.Hallway, 0, len(hallways))
+
+	for _, hallway := range hallways {
+		hallwayList = append(hallwayList, hallway)
+	}
+
+	return newRoomSnapshot(room, elements, hallwayList), nil
+}
+
+// Puts a room and everything in it into the template format
+func newRoomSnapshot(room *models.Room, elements []*models.Element, hallways []*models.Hallway) *roomSnapshot {
+	snapshot := &roomSnapshot{
+		ID:         room.ID,
+		Background: room.Background,
+		Sponsor:    room.SponsorID != "",
+		SponsorID:  room.SponsorID,
+		Corners:    room.Corners,
+		Elements:   make([]*elementSnapshot, len(elements)),
+		Hallways:   hallways,
+	}
+
+	if snapshot.Hallways == nil {
+		snapshot.Hallways = []*models.Hallway{}
+	}
+
+	for i, element := range elements {
+		snapshot.Elements[i] = new(elementSnapshot)
+		fromTemplate(element, snapshot.Elements[i])
+	}
+
+	// Hallway IDs are random, so sort them by where they are to keep exports
+	// of the same world identical
+	sort.Slice(snapshot.Hallways, func(i, j int) bool {
+		a, b := snapshot.Hallways[i], snapshot.Hallways[j]
+
+		if a.To != b.To {
+			return a.To < b.To
+		} else if a.X != b.X {
+			return a.X < b.X
+		}
+
+		return a.Y < b.Y
+	})
+
+	return snapshot
+}
+
+// Room IDs can have colons in them (like sponsor:<id>), which not every
+// filesystem allows
+func snapshotPath(dir, roomID string) string {
+	return filepath.Join(dir, strings.ReplaceAll(roomID, ":", "-")+".json")
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/techx/playground/db/models"
+)
+
+// Swaps in a different store for the rest of the test
+func useStore(t *testing.T, s *Store) {
+	oldStore := store
+	store = s
+
+	t.Cleanup(func() {
+		store = oldStore
+	})
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "world")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return dir
+}
+
+// Returns a room's elements and hallways as they'd be exported
+func roomContents(t *testing.T, roomID string) *roomSnapshot {
+	snapshot, err := snapshotRoom(roomID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+func TestExportImportWorld(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		useStore(t, s)
+
+		rooms := []struct {
+			room     *models.Room
+			elements []*models.Element
+			hallways []*models.Hallway
+		}{
+			{
+				&models.Room{ID: "home", Background: "home.png"},
+				[]*models.Element{
+					{X: 0.1, Y: 0.2, Width: 0.3, Path: "tree.svg"},
+					{X: 0.5, Y: 0.5, Width: 0.1, Path: "jukebox.svg", Action: int(models.OpenJukebox), Hoverable: true},
+					{X: 0.7, Y: 0.4, Width: 0.1, Path: "lamp.svg,lamp_on.svg", Toggleable: true, State: 1},
+				},
+				[]*models.Hallway{
+					{X: 0.9, Y: 0.5, ToX: 0.1, ToY: 0.5, Radius: 0.05, To: "plaza"},
+					{X: 0.1, Y: 0.5, ToX: 0.9, ToY: 0.5, Radius: 0.05, To: "sponsor:acme"},
+				},
+			},
+			{
+				&models.Room{ID: "sponsor:acme", Background: "sponsor.png", SponsorID: "acme", Corners: "0,0,1,1"},
+				[]*models.Element{
+					{X: 0.5, Y: 0.5, Width: 0.2, Path: "acme.svg", ChangingImagePath: true, ChangingPaths: "a.svg,b.svg", ChangingInterval: 500, ChangingRandomly: true},
+				},
+				[]*models.Hallway{
+					{X: 0.9, Y: 0.5, ToX: 0.1, ToY: 0.5, Radius: 0.05, To: "home"},
+				},
+			},
+		}
+
+		for _, room := range rooms {
+			if err := store.Rooms.Create(room.room, room.elements, room.hallways); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		store.Rooms.AddCharacter("home", "someone")
+
+		before := map[string]*roomSnapshot{}
+
+		for _, room := range rooms {
+			before[room.room.ID] = roomContents(t, room.room.ID)
+		}
+
+		dir := tempDir(t)
+
+		if count, err := ExportWorld(dir); err != nil || count != len(rooms) {
+			t.Fatalf("expected %d rooms to be exported, got %d (%v)", len(rooms), count, err)
+		}
+
+		// Colons aren't allowed in every filesystem
+		if _, err := os.Stat(filepath.Join(dir, "sponsor-acme.json")); err != nil {
+			t.Errorf("expected sponsor:acme to be written to sponsor-acme.json, got %v", err)
+		}
+
+		exported, _ := ioutil.ReadFile(filepath.Join(dir, "home.json"))
+
+		// Change everything that was exported, then import it back
+		store.Rooms.Replace(&models.Room{ID: "home", Background: "changed.png"}, nil, []*models.Hallway{
+			{X: 0.5, Y: 0.5, To: "nowhere"},
+		})
+
+		store.Rooms.Replace(&models.Room{ID: "sponsor:acme", Background: "changed.png"}, []*models.Element{
+			{Path: "changed.svg"},
+		}, nil)
+
+		if count, err := ImportWorld(dir); err != nil || count != len(rooms) {
+			t.Fatalf("expected %d rooms to be imported, got %d (%v)", len(rooms), count, err)
+		}
+
+		for _, room := range rooms {
+			after := roomContents(t, room.room.ID)
+			want := before[room.room.ID]
+
+			if after.Background != want.Background || after.SponsorID != want.SponsorID || after.Corners != want.Corners {
+				t.Errorf("%s: expected %+v, got %+v", room.room.ID, want, after)
+			}
+
+			if len(after.Elements) != len(want.Elements) {
+				t.Fatalf("%s: expected %d elements, got %d", room.room.ID, len(want.Elements), len(after.Elements))
+			}
+
+			for i := range want.Elements {
+				if *after.Elements[i] != *want.Elements[i] {
+					t.Errorf("%s element %d: expected %+v, got %+v", room.room.ID, i, *want.Elements[i], *after.Elements[i])
+				}
+			}
+
+			if len(after.Hallways) != len(want.Hallways) {
+				t.Fatalf("%s: expected %d hallways, got %d", room.room.ID, len(want.Hallways), len(after.Hallways))
+			}
+
+			for i := range want.Hallways {
+				if *after.Hallways[i] != *want.Hallways[i] {
+					t.Errorf("%s hallway %d: expected %+v, got %+v", room.room.ID, i, *want.Hallways[i], *after.Hallways[i])
+				}
+			}
+		}
+
+		// Characters stay where they were
+		if characters, _ := store.Rooms.Characters("home"); !equalStrings(characters, []string{"someone"}) {
+			t.Errorf("expected someone to stay in home, got %v", characters)
+		}
+
+		// Exporting the same world again gives the same files
+		again := tempDir(t)
+		ExportWorld(again)
+
+		if reexported, _ := ioutil.ReadFile(filepath.Join(again, "home.json")); string(reexported) != string(exported) {
+			t.Errorf("expected the same export, got\n%s\ninstead of\n%s", reexported, exported)
+		}
+	})
+}
+
+func TestImportWorldInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"truncated", `{"background": "home.png", "elements": [`},
+		{"wrong type", `{"background": 1}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useStore(t, NewMemoryStore())
+			store.Rooms.Create(&models.Room{ID: "home", Background: "home.png"}, nil, nil)
+
+			dir := tempDir(t)
+			ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"background": "changed.png"}`), 0644)
+			ioutil.WriteFile(filepath.Join(dir, "home.json"), []byte(test.contents), 0644)
+
+			if _, err := ImportWorld(dir); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			// Nothing changes unless every snapshot can be read
+			if exists, _ := store.Rooms.Exists("a"); exists {
+				t.Error("expected no rooms to be imported")
+			}
+
+			if room, _ := store.Rooms.Get("home"); room.Background != "home.png" {
+				t.Errorf("expected home to be left alone, got %+v", room)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package jobs runs slow work (mostly calls to third-party APIs) on a bounded
+// pool of workers so that it never blocks the hub
+package jobs
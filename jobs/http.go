@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewHTTPJob returns a job that sends the request built by newRequest and
+// results in the response body ([]byte). newRequest is called once per
+// attempt, and should build its request with the given context
+func NewHTTPJob(name string, newRequest func(ctx context.Context) (*http.Request, error)) *Job {
+	return &Job{
+		Name: name,
+		Run: func(ctx context.Context) (interface{}, error) {
+			req, err := newRequest(ctx)
+
+			if err != nil {
+				return nil, Permanent(err)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+
+			if err != nil {
+				return nil, err
+			}
+
+			defer res.Body.Close()
+
+			if err := CheckResponse(res); err != nil {
+				return nil, err
+			}
+
+			return ioutil.ReadAll(res.Body)
+		},
+	}
+}
+
+// CheckResponse turns unsuccessful HTTP responses into errors. Client errors
+// are permanent since retrying won't help, server errors can be retried
+func CheckResponse(res *http.Response) error {
+	if res.StatusCode < 400 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s %s returned %s", res.Request.Method, res.Request.URL.Host, res.Status)
+
+	if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+
+	return err
+}
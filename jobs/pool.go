@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrQueueFull is returned by Submit when there are too many pending jobs
+var ErrQueueFull = errors.New("jobs: queue is full")
+
+// NoRetry can be used as a job's Retries to only ever make one attempt, e.g.
+// for requests that aren't safe to repeat
+const NoRetry = -1
+
+// Job is a unit of slow work, e.g. an HTTP request to an external API
+type Job struct {
+	// Used for logging
+	Name string
+
+	// Does the actual work. Run should respect ctx, which is cancelled once
+	// the job's timeout passes
+	Run func(ctx context.Context) (interface{}, error)
+
+	// Called with the outcome once the job succeeds or runs out of retries.
+	// This is called from the goroutine that reads the pool's results, never
+	// from a worker. Optional
+	Done func(result interface{}, err error)
+
+	// How long each attempt may take. Defaults to the pool's timeout
+	Timeout time.Duration
+
+	// How many times to retry after the first attempt fails. Defaults to the
+	// pool's retries
+	Retries int
+}
+
+// Result is sent back to the owner of a pool once a job finishes
+type Result struct {
+	Job   *Job
+	Value interface{}
+	Err   error
+}
+
+// Finish calls the job's Done callback, if it has one
+func (r *Result) Finish() {
+	if r.Job.Done != nil {
+		r.Job.Done(r.Value, r.Err)
+	}
+}
+
+// Pool runs jobs on a fixed number of workers
+type Pool struct {
+	queue   chan *Job
+	results chan<- *Result
+
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// NewPool starts a pool with the given number of workers. Finished jobs are
+// sent to results, which the caller must keep draining
+func NewPool(workers, queueSize int, timeout time.Duration, retries int, results chan<- *Result) *Pool {
+	p := &Pool{
+		queue:   make(chan *Job, queueSize),
+		results: results,
+		timeout: timeout,
+		retries: retries,
+		backoff: 500 * time.Millisecond,
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Submit queues a job without blocking
+func (p *Pool) Submit(job *Job) error {
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		log.Println("ERROR: Dropping job", job.Name, "because the queue is full")
+		return ErrQueueFull
+	}
+}
+
+func (p *Pool) work() {
+	for job := range p.queue {
+		value, err := p.run(job)
+		p.results <- &Result{job, value, err}
+	}
+}
+
+func (p *Pool) run(job *Job) (interface{}, error) {
+	timeout := job.Timeout
+
+	if timeout <= 0 {
+		timeout = p.timeout
+	}
+
+	retries := job.Retries
+
+	if retries == 0 {
+		retries = p.retries
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	var value interface{}
+	var err error
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			// Back off exponentially between attempts
+			time.Sleep(p.backoff << uint(attempt-1))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		value, err = job.Run(ctx)
+		cancel()
+
+		if err == nil {
+			return value, nil
+		}
+
+		var permanent *permanentError
+
+		if errors.As(err, &permanent) {
+			return nil, permanent.err
+		}
+
+		log.Println("ERROR: Job", job.Name, "failed on attempt", attempt+1, "->", err)
+	}
+
+	return nil, err
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error so that the job returning it isn't retried, e.g.
+// when an API rejects our request outright
+func Permanent(err error) error {
+	return &permanentError{err}
+}
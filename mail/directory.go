@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/techx/playground/config"
+)
+
+func init() {
+	Register("directory", func() (Mailer, error) {
+		path := config.GetConfig().GetString("mail.directory.path")
+
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
+
+		return directoryMailer{path}, nil
+	})
+}
+
+// Writes each email to a .eml file instead of sending it, for local
+// development. Most mail clients can open them
+type directoryMailer struct {
+	path string
+}
+
+func (m directoryMailer) Send(ctx context.Context, msg *Message) error {
+	// Keep the recipient in the file name so that emails are easy to find
+	recipient := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@.-_", r) {
+			return r
+		}
+
+		return '_'
+	}, msg.To)
+
+	name := filepath.Join(m.path, time.Now().Format("20060102-150405.000000000")+"-"+recipient+".eml")
+
+	if err := ioutil.WriteFile(name, msg.encode(), 0644); err != nil {
+		return err
+	}
+
+	log.Println("Wrote email to", msg.To, "to", name)
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package mail sends email through whichever backend is set in the config
+// (mail.backend): Amazon SES, an SMTP server, or files in a directory for
+// local development
+package mail
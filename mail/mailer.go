@@ -0,0 +1,133 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/techx/playground/config"
+)
+
+// Message is an email with an HTML body and a plain text fallback
+type Message struct {
+	// Filled in from mail.from and mail.reply_to if they're left empty
+	From    string
+	ReplyTo string
+
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer is a way of sending email
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	mailerMu sync.RWMutex
+
+	// Every backend that could be turned on, keyed by name
+	factories = map[string]func() (Mailer, error){}
+
+	// The backend turned on in the config
+	mailer Mailer
+)
+
+// Register makes a backend available to turn on in mail.backend. newMailer
+// reads the backend's settings from the config, and is only called if it's
+// turned on
+func Register(name string, newMailer func() (Mailer, error)) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+
+	factories[name] = newMailer
+}
+
+// Init sets up the backend named in mail.backend
+func Init() error {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+
+	name := config.GetConfig().GetString("mail.backend")
+	newMailer, ok := factories[name]
+
+	if !ok {
+		return fmt.Errorf("unknown mail backend %s", name)
+	}
+
+	m, err := newMailer()
+
+	if err != nil {
+		return fmt.Errorf("unable to set up mail backend %s: %w", name, err)
+	}
+
+	mailer = m
+	return nil
+}
+
+// Send sends an email through the backend turned on in the config
+func Send(ctx context.Context, msg *Message) error {
+	mailerMu.RLock()
+	m := mailer
+	mailerMu.RUnlock()
+
+	if m == nil {
+		return fmt.Errorf("no mail backend set up")
+	}
+
+	if msg.From == "" {
+		msg.From = config.GetConfig().GetString("mail.from")
+	}
+
+	if msg.ReplyTo == "" {
+		msg.ReplyTo = config.GetConfig().GetString("mail.reply_to")
+	}
+
+	return m.Send(ctx, msg)
+}
+
+// Encodes a message the way it goes over SMTP, as multipart/alternative with
+// both bodies
+func (msg *Message) encode() []byte {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.content))
+		qp.Close()
+	}
+
+	parts.Close()
+
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&data, "To: %s\r\n", msg.To)
+
+	if msg.ReplyTo != "" {
+		fmt.Fprintf(&data, "Reply-To: %s\r\n", msg.ReplyTo)
+	}
+
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&data, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&data, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	data.Write(body.Bytes())
+	return data.Bytes()
+}
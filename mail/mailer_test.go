@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/techx/playground/config"
+)
+
+func TestMain(m *testing.M) {
+	// The config is loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
+	config.Init("test")
+	os.Exit(m.Run())
+}
+
+func TestInit(t *testing.T) {
+	defer config.GetConfig().Set("mail.backend", config.GetConfig().GetString("mail.backend"))
+
+	config.GetConfig().Set("mail.backend", "carrier_pigeon")
+
+	if err := Init(); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestDirectoryMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	defer config.GetConfig().Set("mail.backend", config.GetConfig().GetString("mail.backend"))
+	defer config.GetConfig().Set("mail.directory.path", config.GetConfig().GetString("mail.directory.path"))
+
+	config.GetConfig().Set("mail.backend", "directory")
+	config.GetConfig().Set("mail.directory.path", dir)
+
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Send(context.Background(), &Message{
+		To:      "hacker@example.com",
+		Subject: "Your login code",
+		HTML:    "<p>Your code is <b>123456</b></p>",
+		Text:    "Your code is 123456",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*-hacker@example.com.eml"))
+
+	if len(paths) != 1 {
+		t.Fatalf("expected one email named after its recipient, got %v", paths)
+	}
+
+	dat, _ := ioutil.ReadFile(paths[0])
+
+	// From and Reply-To come from the config when they're left empty
+	for _, expected := range []string{
+		"From: " + config.GetConfig().GetString("mail.from") + "\r\n",
+		"Reply-To: " + config.GetConfig().GetString("mail.reply_to") + "\r\n",
+		"To: hacker@example.com\r\n",
+		"Subject: Your login code\r\n",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Type: text/html; charset=UTF-8",
+		"Your code is 123456",
+	} {
+		if !strings.Contains(string(dat), expected) {
+			t.Errorf("expected the email to contain %q, got\n%s", expected, dat)
+		}
+	}
+}
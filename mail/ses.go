@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/techx/playground/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+// The character encoding for emails sent through SES
+const charSet = "UTF-8"
+
+func init() {
+	Register("ses", func() (Mailer, error) {
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(config.GetConfig().GetString("mail.ses.region")),
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return sesMailer{ses.New(sess)}, nil
+	})
+}
+
+// Sends email through Amazon SES, with credentials from the usual AWS
+// environment variables or config files
+type sesMailer struct {
+	svc *ses.SES
+}
+
+func (m sesMailer) Send(ctx context.Context, msg *Message) error {
+	input := &ses.SendEmailInput{
+		Destination: &ses.Destination{
+			CcAddresses: []*string{},
+			ToAddresses: []*string{
+				aws.String(msg.To),
+			},
+		},
+		Message: &ses.Message{
+			Body: &ses.Body{
+				Html: &ses.Content{
+					Charset: aws.String(charSet),
+					Data:    aws.String(msg.HTML),
+				},
+				Text: &ses.Content{
+					Charset: aws.String(charSet),
+					Data:    aws.String(msg.Text),
+				},
+			},
+			Subject: &ses.Content{
+				Charset: aws.String(charSet),
+				Data:    aws.String(msg.Subject),
+			},
+		},
+		Source: aws.String(msg.From),
+	}
+
+	if msg.ReplyTo != "" {
+		input.ReplyToAddresses = []*string{aws.String(msg.ReplyTo)}
+	}
+
+	_, err := m.svc.SendEmailWithContext(ctx, input)
+	return err
+}
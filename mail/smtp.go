@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+
+	"github.com/techx/playground/config"
+)
+
+func init() {
+	Register("smtp", func() (Mailer, error) {
+		addr := config.GetConfig().GetString("mail.smtp.addr")
+		host, _, err := net.SplitHostPort(addr)
+
+		if err != nil {
+			return nil, errors.New("mail.smtp.addr should be a host:port")
+		}
+
+		var auth smtp.Auth
+
+		if username := config.GetConfig().GetString("mail.smtp.username"); username != "" {
+			auth = smtp.PlainAuth("", username, config.GetSecret(config.SMTPPassword), host)
+		}
+
+		return smtpMailer{addr, auth}, nil
+	})
+}
+
+// Sends email through an SMTP server, logging in with mail.smtp.username and
+// SMTP_PASSWORD if a username is set
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+func (m smtpMailer) Send(ctx context.Context, msg *Message) error {
+	// net/smtp can't be cancelled, so at least don't start if it's too late
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(msg.From)
+
+	if err != nil {
+		return err
+	}
+
+	to, err := mail.ParseAddress(msg.To)
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{to.Address}, msg.encode())
+}
@@ -0,0 +1,60 @@
+// Package metrics holds the Prometheus metrics that the hub and database
+// report. Everything here is registered with the default registry, which the
+// server exposes at /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "playground"
+
+var (
+	// PacketsReceived counts packets from clients, by type. Packets with
+	// unknown types aren't counted, so that clients can't make up labels
+	PacketsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "packets_received_total",
+		Help:      "Packets received from clients, by type.",
+	}, []string{"type"})
+
+	// PacketDuration is how long the hub takes to handle each type of packet
+	PacketDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "packet_duration_seconds",
+		Help:      "Time spent handling packets from clients, by type.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"type"})
+
+	// RedisPipelineDuration is how long each Redis pipeline (or transaction)
+	// takes, from sending the commands to reading the last reply
+	RedisPipelineDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "redis_pipeline_duration_seconds",
+		Help:      "Round trip time of Redis pipelines and transactions.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	})
+
+	// StreamMessagesReceived counts packets from other ingests, by the kind
+	// of channel they came in on (room, character, or all)
+	StreamMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "stream_messages_received_total",
+		Help:      "Packets received from other ingests, by kind of channel.",
+	}, []string{"channel"})
+
+	// Leader is 1 while this ingest holds the leader lease
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "leader",
+		Help:      "Whether this ingest is the leader.",
+	})
+)
+
+// NewDesc describes a metric that's collected on demand, with the same
+// namespace as the rest
+func NewDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", name), help, labels, nil)
+}
@@ -0,0 +1,4 @@
+// Package permissions decides what each character is allowed to do. Roles are
+// granted named capabilities in the config (permissions.roles), and organizers
+// can grant or deny capabilities to individual characters on top of that
+package permissions
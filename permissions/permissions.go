@@ -0,0 +1,137 @@
+package permissions
+
+import (
+	"log"
+	"strings"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+)
+
+// Capabilities that characters can be granted. Some are scoped to one thing,
+// like a sponsor or a room, and are made with the functions below
+const (
+	// Add, change, and remove rooms, elements, and hallways
+	WorldEdit = "world.edit"
+
+	// Let new emails log in as sponsors, mentors, or organizers
+	LoginsManage = "logins.manage"
+
+	// Revoke every token a character has and disconnect them
+	SessionsRevoke = "sessions.revoke"
+
+	// Grant or deny capabilities to individual characters
+	PermissionsManage = "permissions.manage"
+
+	// Take songs off the jukebox queue
+	JukeboxRemove = "jukebox.remove"
+
+	// Add songs to the jukebox without waiting for the cooldown
+	JukeboxSkipCooldown = "jukebox.skip_cooldown"
+
+	// Get in line to talk to sponsors
+	QueueJoin = "queue.join"
+
+	// Get in line to talk to sponsors without being a college student
+	QueueSkipCollegeCheck = "queue.skip_college_check"
+
+	// Look through packet logs over HTTP
+	LogsRead = "logs.read"
+)
+
+// QueueManage lets someone take hackers off a sponsor's queue and move them
+// around in it
+func QueueManage(sponsorID string) string {
+	return "queue.manage:" + sponsorID
+}
+
+// SponsorsEdit lets someone change a sponsor's details and open or close its
+// queue
+func SponsorsEdit(sponsorID string) string {
+	return "sponsors.edit:" + sponsorID
+}
+
+// RoomsEnter lets someone into a room that's normally restricted (e.g. the
+// nightclub is only for college students)
+func RoomsEnter(roomID string) string {
+	return "rooms.enter:" + roomID
+}
+
+// Can returns true if this character is allowed to do something. Capabilities
+// granted or denied to them directly win over the ones their role gets
+func Can(character *models.Character, capability string) bool {
+	if character == nil || character.ID == "" {
+		return false
+	}
+
+	overrides, err := db.GetStore().Characters.Capabilities(character.ID)
+
+	if err != nil {
+		log.Println("ERROR: Unable to load capabilities for", character.ID, "->", err)
+	}
+
+	// If both a grant and a denial match, the denial wins
+	granted := false
+	overridden := false
+
+	for grant, allowed := range overrides {
+		if matches(grant, capability) {
+			overridden = true
+
+			if !allowed {
+				return false
+			}
+
+			granted = true
+		}
+	}
+
+	if overridden {
+		return granted
+	}
+
+	for _, grant := range RoleCapabilities(models.Role(character.Role)) {
+		if matches(expand(grant, character), capability) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoleCapabilities returns the capabilities everyone with this role gets, from
+// permissions.roles.<role> in the config
+func RoleCapabilities(role models.Role) []string {
+	return config.GetConfig().GetStringSlice("permissions.roles." + role.String())
+}
+
+// Fills in the placeholders that grants can use to refer to the character
+// they're for. Returns "" if the character doesn't have what the placeholder
+// refers to, e.g. "{sponsorId}" for someone who isn't a sponsor rep
+func expand(grant string, character *models.Character) string {
+	if strings.Contains(grant, "{sponsorId}") {
+		if character.SponsorID == "" {
+			return ""
+		}
+
+		grant = strings.Replace(grant, "{sponsorId}", character.SponsorID, -1)
+	}
+
+	return grant
+}
+
+// Returns true if a grant covers a capability. Grants that end in "*" cover
+// every capability that starts with what comes before it, so "rooms.enter:*"
+// covers every room, and "*" covers everything
+func matches(grant, capability string) bool {
+	if grant == "" {
+		return false
+	}
+
+	if strings.HasSuffix(grant, "*") {
+		return strings.HasPrefix(capability, strings.TrimSuffix(grant, "*"))
+	}
+
+	return grant == capability
+}
@@ -0,0 +1,157 @@
+package permissions
+
+import (
+	"os"
+	"testing"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// The config is loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
+	config.Init("test")
+	config.GetConfig().Set("db.backend", "memory")
+	db.Init(false)
+
+	os.Exit(m.Run())
+}
+
+// Returns a new character with this role. The store is shared between tests,
+// so every character gets a fresh ID
+func newTestCharacter(role models.Role, sponsorID string) *models.Character {
+	return &models.Character{
+		ID:        uuid.New().String(),
+		Role:      int(role),
+		SponsorID: sponsorID,
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		grant      string
+		capability string
+		matches    bool
+	}{
+		{"world.edit", "world.edit", true},
+		{"world.edit", "world.edits", false},
+		{"rooms.enter:nightclub", "rooms.enter:nightclub", true},
+		{"rooms.enter:nightclub", "rooms.enter:arena", false},
+		{"rooms.enter:*", "rooms.enter:nightclub", true},
+		{"rooms.enter:*", "rooms.edit:nightclub", false},
+		{"*", "anything", true},
+
+		// Grants that couldn't be filled in don't match anything
+		{"", "", false},
+		{"", "world.edit", false},
+	}
+
+	for _, test := range tests {
+		if matches := matches(test.grant, test.capability); matches != test.matches {
+			t.Errorf("%q covering %q: expected %v, got %v", test.grant, test.capability, test.matches, matches)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		grant     string
+		sponsorID string
+		expanded  string
+	}{
+		{"world.edit", "", "world.edit"},
+		{"queue.manage:{sponsorId}", "acme", "queue.manage:acme"},
+		{"queue.manage:{sponsorId}", "", ""},
+	}
+
+	for _, test := range tests {
+		character := newTestCharacter(models.SponsorRep, test.sponsorID)
+
+		if expanded := expand(test.grant, character); expanded != test.expanded {
+			t.Errorf("%q for %q: expected %q, got %q", test.grant, test.sponsorID, test.expanded, expanded)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name       string
+		character  *models.Character
+		capability string
+		can        bool
+	}{
+		{"hacker joining a queue", newTestCharacter(models.Hacker, ""), QueueJoin, true},
+		{"hacker editing the world", newTestCharacter(models.Hacker, ""), WorldEdit, false},
+		{"organizer editing the world", newTestCharacter(models.Organizer, ""), WorldEdit, true},
+		{"organizer entering a room", newTestCharacter(models.Organizer, ""), RoomsEnter("nightclub"), true},
+		{"organizer editing a sponsor", newTestCharacter(models.Organizer, ""), SponsorsEdit("acme"), true},
+		{"organizer managing a queue", newTestCharacter(models.Organizer, ""), QueueManage("acme"), true},
+		{"rep managing their queue", newTestCharacter(models.SponsorRep, "acme"), QueueManage("acme"), true},
+		{"rep editing their sponsor", newTestCharacter(models.SponsorRep, "acme"), SponsorsEdit("acme"), true},
+		{"rep managing another queue", newTestCharacter(models.SponsorRep, "acme"), QueueManage("other"), false},
+		{"rep without a sponsor", newTestCharacter(models.SponsorRep, ""), QueueManage(""), false},
+		{"guest joining a queue", newTestCharacter(models.Guest, ""), QueueJoin, false},
+		{"nobody", nil, QueueJoin, false},
+		{"character without an ID", &models.Character{Role: int(models.Organizer)}, WorldEdit, false},
+	}
+
+	for _, test := range tests {
+		if can := Can(test.character, test.capability); can != test.can {
+			t.Errorf("%s: expected %v, got %v", test.name, test.can, can)
+		}
+	}
+}
+
+func TestCanOverrides(t *testing.T) {
+	characters := db.GetStore().Characters
+
+	tests := []struct {
+		name       string
+		role       models.Role
+		overrides  map[string]bool
+		capability string
+		can        bool
+	}{
+		{"granted", models.Mentor, map[string]bool{RoomsEnter("nightclub"): true}, RoomsEnter("nightclub"), true},
+		{"granted something else", models.Mentor, map[string]bool{RoomsEnter("nightclub"): true}, RoomsEnter("arena"), false},
+		{"granted with a wildcard", models.Mentor, map[string]bool{"rooms.enter:*": true}, RoomsEnter("arena"), true},
+		{"denied", models.Hacker, map[string]bool{QueueJoin: false}, QueueJoin, false},
+		{"denied something else", models.Hacker, map[string]bool{JukeboxRemove: false}, QueueJoin, true},
+		{"denied what their role grants", models.Organizer, map[string]bool{"rooms.enter:*": false}, RoomsEnter("nightclub"), false},
+
+		// Denials win over grants, no matter which is more specific
+		{"granted and denied", models.Mentor, map[string]bool{"rooms.enter:*": true, RoomsEnter("nightclub"): false}, RoomsEnter("nightclub"), false},
+		{"denied and granted", models.Mentor, map[string]bool{"rooms.enter:*": false, RoomsEnter("nightclub"): true}, RoomsEnter("nightclub"), false},
+		{"granted, with another denied", models.Mentor, map[string]bool{"rooms.enter:*": true, RoomsEnter("nightclub"): false}, RoomsEnter("arena"), true},
+	}
+
+	for _, test := range tests {
+		character := newTestCharacter(test.role, "")
+
+		for capability, granted := range test.overrides {
+			if err := characters.SetCapability(character.ID, capability, granted); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if can := Can(character, test.capability); can != test.can {
+			t.Errorf("%s: expected %v, got %v", test.name, test.can, can)
+		}
+	}
+
+	// Clearing an override goes back to what the role says
+	character := newTestCharacter(models.Hacker, "")
+	characters.SetCapability(character.ID, QueueJoin, false)
+	characters.ClearCapability(character.ID, QueueJoin)
+
+	if !Can(character, QueueJoin) {
+		t.Error("expected the role's capabilities once the override is cleared")
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/socket"
+)
+
+// How long the hub has to answer a health check
+const hubCheckTimeout = 2 * time.Second
+
+// The result of each check, along with whether all of them passed
+type healthStatus struct {
+	OK       bool   `json:"ok"`
+	Hub      string `json:"hub"`
+	Redis    string `json:"redis,omitempty"`
+	Draining bool   `json:"draining,omitempty"`
+}
+
+// Liveness: the hub is still running. Redis being down doesn't make this ingest
+// any better off after a restart, so it's left to the readiness check
+func healthz(hub *socket.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := healthStatus{Hub: checkHub(hub)}
+		status.OK = status.Hub == "ok"
+		writeHealth(w, status)
+	}
+}
+
+// Readiness: the hub is running, Redis is reachable, and we aren't shutting
+// down, so load balancers can send new clients here
+func readyz(hub *socket.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := healthStatus{
+			Hub:      checkHub(hub),
+			Redis:    "ok",
+			Draining: hub.Draining(),
+		}
+
+		if err := db.Ping(); err != nil {
+			status.Redis = err.Error()
+		}
+
+		status.OK = status.Hub == "ok" && status.Redis == "ok" && !status.Draining
+		writeHealth(w, status)
+	}
+}
+
+func checkHub(hub *socket.Hub) string {
+	if !hub.Alive(hubCheckTimeout) {
+		return "not responding"
+	}
+
+	return "ok"
+}
+
+func writeHealth(w http.ResponseWriter, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !status.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
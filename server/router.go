@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/techx/playground/controllers"
+	"github.com/techx/playground/permissions"
 	"github.com/techx/playground/socket"
 
 	"github.com/labstack/echo/v4"
@@ -37,5 +38,9 @@ func newRouter(hub *socket.Hub) *echo.Echo {
 	room := new(controllers.RoomController)
 	e.GET("/rooms", room.GetRooms)
 
+	// Logs controller
+	logs := new(controllers.LogController)
+	e.GET("/logs", logs.GetLogs, controllers.RequireCapability(permissions.LogsRead))
+
 	return e
 }
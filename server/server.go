@@ -1,11 +1,20 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/techx/playground/config"
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/socket"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func Init(port string) {
@@ -14,10 +23,11 @@ func Init(port string) {
 	// Wait for socket messages
 	go hub.Run()
 
-	// Listen for events from other ingest servers
+	// Listen for events from other ingest servers (or, without Redis, from
+	// our own leader tasks)
 	go db.ListenForUpdates(hub.ProcessRedisMessage)
 
-	// Check if we're the leader and do things if so
+	// Send heartbeats, and run leader tasks while we hold the leader lease
 	go db.MonitorLeader()
 
 	// Websocket connection endpoint
@@ -25,17 +35,58 @@ func Init(port string) {
 		socket.ServeWs(hub, w, r)
 	})
 
+	// Health checks for load balancers
+	http.HandleFunc("/healthz", healthz(hub))
+	http.HandleFunc("/readyz", readyz(hub))
+
+	// Prometheus metrics
+	http.Handle("/metrics", promhttp.Handler())
+
 	// REST endpoints
 	r := newRouter(hub)
 	http.Handle("/", r)
 
-	addr := ":" + port
+	srv := &http.Server{Addr: ":" + port}
+	stopped := make(chan struct{})
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		<-signals
+
+		shutdown(srv, hub)
+		close(stopped)
+	}()
 
 	// Start the server
-	fmt.Println("Serving at", addr)
-	err := http.ListenAndServe(addr, nil)
+	fmt.Println("Serving at", srv.Addr)
+	err := srv.ListenAndServe()
 
-	if err != nil {
+	if err != http.ErrServerClosed {
 		panic(err)
 	}
+
+	<-stopped
+}
+
+// Sends every client to another ingest, and cleans up after this one in the
+// database, before the server stops
+func shutdown(srv *http.Server, hub *socket.Hub) {
+	timeout := time.Duration(config.GetConfig().GetInt("socket.drain.timeout_seconds")) * time.Second
+	log.Println("Shutting down, draining clients for up to", timeout)
+
+	hub.Drain(timeout)
+
+	if err := db.Deregister(); err != nil {
+		log.Println("ERROR: Unable to deregister ingest ->", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("ERROR: Unable to shut down server ->", err)
+	}
+
+	log.Println("Shut down")
 }
@@ -1,7 +1,11 @@
 package socket
 
 import (
+	"sync"
+
+	"github.com/techx/playground/config"
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/wire"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -11,24 +15,100 @@ import (
 type Client struct {
 	hub *Hub
 
-	// The websocket connection.
+	// The websocket connection. Swapped out when the client resumes their
+	// session, so guarded by sendMu
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages.
+	// Buffered channel of outbound messages. Replaced along with conn, so
+	// guarded by sendMu
 	send chan []byte
 
+	// The format this client wants packets in
+	format wire.Format
+
+	// Closed once the current connection's read pump exits, which tells its
+	// write pump to stop too. Guarded by sendMu
+	done chan struct{}
+
 	// ID uniquely identifying this client
 	id string
 
 	// This client's character
 	character *models.Character
+
+	// The room this client is indexed under. Guarded by the hub's mu
+	room string
+
+	// Held while processing this client's messages, so that they never run
+	// concurrently even if the client switches rooms
+	mu sync.Mutex
+
+	// True while we're looking up a song they added on YouTube
+	pendingSong bool
+
+	// How fast this client has been sending packets. Guarded by mu
+	limiter rateLimiter
+
+	// The protocol version and capabilities we agreed on when the client
+	// joined. Guarded by mu
+	protocolVersion int
+	capabilities    map[string]bool
+
+	// What to do when this client can't keep up with the packets we send them
+	policy SlowConsumerPolicy
+
+	// Set to 1 once we've started closing this client's connection
+	closing int32
+
+	// Identifies this client's session so that they can resume it after
+	// reconnecting
+	sessionID string
+
+	// Held while sending to this client, so that packets are numbered in the
+	// same order that they're queued. Guards everything below
+	sendMu sync.Mutex
+
+	// Sequence number of the last packet we queued for this client
+	seq uint64
+
+	// Recent packets that this client would need again if they reconnected,
+	// and the highest sequence number that has fallen out of it
+	replay     []sequencedMessage
+	evictedSeq uint64
+
+	// True once this client has joined, so their session is worth keeping
+	// around if their connection drops
+	resumable bool
+
+	// True while this client's connection is down but their session hasn't
+	// expired yet
+	parked bool
+
+	// Bumped whenever this client parks or resumes, so that timers from an
+	// earlier disconnect know to leave them alone
+	generation int
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn) *Client {
 	c := new(Client)
 	c.hub = hub
 	c.conn = conn
-	c.send = make(chan []byte, 4096)
+	c.send = make(chan []byte, config.GetConfig().GetInt("socket.send_queue_size"))
+	c.format = wire.FormatForSubprotocol(conn.Subprotocol())
+	c.done = make(chan struct{})
 	c.id = uuid.New().String()
+	c.sessionID = uuid.New().String()
+	c.policy = slowConsumerPolicy(models.Guest)
 	return c
 }
+
+// ID returns the ID uniquely identifying this client
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Character returns this client's character, or nil if they haven't
+// authenticated yet
+func (c *Client) Character() *models.Character {
+	return c.character
+}
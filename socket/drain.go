@@ -0,0 +1,109 @@
+package socket
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/techx/playground/socket/packet"
+
+	"github.com/gorilla/websocket"
+)
+
+// How often we check whether clients have been sent their reconnect packets
+const drainPollInterval = 50 * time.Millisecond
+
+// Drain gets this ingest ready to shut down. New connections are turned away,
+// and every client is told to reconnect elsewhere and then disconnected, so
+// that their characters leave their rooms now instead of whenever the leader
+// notices this ingest is gone. Gives up waiting on clients after timeout
+func (h *Hub) Drain(timeout time.Duration) {
+	atomic.StoreInt32(&h.draining, 1)
+	deadline := time.Now().Add(timeout)
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+
+	h.mu.RUnlock()
+
+	data, _ := packet.NewReconnectPacket("shutdown").MarshalBinary()
+	out := newOutgoing(data)
+
+	for _, client := range clients {
+		h.deliver(client, out, false)
+	}
+
+	// Give write pumps a chance to get the reconnect packet out before the
+	// connections close
+	for time.Now().Before(deadline) && sendsPending(clients) {
+		time.Sleep(drainPollInterval)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, client := range clients {
+		client := client
+		wg.Add(1)
+
+		h.runForClient(client, func() {
+			defer wg.Done()
+			h.closeClient(client, websocket.CloseGoingAway, "shutting down")
+		})
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline)):
+	}
+}
+
+// Draining returns true once this ingest has started shutting down
+func (h *Hub) Draining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// Returns true if any of these clients still have packets waiting to go out
+func sendsPending(clients []*Client) bool {
+	for _, client := range clients {
+		client.sendMu.Lock()
+		pending := !client.parked && len(client.send) > 0
+		client.sendMu.Unlock()
+
+		if pending {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Alive returns true if the hub is still handing finished jobs back to rooms,
+// and isn't stuck waiting on its own lock
+func (h *Hub) Alive(timeout time.Duration) bool {
+	probe := make(chan struct{})
+	expired := time.After(timeout)
+
+	select {
+	case h.probes <- probe:
+	case <-expired:
+		return false
+	}
+
+	select {
+	case <-probe:
+		return true
+	case <-expired:
+		return false
+	}
+}
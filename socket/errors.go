@@ -0,0 +1,74 @@
+package socket
+
+import (
+	"github.com/techx/playground/socket/packet"
+)
+
+type ErrorCode int
+
+const (
+	BadLogin ErrorCode = iota + 1
+	HighSchoolNightClub
+	MissingProjectForm
+	HighSchoolSponsorQueue
+	MissingSurveyResponse
+	NonMitMisti
+	RateLimited
+	NotAdmitted
+	InvalidCharacters
+	SongNotFound
+	ServerError
+	IncompatibleProtocol
+	ServerBusy
+)
+
+// The jukebox errors came first, and the frontend still expects these values
+const (
+	SongTooLong     ErrorCode = 400
+	JukeboxCooldown ErrorCode = 401
+)
+
+type errorDetails struct {
+	// Machine-readable reason, for the frontend to switch on
+	reason string
+
+	// Something we can show the user
+	message string
+}
+
+var errorMessages = map[ErrorCode]errorDetails{
+	BadLogin:               {"bad_login", "We couldn't log you in. Please try again."},
+	HighSchoolNightClub:    {"high_school_nightclub", "Only college students can enter the nightclub."},
+	MissingProjectForm:     {"missing_project_form", "Please fill out the project form first."},
+	HighSchoolSponsorQueue: {"high_school_sponsor_queue", "Only college students can join sponsor queues."},
+	MissingSurveyResponse:  {"missing_survey_response", "Please fill out the project survey before entering the arena."},
+	NonMitMisti:            {"non_mit_misti", "Only MIT students can enter MISTI."},
+	RateLimited:            {"rate_limited", "You're doing that too much. Please slow down."},
+	NotAdmitted:            {"not_admitted", "Only admitted and confirmed hackers can enter Playground."},
+	InvalidCharacters:      {"invalid_characters", "Messages can only contain ASCII characters."},
+	SongNotFound:           {"song_not_found", "We couldn't find that song on YouTube."},
+	ServerError:            {"server_error", "Something went wrong. Please try again."},
+	IncompatibleProtocol:   {"incompatible_protocol", "Playground has been updated! Please refresh the page."},
+	ServerBusy:             {"server_busy", "Playground is busy right now. Please try again in a minute."},
+	SongTooLong:            {"song_too_long", "Songs have to be shorter than 6 minutes."},
+	JukeboxCooldown:        {"jukebox_cooldown", "You can only add a song to the jukebox every 15 minutes."},
+}
+
+// Sends an error back to the client who sent this message, tagged with its
+// request ID. The reason and message only go to clients that negotiated
+// error_reasons, or that haven't joined yet and so haven't had the chance to
+func (h *Hub) sendError(m *SocketMessage, code ErrorCode) {
+	details := errorMessages[code]
+
+	errorPacket := packet.NewErrorPacket(int(code), details.reason, details.message)
+	errorPacket.RequestID = m.requestID
+
+	if m.sender.joined() && !m.sender.Supports(errorReasonsCapability) {
+		// Older frontends only know about codes
+		errorPacket.Reason = ""
+		errorPacket.Message = ""
+	}
+
+	data, _ := errorPacket.MarshalBinary()
+	h.sendTo(m.sender, data)
+}
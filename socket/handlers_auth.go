@@ -0,0 +1,384 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/techx/playground/auth"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/jobs"
+	"github.com/techx/playground/socket/packet"
+	"github.com/techx/playground/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+func init() {
+	RegisterPacket(PacketHandler{
+		Types:  []string{"auth", "join"},
+		Decode: packet.NewDecoder(packet.JoinPacket{}),
+		Handle: (*Hub).handleJoin,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"logout"},
+		Decode: packet.NewDecoder(packet.LogoutPacket{}),
+		Handle: (*Hub).handleLogout,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"revoke_sessions"},
+		Decode: packet.NewDecoder(packet.RevokeSessionsPacket{}),
+		Handle: (*Hub).handleRevokeSessions,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"set_capability"},
+		Decode: packet.NewDecoder(packet.SetCapabilityPacket{}),
+		Handle: (*Hub).handleSetCapability,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"email_code"},
+		Decode: packet.NewDecoder(packet.EmailCodePacket{}),
+		Handle: (*Hub).handleEmailCode,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"add_email"},
+		Decode: packet.NewDecoder(packet.AddEmailPacket{}),
+		Handle: (*Hub).handleAddEmail,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"register"},
+		Decode: packet.NewDecoder(packet.RegisterPacket{}),
+		Handle: (*Hub).handleRegister,
+	})
+}
+
+func (h *Hub) handleJoin(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.JoinPacket)
+
+	// Type auth is used when the character is just connecting to the socket, but not actually
+	// joining a room. This is useful in limited circumstances, e.g. recording event attendance
+
+	if !h.negotiateProtocol(m, p) {
+		return
+	}
+
+	creds := &auth.Credentials{
+		Provider:     p.Provider,
+		Token:        p.Token,
+		RefreshToken: p.RefreshToken,
+		QuillToken:   p.QuillToken,
+		Email:        p.Email,
+		Code:         p.Code,
+		IDToken:      p.IDToken,
+	}
+
+	if p.Type == "auth" {
+		// New tokens only go out in the init packet, which auth packets don't
+		// get, so a refresh token used here would be used up for nothing
+		creds.RefreshToken = ""
+	}
+
+	provider, ok := auth.Find(creds)
+
+	if !ok {
+		if p.RefreshToken != "" {
+			// Tell them to join instead
+			h.sendError(m, BadLogin)
+		}
+
+		// Client provided no authentication data we can use
+		return
+	}
+
+	if !provider.Remote() {
+		identity, err := provider.Authenticate(context.Background(), creds)
+		h.joinWithIdentity(m, p, provider.Name(), identity, err)
+		return
+	}
+
+	// Providers that call out to other services can be slow, so check with
+	// them in the background
+	job := &jobs.Job{
+		Name: provider.Name() + "_login",
+		Run: func(ctx context.Context) (interface{}, error) {
+			identity, err := provider.Authenticate(ctx, creds)
+
+			if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrNotAdmitted) {
+				// Asking again won't change the answer
+				return nil, jobs.Permanent(err)
+			}
+
+			return identity, err
+		},
+	}
+
+	job.Done = func(result interface{}, err error) {
+		if !h.isConnected(m.sender) {
+			return
+		}
+
+		identity, _ := result.(*auth.Identity)
+		h.joinWithIdentity(m, p, provider.Name(), identity, err)
+	}
+
+	h.submitJob(m, job)
+}
+
+// Loads (or creates) the character for someone once their provider has said
+// who they are
+func (h *Hub) joinWithIdentity(m *SocketMessage, p packet.JoinPacket, provider string, identity *auth.Identity, err error) {
+	if errors.Is(err, auth.ErrNotAdmitted) {
+		// Don't allow non-admitted hackers to access Playground
+		h.sendError(m, NotAdmitted)
+		return
+	} else if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.sendError(m, BadLogin)
+		return
+	} else if err != nil {
+		log.Println("ERROR: Unable to log in with", provider, "->", err)
+		h.sendError(m, ServerError)
+		return
+	}
+
+	character, firstTime, err := auth.Login(provider, identity)
+
+	if err != nil {
+		h.sendError(m, BadLogin)
+		return
+	}
+
+	h.finishJoin(m, p, character, firstTime)
+}
+
+// Adds an authenticated character to this ingest and, for join packets, to
+// their room
+func (h *Hub) finishJoin(m *SocketMessage, p packet.JoinPacket, character *models.Character, firstTime bool) {
+	// Make sure character ID isn't an empty string
+	if character.ID == "" {
+		fmt.Println("ERROR: Empty character ID on join")
+		return
+	}
+
+	var initPacket *packet.InitPacket
+
+	if p.Type == "join" {
+		// Generate init packet before new character is added to room
+		initPacket = packet.NewInitPacket(character.ID, character.Room, true)
+		initPacket.FirstTime = firstTime
+
+		// Add to whatever room they were in
+		db.GetStore().Rooms.AddCharacter(character.Room, character.ID)
+	}
+
+	// Mark this character as online on this ingest
+	character.Ingest = db.GetIngestID()
+	db.GetStore().Characters.Connect(character.ID, character.Ingest)
+
+	// Tell their friends that they're online now
+	statusRes := packet.NewStatusPacket(character.ID, true)
+	statusRes.FriendIDs, _ = db.GetStore().Friends.Friends(character.ID)
+	statusRes.TeammateIDs, _ = db.GetStore().Friends.Teammates(character.ID)
+	h.Send(statusRes)
+
+	// Authenticate the user on our end
+	h.setCharacter(m.sender, character)
+
+	if p.Type == "join" {
+		// Make sure SSO token is omitted from join packet that is sent to clients
+		p.Name = ""
+		p.Provider = ""
+		p.QuillToken = ""
+		p.Token = ""
+		p.RefreshToken = ""
+		p.Email = ""
+		p.Code = 0
+		p.IDToken = ""
+		p.ProtocolVersion = 0
+		p.Capabilities = nil
+
+		// Send them the relevant init packet
+		initPacket.Capabilities = m.sender.capabilityList()
+		data, _ := initPacket.MarshalBinary()
+		h.sendTo(m.sender, data)
+
+		// Send the join packet to clients and Redis
+		p.Character = character
+		p.ClientID = m.sender.id
+		p.Room = character.Room
+
+		if strings.HasPrefix(p.Room, "arena:") {
+			p.SetProject()
+		}
+
+		h.Send(p)
+
+		// Hold on to them for a bit if their connection drops
+		h.enableResume(m.sender)
+	}
+}
+
+func (h *Hub) handleLogout(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.LogoutPacket)
+
+	// Revoke whichever of their own tokens they sent us, so that nobody else
+	// can log in with them later
+	if p.Token != "" {
+		if claims, err := auth.ParseToken(p.Token); err == nil && claims.CharacterID == m.sender.character.ID {
+			auth.Revoke(claims)
+		}
+	}
+
+	if p.RefreshToken != "" {
+		if claims, err := auth.ParseRefreshToken(p.RefreshToken); err == nil && claims.CharacterID == m.sender.character.ID {
+			auth.Revoke(claims)
+		}
+	}
+
+	data, _ := packet.NewLogoutPacket("", "logout").MarshalBinary()
+	h.sendAndClose(m.sender, data, websocket.CloseNormalClosure, "logout")
+}
+
+func (h *Hub) handleRevokeSessions(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.RevokeSessionsPacket)
+
+	if err := auth.RevokeAll(p.CharacterID); err != nil {
+		log.Println("ERROR: Unable to revoke sessions for", p.CharacterID, "->", err)
+		h.sendError(m, ServerError)
+		return
+	}
+
+	// Disconnect them from every ingest they're on
+	h.Send(packet.NewLogoutPacket(p.CharacterID, "revoked"))
+}
+
+func (h *Hub) handleSetCapability(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.SetCapabilityPacket)
+
+	if p.CharacterID == "" || p.Capability == "" {
+		return
+	}
+
+	var err error
+
+	if p.Granted == nil {
+		err = db.GetStore().Characters.ClearCapability(p.CharacterID, p.Capability)
+	} else {
+		err = db.GetStore().Characters.SetCapability(p.CharacterID, p.Capability, *p.Granted)
+	}
+
+	if err != nil {
+		log.Println("ERROR: Unable to set", p.Capability, "for", p.CharacterID, "->", err)
+		h.sendError(m, ServerError)
+	}
+}
+
+func (h *Hub) handleEmailCode(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.EmailCodePacket)
+
+	p.Email = strings.ToLower(p.Email)
+
+	isValidEmail := false
+	name := "mentor"
+	// Make sure this email exists in our database
+	switch models.Role(p.Role) {
+	case models.SponsorRep:
+		isValidEmail, _ = db.GetStore().Logins.HasEmail(models.SponsorRep, p.Email)
+		name = "sponsor"
+	case models.Mentor, models.Organizer:
+		isValidEmail, _ = db.GetStore().Logins.HasEmail(models.Role(p.Role), p.Email)
+	default:
+		break
+	}
+
+	if !isValidEmail {
+		return
+	}
+
+	code, err := auth.IssueCode(p.Email)
+
+	if err == auth.ErrTooManyCodes {
+		h.sendError(m, RateLimited)
+		return
+	} else if err != nil {
+		log.Println("ERROR: Unable to issue login code ->", err)
+		h.sendError(m, ServerError)
+		return
+	}
+
+	// Send email to person trying to log in
+	h.submitJob(m, &jobs.Job{
+		Name: "confirmation_email",
+		Run: func(ctx context.Context) (interface{}, error) {
+			return nil, utils.SendConfirmationEmail(ctx, p.Email, code, name)
+		},
+		// A timeout doesn't mean the email wasn't sent, so don't risk sending
+		// it twice
+		Retries: jobs.NoRetry,
+	})
+}
+
+func (h *Hub) handleAddEmail(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.AddEmailPacket)
+
+	switch models.Role(p.Role) {
+	case models.SponsorRep, models.Mentor, models.Organizer:
+		db.GetStore().Logins.AddEmail(models.Role(p.Role), strings.ToLower(strings.TrimSpace(p.Email)), p.SponsorID)
+	default:
+		break
+	}
+}
+
+func (h *Hub) handleRegister(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.RegisterPacket)
+
+	fields := map[string]interface{}{}
+
+	if p.Name != "" {
+		if m.sender.character.Role == int(models.Organizer) {
+			p.Name += " (Blueprint)"
+		} else if m.sender.character.Role == int(models.SponsorRep) {
+			if sponsor, err := db.GetStore().Sponsors.Get(m.sender.character.SponsorID); err == nil {
+				p.Name += " (" + sponsor.Name + ")"
+			}
+		}
+
+		fields["name"] = p.Name
+	}
+
+	if p.Location != "" {
+		fields["location"] = p.Location
+	}
+
+	if p.Bio != "" {
+		fields["bio"] = p.Bio
+	}
+
+	if len(fields) > 0 {
+		db.GetStore().Characters.Update(m.sender.character.ID, fields)
+	}
+
+	if p.PhoneNumber != "" {
+		db.GetStore().Characters.UpdateSettings(m.sender.character.ID, map[string]interface{}{
+			"phoneNumber": p.PhoneNumber,
+		})
+	}
+
+	character, err := db.GetStore().Characters.Get(m.sender.character.ID)
+
+	if err != nil {
+		return
+	}
+
+	initPacket := packet.NewInitPacket(m.sender.character.ID, character.Room, true)
+	data, _ := initPacket.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
@@ -0,0 +1,192 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/jobs"
+	"github.com/techx/playground/permissions"
+	"github.com/techx/playground/socket/packet"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/youtube/v3"
+)
+
+func init() {
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_current_song"},
+		Decode: packet.NewDecoder(packet.GetCurrentSongPacket{}),
+		Handle: (*Hub).handleGetCurrentSong,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_songs"},
+		Decode: packet.NewDecoder(packet.GetSongsPacket{}),
+		Handle: (*Hub).handleGetSongs,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"song"},
+		Decode: packet.NewDecoder(packet.SongPacket{}),
+		Handle: (*Hub).handleSong,
+	})
+}
+
+func (h *Hub) handleGetCurrentSong(m *SocketMessage, pkt packet.Packet) {
+	currentSong, songEnd, err := db.GetStore().Songs.Current()
+
+	if err != nil {
+		return
+	}
+
+	timeDiff := songEnd.Sub(time.Now())
+	var songStart int
+	if currentSong.Duration != 0 {
+		songStart = currentSong.Duration - int(timeDiff.Seconds())
+	} else {
+		songStart = 0
+	}
+
+	resp := packet.NewPlaySongPacket(currentSong, songStart)
+	h.Send(resp)
+}
+
+func (h *Hub) handleGetSongs(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.GetSongsPacket)
+
+	songs, err := db.GetStore().Songs.Queue()
+
+	if err != nil {
+		h.sendError(m, ServerError)
+		return
+	}
+
+	resp := packet.NewSongsPacket(songs)
+	resp.RequestID = p.RequestID
+	data, _ := resp.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) handleSong(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.SongPacket)
+
+	// Parse song packet
+	if p.Remove {
+		db.GetStore().Songs.Remove(p.ID)
+		h.Send(p)
+		return
+	}
+
+	jukeboxTimestamp, addedBefore, _ := db.GetStore().Songs.Cooldown(m.sender.character.ID)
+
+	if !addedBefore {
+		// User has never added a song to queue -- remind them of COC
+		jukeboxTimestamp = time.Now()
+		warningPacket := packet.NewJukeboxWarningPacket()
+		data, _ := json.Marshal(warningPacket)
+		h.sendTo(m.sender, data)
+	}
+
+	// 15 minutes has not yet passed since user last submitted a song
+	if jukeboxTimestamp.After(time.Now()) && !permissions.Can(m.sender.character, permissions.JukeboxSkipCooldown) {
+		h.sendError(m, JukeboxCooldown)
+		return
+	}
+
+	if m.sender.pendingSong {
+		// Still looking up the last song they added
+		return
+	}
+
+	// The YouTube API call can be slow, so make it in the background
+	m.sender.pendingSong = true
+
+	h.submitJob(m, &jobs.Job{
+		Name: "youtube_lookup",
+		Run: func(ctx context.Context) (interface{}, error) {
+			youtubeClient, err := youtube.New(&http.Client{
+				Transport: &transport.APIKey{Key: config.GetSecret(config.YouTubeKey)},
+			})
+
+			if err != nil {
+				return nil, jobs.Permanent(err)
+			}
+
+			call := youtubeClient.Videos.List([]string{"snippet", "contentDetails"}).
+				Id(p.VidCode).
+				Context(ctx)
+
+			return call.Do()
+		},
+		Done: func(result interface{}, err error) {
+			m.sender.pendingSong = false
+
+			if err != nil {
+				h.sendError(m, SongNotFound)
+				return
+			}
+
+			h.addSong(m, p, result.(*youtube.VideoListResponse))
+		},
+	})
+}
+
+// Adds a song to the queue once we've heard back from YouTube about it
+func (h *Hub) addSong(m *SocketMessage, p packet.SongPacket, response *youtube.VideoListResponse) {
+	// Should only have one video
+	for _, video := range response.Items {
+		// Parse duration string
+		duration := video.ContentDetails.Duration
+		minIndex := strings.Index(duration, "M")
+		secIndex := strings.Index(duration, "S")
+
+		// Convert duration to seconds
+		var minutes int
+		var seconds int
+		if minIndex != -1 {
+			minutes, _ = strconv.Atoi(duration[2:minIndex])
+			seconds, _ = strconv.Atoi(duration[minIndex+1 : secIndex])
+		} else {
+			minutes = 0
+			timeIndex := strings.Index(duration, "T")
+			seconds, _ = strconv.Atoi(duration[timeIndex+1 : secIndex])
+		}
+
+		// Song is too long
+		if minutes >= 6 {
+			h.sendError(m, SongTooLong)
+			return
+		}
+
+		p.Duration = (minutes * 60) + seconds
+		p.Title = video.Snippet.Title
+		p.ThumbnailURL = video.Snippet.Thumbnails.Default.Url
+	}
+
+	songID := uuid.New().String()
+	p.ID = songID
+
+	jukeboxTime := time.Now().Add(time.Minute * 15)
+
+	err := db.GetStore().Songs.Add(p.Song)
+
+	if err == nil {
+		err = db.GetStore().Songs.SetCooldown(m.sender.character.ID, jukeboxTime)
+	}
+
+	if err != nil {
+		log.Println(err)
+		h.sendError(m, ServerError)
+		return
+	}
+
+	h.Send(p)
+}
@@ -0,0 +1,298 @@
+package socket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/jobs"
+	"github.com/techx/playground/socket/packet"
+	"github.com/techx/playground/utils"
+)
+
+func init() {
+	RegisterPacket(PacketHandler{
+		Types:  []string{"chat"},
+		Decode: packet.NewDecoder(packet.ChatPacket{}),
+		Handle: (*Hub).handleChat,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"dance"},
+		Decode: packet.NewDecoder(packet.DancePacket{}),
+		Handle: (*Hub).handleDance,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"friend_request"},
+		Decode: packet.NewDecoder(packet.FriendRequestPacket{}),
+		Handle: (*Hub).handleFriendRequest,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_achievements"},
+		Decode: packet.NewDecoder(packet.GetAchievementsPacket{}),
+		Handle: (*Hub).handleGetAchievements,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_messages"},
+		Decode: packet.NewDecoder(packet.GetMessagesPacket{}),
+		Handle: (*Hub).handleGetMessages,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"message"},
+		Decode: packet.NewDecoder(packet.MessagePacket{}),
+		Handle: (*Hub).handleMessage,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"report"},
+		Decode: packet.NewDecoder(packet.ReportPacket{}),
+		Handle: (*Hub).handleReport,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"settings"},
+		Decode: packet.NewDecoder(packet.SettingsPacket{}),
+		Handle: (*Hub).handleSettings,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"status"},
+		Decode: packet.NewDecoder(packet.StatusPacket{}),
+		Handle: (*Hub).handleStatus,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"wardrobe_change"},
+		Decode: packet.NewDecoder(packet.WardrobeChangePacket{}),
+		Handle: (*Hub).handleWardrobeChange,
+	})
+}
+
+func (h *Hub) handleChat(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.ChatPacket)
+
+	// Check for non-ASCII characters
+	if !utils.IsASCII(p.Message) {
+		h.sendError(m, InvalidCharacters)
+		return
+	}
+
+	// Publish chat event to other clients
+	p.Room = m.sender.character.Room
+	p.ID = m.sender.character.ID
+	h.Send(p)
+}
+
+func (h *Hub) handleDance(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.DancePacket)
+
+	// Publish dance event to other clients
+	p.Room = m.sender.character.Room
+	p.ID = m.sender.character.ID
+	h.Send(p)
+}
+
+func (h *Hub) handleFriendRequest(m *SocketMessage, pkt packet.Packet) {
+	res := pkt.(packet.FriendRequestPacket)
+
+	if res.RecipientID == res.SenderID {
+		return
+	}
+
+	res.SenderID = m.sender.character.ID
+
+	// Check if the other person has also sent a friend request
+	isExistingRequest, _ := db.GetStore().Friends.HasRequest(m.sender.character.ID, res.RecipientID)
+
+	if isExistingRequest {
+		firstNumFriends, secondNumFriends, err := db.GetStore().Friends.AcceptRequest(m.sender.character.ID, res.RecipientID)
+
+		if err != nil {
+			return
+		}
+
+		// Track achievement progress
+		if firstNumFriends == config.GetConfig().GetInt64("achievements.num_friends") {
+			db.GetStore().Characters.SetAchievement(m.sender.character.ID, "hangouts")
+		}
+
+		if secondNumFriends == config.GetConfig().GetInt64("achievements.num_friends") {
+			db.GetStore().Characters.SetAchievement(res.RecipientID, "hangouts")
+		}
+
+		firstUpdate := packet.NewFriendUpdatePacket(res.RecipientID, m.sender.character.ID)
+		h.Send(firstUpdate)
+
+		secondUpdate := packet.NewFriendUpdatePacket(m.sender.character.ID, res.RecipientID)
+		h.Send(secondUpdate)
+	} else {
+		db.GetStore().Friends.AddRequest(res.RecipientID, m.sender.character.ID)
+
+		friendUpdate := packet.NewFriendUpdatePacket(res.RecipientID, m.sender.character.ID)
+		h.Send(friendUpdate)
+	}
+}
+
+func (h *Hub) handleGetAchievements(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.GetAchievementsPacket)
+
+	// Send achievements back to client
+	resp := packet.NewAchievementsPacket(p.ID)
+	resp.RequestID = p.RequestID
+	data, _ := resp.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) handleGetMessages(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.GetMessagesPacket)
+
+	messages, err := db.GetStore().Messages.Conversation(m.sender.character.ID, p.Recipient, 100)
+
+	if err != nil {
+		h.sendError(m, ServerError)
+		return
+	}
+
+	resp := packet.NewMessagesPacket(messages, p.Recipient)
+	resp.RequestID = p.RequestID
+	data, _ := resp.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) handleMessage(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.MessagePacket)
+
+	// TODO: Save timestamp
+	p.From = m.sender.character.ID
+
+	// Check for non-ASCII characters
+	if !utils.IsASCII(p.Message.Text) {
+		h.sendError(m, InvalidCharacters)
+		return
+	}
+
+	db.GetStore().Messages.Add(p.Message)
+
+	h.Send(p)
+}
+
+func (h *Hub) handleReport(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.ReportPacket)
+
+	json := []byte(`{"text": "` + m.sender.character.Name + `: ` + `(` + p.CharacterID + `): ` + p.Text + `"}`)
+
+	h.submitJob(m, jobs.NewHTTPJob("slack_report", func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", config.GetSecret("SLACK_WEBHOOK"), bytes.NewBuffer(json))
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("Content-Type", "application/json; charset=utf-8")
+		return req, nil
+	}))
+}
+
+func (h *Hub) handleSettings(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.SettingsPacket)
+
+	if len(p.Settings.TwitterHandle) > 0 && p.CheckTwitter {
+		characterID := m.sender.character.ID
+		url := "https://api.twitter.com/2/tweets/search/recent?query=from:" + p.Settings.TwitterHandle + "&tweet.fields=entities"
+
+		job := jobs.NewHTTPJob("twitter_search", func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Add("Authorization", "Bearer "+config.GetSecret("TWITTER_API_KEY"))
+			return req, nil
+		})
+
+		job.Done = func(result interface{}, err error) {
+			if err != nil {
+				return
+			}
+
+			body := strings.ToLower(string(result.([]byte)))
+
+			// Track achievements
+			usedHashtag := strings.Contains(body, "#hackmit2020")
+			usedMemeHashtag := strings.Contains(body, "#hackmitmemes")
+
+			if usedHashtag {
+				db.GetStore().Characters.SetAchievement(characterID, "socialMedia")
+			}
+
+			if usedMemeHashtag {
+				db.GetStore().Characters.SetAchievement(characterID, "memeLord")
+			}
+		}
+
+		h.submitJob(m, job)
+	}
+
+	fields := map[string]interface{}{}
+
+	if p.Location != "" {
+		fields["location"] = p.Location
+	}
+
+	if p.Bio != "" {
+		fields["bio"] = p.Bio
+	}
+
+	if p.Zoom != "" {
+		fields["zoom"] = p.Zoom
+	}
+
+	if len(fields) > 0 {
+		db.GetStore().Characters.Update(m.sender.character.ID, fields)
+	}
+
+	db.GetStore().Characters.UpdateSettings(m.sender.character.ID, utils.StructToMap(p.Settings))
+
+	h.SendBytes("character:"+m.sender.character.ID, m.msg)
+}
+
+func (h *Hub) handleStatus(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.StatusPacket)
+
+	if m.sender.character == nil {
+		return
+	}
+
+	p.ID = m.sender.character.ID
+	p.Online = true
+
+	db.GetStore().Characters.SetActive(m.sender.character.ID, p.Active)
+
+	p.FriendIDs, _ = db.GetStore().Friends.Friends(m.sender.character.ID)
+	p.TeammateIDs, _ = db.GetStore().Friends.Teammates(m.sender.character.ID)
+	h.Send(p)
+}
+
+func (h *Hub) handleWardrobeChange(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.WardrobeChangePacket)
+
+	p.CharacterID = m.sender.character.ID
+	p.Room = m.sender.character.Room
+
+	db.GetStore().Characters.Update(m.sender.character.ID, map[string]interface{}{
+		"eyeColor":   p.EyeColor,
+		"skinColor":  p.SkinColor,
+		"shirtColor": p.ShirtColor,
+		"pantsColor": p.PantsColor,
+	})
+
+	h.Send(p)
+}
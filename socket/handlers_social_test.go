@@ -0,0 +1,149 @@
+package socket
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/wire"
+
+	"github.com/google/uuid"
+)
+
+// Shared by every test, like the one hub a server runs
+var testHub *Hub
+
+func TestMain(m *testing.M) {
+	// The config and seed data are loaded relative to the repo root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+
+	config.Init("test")
+	config.GetConfig().Set("db.backend", "memory")
+	db.Init(false)
+	testHub = new(Hub).Init()
+
+	os.Exit(m.Run())
+}
+
+// Returns a client logged in as a new character, without a connection. The
+// store is shared between tests, so every character gets a fresh ID
+func newTestClient(h *Hub) *Client {
+	client := &Client{
+		hub:    h,
+		id:     uuid.New().String(),
+		send:   make(chan []byte, 16),
+		done:   make(chan struct{}),
+		format: wire.JSON,
+	}
+
+	h.register(client)
+	h.setCharacter(client, &models.Character{
+		ID:   uuid.New().String(),
+		Role: int(models.Hacker),
+		Room: "home",
+	})
+
+	return client
+}
+
+// Waits for the next packet sent to this client, and decodes it into res
+func receive(t *testing.T, client *Client, res interface{}) {
+	select {
+	case msg := <-client.send:
+		if err := json.Unmarshal(msg, res); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a packet")
+	}
+}
+
+func TestMessages(t *testing.T) {
+	h := testHub
+	alice := newTestClient(h)
+	bob := newTestClient(h)
+
+	h.processMessage(&SocketMessage{
+		msg:    []byte(`{"type":"message","to":"` + bob.character.ID + `","text":"hi bob"}`),
+		sender: alice,
+	})
+
+	// Both sides of the conversation get the message
+	for _, client := range []*Client{alice, bob} {
+		var res struct {
+			Type string `json:"type"`
+			From string `json:"from"`
+			Text string `json:"text"`
+		}
+
+		receive(t, client, &res)
+
+		if res.Type != "message" || res.From != alice.character.ID || res.Text != "hi bob" {
+			t.Errorf("%s: unexpected packet %+v", client.character.ID, res)
+		}
+	}
+
+	conversation, err := db.GetStore().Messages.Conversation(bob.character.ID, alice.character.ID, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conversation) != 1 || conversation[0].Text != "hi bob" {
+		t.Fatalf("expected the message to be saved, got %v", conversation)
+	}
+
+	h.processMessage(&SocketMessage{
+		msg:    []byte(`{"type":"get_messages","recipient":"` + alice.character.ID + `","requestId":"1"}`),
+		sender: bob,
+	})
+
+	var res struct {
+		Type      string            `json:"type"`
+		RequestID string            `json:"requestId"`
+		Recipient string            `json:"recipient"`
+		Messages  []*models.Message `json:"messages"`
+	}
+
+	receive(t, bob, &res)
+
+	if res.Type != "messages" || res.RequestID != "1" || res.Recipient != alice.character.ID {
+		t.Errorf("unexpected packet %+v", res)
+	}
+
+	if len(res.Messages) != 1 || res.Messages[0].From != alice.character.ID || res.Messages[0].Text != "hi bob" {
+		t.Errorf("expected bob to get alice's message, got %v", res.Messages)
+	}
+}
+
+func TestMessageInvalidCharacters(t *testing.T) {
+	h := testHub
+	carol := newTestClient(h)
+	dave := newTestClient(h)
+
+	h.processMessage(&SocketMessage{
+		msg:    []byte(`{"type":"message","to":"` + dave.character.ID + `","text":"hi ☃"}`),
+		sender: carol,
+	})
+
+	var res struct {
+		Type string `json:"type"`
+		Code int    `json:"code"`
+	}
+
+	receive(t, carol, &res)
+
+	if res.Type != "error" || res.Code != int(InvalidCharacters) {
+		t.Errorf("expected an invalid characters error, got %+v", res)
+	}
+
+	if conversation, _ := db.GetStore().Messages.Conversation(carol.character.ID, dave.character.ID, 10); len(conversation) != 0 {
+		t.Errorf("message shouldn't have been saved, got %v", conversation)
+	}
+}
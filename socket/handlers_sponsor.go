@@ -0,0 +1,278 @@
+package socket
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/jobs"
+	"github.com/techx/playground/permissions"
+	"github.com/techx/playground/socket/packet"
+)
+
+func init() {
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_sponsor"},
+		Decode: packet.NewDecoder(packet.GetSponsorPacket{}),
+		Handle: (*Hub).handleGetSponsor,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_join"},
+		Decode: packet.NewDecoder(packet.QueueJoinPacket{}),
+		Handle: (*Hub).handleQueueJoin,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_remove"},
+		Decode: packet.NewDecoder(packet.QueueRemovePacket{}),
+		Handle: (*Hub).handleQueueRemove,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_next"},
+		Decode: packet.NewDecoder(packet.QueueNextPacket{}),
+		Handle: (*Hub).handleQueueNext,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_move"},
+		Decode: packet.NewDecoder(packet.QueueMovePacket{}),
+		Handle: (*Hub).handleQueueMove,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_subscribe"},
+		Decode: packet.NewDecoder(packet.QueueSubscribePacket{}),
+		Handle: (*Hub).handleQueueSubscribe,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"queue_unsubscribe"},
+		Decode: packet.NewDecoder(packet.QueueUnsubscribePacket{}),
+		Handle: (*Hub).handleQueueUnsubscribe,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"update_sponsor"},
+		Decode: packet.NewDecoder(packet.UpdateSponsorPacket{}),
+		Handle: (*Hub).handleUpdateSponsor,
+	})
+}
+
+func (h *Hub) handleGetSponsor(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.GetSponsorPacket)
+
+	sponsorPacket := packet.NewSponsorPacket(p.SponsorID)
+	sponsorPacket.RequestID = p.RequestID
+	data, _ := sponsorPacket.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) handleQueueJoin(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueJoinPacket)
+
+	sponsor, err := db.GetStore().Sponsors.Get(p.SponsorID)
+
+	if err != nil || !sponsor.QueueOpen {
+		return
+	}
+
+	if !m.sender.character.IsCollege && !permissions.Can(m.sender.character, permissions.QueueSkipCollegeCheck) {
+		h.sendError(m, HighSchoolSponsorQueue)
+		return
+	}
+
+	subscriber := models.NewQueueSubscriber(m.sender.character, p.Interests)
+	_, joined, err := db.GetStore().Sponsors.Join(p.SponsorID, subscriber)
+
+	if err != nil || !joined {
+		// This hacker is already in the queue
+		return
+	}
+
+	db.GetStore().Characters.Update(m.sender.character.ID, map[string]interface{}{
+		"queueId": p.SponsorID,
+	})
+
+	// Track achievements
+	db.GetStore().Characters.SetAchievement(m.sender.character.ID, "sponsorQueue")
+
+	h.sendSponsorQueueUpdate(p.SponsorID)
+}
+
+func (h *Hub) handleQueueRemove(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueRemovePacket)
+
+	removed, err := db.GetStore().Sponsors.Remove(p.SponsorID, p.CharacterID)
+
+	if err != nil || !removed {
+		// Someone else already took this hacker off the queue
+		return
+	}
+
+	db.GetStore().Characters.Update(p.CharacterID, map[string]interface{}{
+		"queueId": "",
+	})
+
+	h.sendSponsorQueueUpdate(p.SponsorID)
+
+	if p.CharacterID != m.sender.character.ID {
+		// If a sponsor took a hacker off the queue, it's their turn
+		h.sendQueueTurn(m, p.SponsorID, p.CharacterID, p.Zoom)
+	}
+}
+
+func (h *Hub) handleQueueNext(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueNextPacket)
+
+	subscriber, err := db.GetStore().Sponsors.Next(p.SponsorID)
+
+	if err != nil {
+		// Nobody is waiting
+		return
+	}
+
+	db.GetStore().Characters.Update(subscriber.ID, map[string]interface{}{
+		"queueId": "",
+	})
+
+	h.sendSponsorQueueUpdate(p.SponsorID)
+	h.sendQueueTurn(m, p.SponsorID, subscriber.ID, p.Zoom)
+}
+
+func (h *Hub) handleQueueMove(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueMovePacket)
+
+	position, err := db.GetStore().Sponsors.Move(p.SponsorID, p.CharacterID, p.Position)
+
+	if err != nil || position == 0 {
+		return
+	}
+
+	h.sendSponsorQueueUpdate(p.SponsorID)
+}
+
+// Lets a hacker know that a sponsor is ready to meet with them, in Playground
+// and by text
+func (h *Hub) sendQueueTurn(m *SocketMessage, sponsorID, characterID, zoom string) {
+	// TODO: Replace this with the sponsor's actual URL
+	hackerUpdatePacket := packet.NewQueueUpdateHackerPacket(sponsorID, 0, zoom)
+	hackerUpdatePacket.CharacterIDs = []string{characterID}
+	h.Send(hackerUpdatePacket)
+
+	// Send the hacker a text message letting them know it's their turn
+	phoneNumber, _ := db.GetStore().Characters.PhoneNumber(characterID)
+	sponsor, err := db.GetStore().Sponsors.Get(sponsorID)
+
+	if len(phoneNumber) == 0 || err != nil || len(sponsor.Name) == 0 {
+		return
+	}
+
+	sponsorName := sponsor.Name
+
+	reg, _ := regexp.Compile("[^0-9]+")
+	phoneNumber = "+1" + reg.ReplaceAllString(phoneNumber, "")
+
+	msgData := url.Values{}
+	msgData.Set("To", phoneNumber)
+	msgData.Set("From", config.GetConfig().GetString("twilio.from_phone_number"))
+	msgData.Set("Body", "It's your turn to talk to "+sponsorName+"! Meet with them at "+zoom)
+
+	urlStr := "https://api.twilio.com/2010-04-01/Accounts/" + config.GetSecret(config.TwilioAccountSID) + "/Messages.json"
+
+	job := jobs.NewHTTPJob("twilio_sms", func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", urlStr, strings.NewReader(msgData.Encode()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.SetBasicAuth(config.GetSecret(config.TwilioAccountSID), config.GetSecret(config.TwilioAuthToken))
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+
+	// Don't risk texting someone twice
+	job.Retries = jobs.NoRetry
+	h.submitJob(m, job)
+}
+
+func (h *Hub) handleQueueSubscribe(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueSubscribePacket)
+
+	db.GetStore().Sponsors.Watch(p.SponsorID, m.sender.character.ID)
+
+	// TODO: This is inefficient, we should just send the update to the newly subscribed sponsor
+	h.sendSponsorQueueUpdate(p.SponsorID)
+}
+
+func (h *Hub) handleQueueUnsubscribe(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.QueueUnsubscribePacket)
+
+	db.GetStore().Sponsors.Unwatch(p.SponsorID, m.sender.character.ID)
+}
+
+func (h *Hub) handleUpdateSponsor(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.UpdateSponsorPacket)
+
+	// RequiredCapability checked that they can edit the sponsor named in the
+	// packet, so that's the only one we change
+	if p.Sponsor == nil || p.Sponsor.ID == "" {
+		h.sendError(m, ServerError)
+		return
+	}
+
+	sponsorID := p.Sponsor.ID
+	fields := map[string]interface{}{}
+
+	if len(p.Sponsor.Challenges) > 0 {
+		fields["challenges"] = p.Sponsor.Challenges
+	}
+
+	if len(p.Sponsor.Description) > 0 {
+		fields["description"] = p.Sponsor.Description
+	}
+
+	if len(p.Sponsor.URL) > 0 {
+		fields["url"] = p.Sponsor.URL
+	}
+
+	if p.SetQueueOpen {
+		fields["queueOpen"] = p.QueueOpen
+	}
+
+	if len(fields) > 0 {
+		if err := db.GetStore().Sponsors.Update(sponsorID, fields); err != nil {
+			h.sendError(m, ServerError)
+			return
+		}
+	}
+
+	// Send new sponsor packet
+	sponsorPacket := packet.NewSponsorPacket(sponsorID)
+	data, _ := sponsorPacket.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) sendSponsorQueueUpdate(sponsorID string) {
+	subscribers, _ := db.GetStore().Sponsors.Queue(sponsorID)
+	sponsorIDs, _ := db.GetStore().Sponsors.Watchers(sponsorID)
+
+	for i, subscriber := range subscribers {
+		// Send queue update to each hacker
+		hackerUpdatePacket := packet.NewQueueUpdateHackerPacket(sponsorID, i+1, "")
+		hackerUpdatePacket.CharacterIDs = []string{subscriber.ID}
+		h.Send(hackerUpdatePacket)
+	}
+
+	sponsorUpdatePacket := packet.NewQueueUpdateSponsorPacket(subscribers)
+	sponsorUpdatePacket.CharacterIDs = sponsorIDs
+	h.Send(sponsorUpdatePacket)
+}
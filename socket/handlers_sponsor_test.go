@@ -0,0 +1,103 @@
+package socket
+
+import (
+	"testing"
+
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+
+	"github.com/google/uuid"
+)
+
+// Returns a client logged in with this role, without a connection
+func newTestClientWithRole(h *Hub, role models.Role, sponsorID string) *Client {
+	client := newTestClient(h)
+
+	h.setCharacter(client, &models.Character{
+		ID:        client.character.ID,
+		Role:      int(role),
+		SponsorID: sponsorID,
+		Room:      "home",
+	})
+
+	return client
+}
+
+// Returns the ID of a new sponsor. The store is shared between tests, so every
+// sponsor gets a fresh ID
+func newTestSponsor(t *testing.T) string {
+	id := uuid.New().String()
+
+	if err := db.GetStore().Sponsors.Create(&models.Sponsor{ID: id, Name: "Sponsor", Description: "Original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestUpdateSponsor(t *testing.T) {
+	h := testHub
+	acme := newTestSponsor(t)
+	other := newTestSponsor(t)
+
+	tests := []struct {
+		name      string
+		role      models.Role
+		sponsorID string
+		msg       string
+
+		// The packet we expect back, or "" for nothing
+		response string
+		changed  string
+	}{
+		{"rep editing their sponsor", models.SponsorRep, acme, `{"type":"update_sponsor","id":"` + acme + `","description":"Changed"}`, "sponsor", acme},
+		{"rep editing another sponsor", models.SponsorRep, acme, `{"type":"update_sponsor","id":"` + other + `","description":"Changed"}`, "", ""},
+		{"rep without a sponsor ID", models.SponsorRep, acme, `{"type":"update_sponsor","description":"Changed"}`, "", ""},
+		{"hacker editing a sponsor", models.Hacker, "", `{"type":"update_sponsor","id":"` + other + `","description":"Changed"}`, "", ""},
+		{"organizer editing a sponsor", models.Organizer, "", `{"type":"update_sponsor","id":"` + other + `","description":"Changed"}`, "sponsor", other},
+
+		// Organizers can edit any sponsor, but still have to say which
+		{"organizer without a sponsor", models.Organizer, "", `{"type":"update_sponsor"}`, "error", ""},
+	}
+
+	for _, test := range tests {
+		for _, id := range []string{acme, other} {
+			db.GetStore().Sponsors.Update(id, map[string]interface{}{"description": "Original"})
+		}
+
+		client := newTestClientWithRole(h, test.role, test.sponsorID)
+
+		h.processMessage(&SocketMessage{
+			msg:    []byte(test.msg),
+			sender: client,
+		})
+
+		if test.response != "" {
+			var res struct {
+				Type    string          `json:"type"`
+				Code    int             `json:"code"`
+				Sponsor *models.Sponsor `json:"sponsor"`
+			}
+
+			receive(t, client, &res)
+
+			if res.Type != test.response {
+				t.Errorf("%s: expected a %s packet, got %+v", test.name, test.response, res)
+			} else if res.Type == "error" && res.Code != int(ServerError) {
+				t.Errorf("%s: expected a server error, got %d", test.name, res.Code)
+			} else if res.Type == "sponsor" && (res.Sponsor.ID != test.changed || res.Sponsor.Description != "Changed") {
+				t.Errorf("%s: expected the updated sponsor back, got %+v", test.name, res.Sponsor)
+			}
+		} else if len(client.send) > 0 {
+			t.Errorf("%s: expected no response, got %s", test.name, <-client.send)
+		}
+
+		for _, id := range []string{acme, other} {
+			sponsor, _ := db.GetStore().Sponsors.Get(id)
+
+			if changed := sponsor.Description == "Changed"; changed != (id == test.changed) {
+				t.Errorf("%s: expected %s to be changed: %v, got %+v", test.name, id, id == test.changed, sponsor)
+			}
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package socket
+
+import (
+	"strings"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
+	"github.com/techx/playground/socket/packet"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	RegisterPacket(PacketHandler{
+		Types:  []string{"element_toggle"},
+		Decode: packet.NewDecoder(packet.ElementTogglePacket{}),
+		Handle: (*Hub).handleElementToggle,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"element_update"},
+		Decode: packet.NewDecoder(packet.ElementUpdatePacket{}),
+		Handle: (*Hub).handleElementUpdate,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"event"},
+		Decode: packet.NewDecoder(packet.EventPacket{}),
+		Handle: (*Hub).handleEvent,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"get_map"},
+		Decode: packet.NewDecoder(packet.GetMapPacket{}),
+		Handle: (*Hub).handleGetMap,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"hallway_add"},
+		Decode: packet.NewDecoder(packet.HallwayAddPacket{}),
+		Handle: (*Hub).handleHallwayAdd,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"hallway_delete"},
+		Decode: packet.NewDecoder(packet.HallwayDeletePacket{}),
+		Handle: (*Hub).handleHallwayDelete,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"hallway_update"},
+		Decode: packet.NewDecoder(packet.HallwayUpdatePacket{}),
+		Handle: (*Hub).handleHallwayUpdate,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"move"},
+		Decode: packet.NewDecoder(packet.MovePacket{}),
+		Handle: (*Hub).handleMove,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"project_form"},
+		Decode: packet.NewDecoder(packet.ProjectFormPacket{}),
+		Handle: (*Hub).handleProjectForm,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"teleport", "teleport_home"},
+		Decode: packet.NewDecoder(packet.TeleportPacket{}),
+		Handle: (*Hub).handleTeleport,
+	})
+
+	RegisterPacket(PacketHandler{
+		Types:  []string{"update_map"},
+		Decode: packet.NewDecoder(packet.UpdateMapPacket{}),
+		Handle: (*Hub).handleUpdateMap,
+	})
+}
+
+func (h *Hub) handleElementToggle(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.ElementTogglePacket)
+
+	element, err := db.GetStore().Rooms.Element(p.ID)
+
+	if err != nil {
+		return
+	}
+
+	numStates := strings.Count(element.Path, ",") + 1
+
+	if element.State < numStates-1 {
+		element.State = element.State + 1
+	} else {
+		element.State = 0
+	}
+
+	db.GetStore().Rooms.SetElementState(p.ID, element.State)
+
+	// Publish update to other ingest servers
+	update := packet.NewElementUpdatePacket(m.sender.character.Room, p.ID, *element)
+	h.Send(update)
+}
+
+func (h *Hub) handleElementUpdate(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.ElementUpdatePacket)
+
+	p.Room = m.sender.character.Room
+
+	if p.Element.Path == "tiles/blue1.svg" {
+		p.Element.ChangingImagePath = true
+		p.Element.ChangingPaths = "tiles/blue1.svg,tiles/blue2.svg,tiles/blue3.svg,tiles/blue4.svg,tiles/green1.svg,tiles/green2.svg,tiles/pink1.svg,tiles/pink2.svg,tiles/pink3.svg,tiles/pink4.svg,tiles/yellow1.svg"
+		p.Element.ChangingInterval = 2000
+	}
+
+	if p.Element.Path == "djbooth.svg" {
+		p.Element.Action = int(models.OpenJukebox)
+	}
+
+	db.GetStore().Rooms.SaveElement(p.ID, &p.Element)
+
+	// Publish event to other ingest servers
+	h.Send(p)
+}
+
+func (h *Hub) handleEvent(m *SocketMessage, pkt packet.Packet) {
+	res := pkt.(packet.EventPacket)
+
+	event, err := db.GetStore().Events.Get(res.ID)
+
+	if err != nil {
+		return
+	}
+
+	db.GetStore().Events.Attend(res.ID, m.sender.character.ID)
+
+	var counter string
+
+	if event.Type == "workshop" {
+		counter = "numWorkshops"
+	} else if event.Type == "mini_event" {
+		counter = "numMiniEvents"
+	} else {
+		return
+	}
+
+	// Check achievement progress and update if necessary
+	numEvents, _ := db.GetStore().Characters.Increment(m.sender.character.ID, counter)
+
+	if event.Type == "workshop" && numEvents == config.GetConfig().GetInt64("achievements.num_workshops") {
+		db.GetStore().Characters.SetAchievement(m.sender.character.ID, "workshops")
+	} else if event.Type == "mini_event" && numEvents == config.GetConfig().GetInt64("achievements.num_mini_events") {
+		db.GetStore().Characters.SetAchievement(m.sender.character.ID, "miniEvents")
+	}
+}
+
+func (h *Hub) handleGetMap(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.GetMapPacket)
+
+	// Send locations back to client
+	resp := packet.NewMapPacket()
+	resp.RequestID = p.RequestID
+	data, _ := resp.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
+
+func (h *Hub) handleHallwayAdd(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.HallwayAddPacket)
+
+	p.Room = m.sender.character.Room
+	p.ID = uuid.New().String()
+
+	db.GetStore().Rooms.AddHallway(p.Room, p.ID, &p.Hallway)
+
+	// Publish event to other ingest servers
+	h.Send(p)
+}
+
+func (h *Hub) handleHallwayDelete(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.HallwayDeletePacket)
+
+	p.Room = m.sender.character.Room
+
+	db.GetStore().Rooms.DeleteHallway(p.Room, p.ID)
+
+	// Publish event to other ingest servers
+	h.Send(p)
+}
+
+func (h *Hub) handleHallwayUpdate(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.HallwayUpdatePacket)
+
+	p.Room = m.sender.character.Room
+
+	db.GetStore().Rooms.SaveHallway(p.ID, &p.Hallway)
+
+	// Publish event to other ingest servers
+	h.Send(p)
+}
+
+func (h *Hub) handleMove(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.MovePacket)
+
+	if m.sender.character == nil {
+		return
+	}
+
+	// The position is saved to Redis and sent out with the next batch of moves
+	p.Room = m.sender.character.Room
+	p.ID = m.sender.character.ID
+
+	h.queueMove(&p)
+}
+
+func (h *Hub) handleProjectForm(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.ProjectFormPacket)
+
+	projectID := uuid.New().String()
+	characterIDs := []string{m.sender.character.ID}
+
+	for _, email := range p.Teammates {
+		characterID, err := db.GetStore().Characters.IDForEmail(email)
+
+		if err != nil || len(characterID) == 0 {
+			continue
+		}
+
+		characterIDs = append(characterIDs, characterID)
+	}
+
+	p.Project.Challenges = strings.Join(p.Challenges, ",")
+	p.Project.Emails = strings.Join(append(p.Teammates, m.sender.character.Email), ",")
+	p.Project.SubmittedAt = int(time.Now().Unix())
+	db.GetStore().Projects.Save(projectID, p.Project)
+
+	for _, characterID := range characterIDs {
+		db.GetStore().Characters.SetProjectID(characterID, projectID)
+		db.GetStore().Characters.SetAchievement(characterID, "trackCounter")
+	}
+}
+
+func (h *Hub) handleTeleport(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.TeleportPacket)
+
+	p.From = m.sender.character.Room
+
+	if p.X <= 0 || p.X >= 1 {
+		p.X = 0.5
+	}
+
+	if p.Y <= 0 || p.Y >= 1 {
+		p.Y = 0.5
+	}
+
+	if p.Type == "teleport_home" {
+		p.From = m.sender.character.Room
+
+		if m.sender.character.SponsorID != "" {
+			// If this character is a sponsor rep, send them to their sponsor room
+			p.To = "sponsor:" + m.sender.character.SponsorID
+		} else {
+			// Otherwise, send them to their personal room
+			homeExists, _ := db.GetStore().Rooms.Exists("home:" + m.sender.character.ID)
+
+			if !homeExists {
+				db.CreateRoom("home:"+m.sender.character.ID, db.Personal)
+			}
+
+			p.To = "home:" + m.sender.character.ID
+		}
+	}
+
+	if strings.HasPrefix(p.To, "character:") {
+		characterID := strings.Split(p.To, ":")[1]
+
+		isFriend, _ := db.GetStore().Friends.IsFriend(m.sender.character.ID, characterID)
+
+		if !isFriend {
+			// Don't let people teleport to random other people
+			return
+		}
+
+		friend, err := db.GetStore().Characters.Get(characterID)
+
+		if err != nil {
+			return
+		}
+
+		p.To = friend.Room
+	}
+
+	if p.To == "nightclub" && !m.sender.character.IsCollege && !permissions.Can(m.sender.character, permissions.RoomsEnter(p.To)) {
+		h.sendError(m, HighSchoolNightClub)
+		return
+	}
+
+	if p.To == "misti" && m.sender.character.School != "Massachusetts Institute of Technology" && !permissions.Can(m.sender.character, permissions.RoomsEnter(p.To)) {
+		h.sendError(m, NonMitMisti)
+		return
+	}
+
+	var project *models.Project
+
+	// If we're going to the hacker arena after 5pm, add the character's project
+	if strings.HasPrefix(p.To, "arena:") && time.Now().Unix() >= 1600549200 {
+		projectID, _ := db.GetStore().Characters.ProjectID(m.sender.character.ID)
+
+		if m.sender.character.Role == int(models.Hacker) && len(projectID) == 0 {
+			h.sendError(m, MissingSurveyResponse)
+			return
+		}
+
+		// Make sure they earn the peer expo achievement
+		db.GetStore().Characters.SetAchievement(m.sender.character.ID, "peerExpo")
+
+		project, _ = db.GetStore().Projects.Get(projectID)
+
+		if project == nil {
+			project = new(models.Project)
+		}
+	}
+
+	// Update this character's room
+	db.GetStore().Characters.Update(m.sender.character.ID, map[string]interface{}{
+		"room": p.To,
+		"x":    p.X,
+		"y":    p.Y,
+	})
+
+	// Remove this character from the previous room
+	db.GetStore().Rooms.RemoveCharacter(m.sender.character.Room, m.sender.character.ID)
+
+	// Send them the init packet for this room
+	initPacket := packet.NewInitPacket(m.sender.character.ID, p.To, false)
+	initPacketData, _ := initPacket.MarshalBinary()
+	h.sendTo(m.sender, initPacketData)
+	h.moveClient(m.sender, p.To)
+
+	// Add them to their new room
+	db.GetStore().Rooms.AddCharacter(p.To, m.sender.character.ID)
+	character, err := db.GetStore().Characters.Get(m.sender.character.ID)
+
+	if err != nil {
+		return
+	}
+
+	// Publish event to other ingest servers
+	p.Character = character
+	p.Character.Project = project
+
+	// If we're entering a sponsor room, track achievement progress
+	if strings.HasPrefix(p.To, "sponsor:") {
+		numSponsors, _ := db.GetStore().Characters.Increment(m.sender.character.ID, "numSponsorsVisited")
+
+		if numSponsors == config.GetConfig().GetInt64("achievements.num_sponsors") {
+			db.GetStore().Characters.SetAchievement(m.sender.character.ID, "companyTour")
+		}
+	}
+
+	h.Send(p)
+}
+
+func (h *Hub) handleUpdateMap(m *SocketMessage, pkt packet.Packet) {
+	p := pkt.(packet.UpdateMapPacket)
+
+	// Update this character's location
+	locationID := m.sender.character.ID
+
+	db.GetStore().Locations.Save(locationID, p.Location)
+
+	// Track achievements
+	db.GetStore().Characters.SetAchievement(m.sender.character.ID, "sendLocation")
+
+	// Send locations back to client
+	resp := packet.NewMapPacket()
+	data, _ := resp.MarshalBinary()
+	h.SendBytes("character:"+m.sender.character.ID, data)
+}
@@ -0,0 +1,50 @@
+package socket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/techx/playground/jobs"
+)
+
+func TestSubmitJob(t *testing.T) {
+	h := testHub
+	defer func(pool *jobs.Pool) { h.jobs = pool }(h.jobs)
+
+	tests := []struct {
+		name      string
+		queueSize int
+		busy      bool
+	}{
+		{"room in the queue", 1, false},
+		{"queue full", 0, true},
+	}
+
+	for _, test := range tests {
+		// Nothing works on the queue, so jobs stay wherever they're put
+		h.jobs = jobs.NewPool(0, test.queueSize, time.Second, 0, h.jobResults)
+		client := newTestClient(h)
+
+		h.submitJob(&SocketMessage{sender: client, requestID: "job"}, &jobs.Job{Name: "test"})
+
+		if !test.busy {
+			if len(client.send) > 0 {
+				t.Errorf("%s: expected no response, got %s", test.name, <-client.send)
+			}
+
+			continue
+		}
+
+		var res struct {
+			Code      int    `json:"code"`
+			Reason    string `json:"reason"`
+			RequestID string `json:"requestId"`
+		}
+
+		receive(t, client, &res)
+
+		if res.Code != int(ServerBusy) || res.Reason != "server_busy" || res.RequestID != "job" {
+			t.Errorf("%s: expected a server busy error, got %+v", test.name, res)
+		}
+	}
+}
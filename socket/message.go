@@ -8,6 +8,10 @@ import (
 type SocketMessage struct {
 	msg    []byte
 	sender *Client
+
+	// The request ID the client sent with this message, if any, which we echo
+	// back on replies and errors
+	requestID string
 }
 
 func (m SocketMessage) MarshalBinary() ([]byte, error) {
@@ -17,3 +21,18 @@ func (m SocketMessage) MarshalBinary() ([]byte, error) {
 func (m SocketMessage) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, m)
 }
+
+// Sender returns the client who sent this message
+func (m *SocketMessage) Sender() *Client {
+	return m.sender
+}
+
+// Data returns the raw contents of this message
+func (m *SocketMessage) Data() []byte {
+	return m.msg
+}
+
+// RequestID returns the request ID the client sent with this message, if any
+func (m *SocketMessage) RequestID() string {
+	return m.requestID
+}
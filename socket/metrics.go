@@ -0,0 +1,111 @@
+package socket
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/techx/playground/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	connectedClientsDesc = metrics.NewDesc("connected_clients",
+		"Clients connected to this ingest.")
+	roomCharactersDesc = metrics.NewDesc("room_characters",
+		"Characters in each room that are connected to this ingest.", "room")
+	sendQueueDepthDesc = metrics.NewDesc("send_queue_depth",
+		"Packets waiting to go out to clients, summed over every client.")
+	sendQueueMaxDepthDesc = metrics.NewDesc("send_queue_max_depth",
+		"Packets waiting to go out to the client furthest behind.")
+	droppedPacketsDesc = metrics.NewDesc("slow_consumer_dropped_packets_total",
+		"Packets that slow clients missed.")
+	slowDisconnectsDesc = metrics.NewDesc("slow_consumer_disconnects_total",
+		"Slow clients that were disconnected, by the policy that disconnected them.", "policy")
+)
+
+var (
+	// The collector can only be registered once, so it reports on whichever
+	// hub started last
+	registerCollector sync.Once
+	collectedHub      atomic.Value
+)
+
+// Reports on the hub's clients whenever metrics are scraped, rather than
+// keeping gauges up to date as clients come and go
+type hubCollector struct{}
+
+func (c hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectedClientsDesc
+	ch <- roomCharactersDesc
+	ch <- sendQueueDepthDesc
+	ch <- sendQueueMaxDepthDesc
+	ch <- droppedPacketsDesc
+	ch <- slowDisconnectsDesc
+}
+
+func (c hubCollector) Collect(ch chan<- prometheus.Metric) {
+	h, ok := collectedHub.Load().(*Hub)
+
+	if !ok {
+		return
+	}
+
+	h.mu.RLock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	rooms := make(map[string]int, len(h.rooms))
+
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+
+	for room, clientsInRoom := range h.rooms {
+		characters := map[string]bool{}
+
+		for _, client := range clientsInRoom {
+			characters[client.character.ID] = true
+		}
+
+		rooms[room] = len(characters)
+	}
+
+	h.mu.RUnlock()
+
+	depth, maxDepth := 0, 0
+
+	// Resuming swaps out a client's queue, so it has to be read under sendMu
+	for _, client := range clients {
+		client.sendMu.Lock()
+		queued := len(client.send)
+		client.sendMu.Unlock()
+
+		depth += queued
+
+		if queued > maxDepth {
+			maxDepth = queued
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(connectedClientsDesc, prometheus.GaugeValue, float64(len(clients)))
+
+	for room, characters := range rooms {
+		ch <- prometheus.MustNewConstMetric(roomCharactersDesc, prometheus.GaugeValue, float64(characters), room)
+	}
+
+	ch <- prometheus.MustNewConstMetric(sendQueueDepthDesc, prometheus.GaugeValue, float64(depth))
+	ch <- prometheus.MustNewConstMetric(sendQueueMaxDepthDesc, prometheus.GaugeValue, float64(maxDepth))
+
+	stats := GetSlowConsumerStats()
+	ch <- prometheus.MustNewConstMetric(droppedPacketsDesc, prometheus.CounterValue, float64(stats.Dropped))
+	ch <- prometheus.MustNewConstMetric(slowDisconnectsDesc, prometheus.CounterValue, float64(stats.DropPolicyDisconnects), string(DropNonCritical))
+	ch <- prometheus.MustNewConstMetric(slowDisconnectsDesc, prometheus.CounterValue, float64(stats.DisconnectPolicyDisconnects), string(Disconnect))
+}
+
+func (h *Hub) initMetrics() {
+	collectedHub.Store(h)
+
+	registerCollector.Do(func() {
+		prometheus.MustRegister(hubCollector{})
+	})
+}
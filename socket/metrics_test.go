@@ -0,0 +1,66 @@
+package socket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHubCollector(t *testing.T) {
+	defer collectedHub.Store(testHub)
+
+	tests := []struct {
+		name     string
+		queued   []int
+		expected string
+	}{
+		{"no clients", nil, `
+# HELP playground_connected_clients Clients connected to this ingest.
+# TYPE playground_connected_clients gauge
+playground_connected_clients 0
+# HELP playground_send_queue_depth Packets waiting to go out to clients, summed over every client.
+# TYPE playground_send_queue_depth gauge
+playground_send_queue_depth 0
+# HELP playground_send_queue_max_depth Packets waiting to go out to the client furthest behind.
+# TYPE playground_send_queue_max_depth gauge
+playground_send_queue_max_depth 0
+`},
+		{"clients with queued packets", []int{2, 0, 3}, `
+# HELP playground_connected_clients Clients connected to this ingest.
+# TYPE playground_connected_clients gauge
+playground_connected_clients 3
+# HELP playground_send_queue_depth Packets waiting to go out to clients, summed over every client.
+# TYPE playground_send_queue_depth gauge
+playground_send_queue_depth 5
+# HELP playground_send_queue_max_depth Packets waiting to go out to the client furthest behind.
+# TYPE playground_send_queue_max_depth gauge
+playground_send_queue_max_depth 3
+`},
+	}
+
+	for _, test := range tests {
+		// Every hub registers itself when it starts, and the latest one takes
+		// over reporting rather than panicking
+		h := new(Hub)
+		h.clients = map[string]*Client{}
+		h.initMetrics()
+
+		for _, queued := range test.queued {
+			client := &Client{id: uuid.New().String(), send: make(chan []byte, 4)}
+			h.register(client)
+
+			for i := 0; i < queued; i++ {
+				client.send <- []byte("{}")
+			}
+		}
+
+		err := testutil.CollectAndCompare(hubCollector{}, strings.NewReader(test.expected),
+			"playground_connected_clients", "playground_send_queue_depth", "playground_send_queue_max_depth")
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
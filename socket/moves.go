@@ -0,0 +1,197 @@
+package socket
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/socket/packet"
+)
+
+type position struct {
+	x, y float64
+}
+
+// A move that characters outside of the interest radius haven't seen yet
+type farMove struct {
+	room string
+	msg  []byte
+}
+
+// Keeps track of moves so that each character's position goes out at most once
+// per tick, and only as often as it's needed by characters far away from them
+type moveState struct {
+	mu sync.Mutex
+
+	// Moves by our clients waiting for the next tick, keyed by character ID.
+	// Only the latest move for each character is kept
+	pending map[string]*packet.MovePacket
+
+	// Last known position of every character we've seen move
+	positions map[string]position
+
+	// Latest move for each character that far away characters haven't gotten
+	far map[string]farMove
+
+	tick uint64
+}
+
+// Loads move settings from the config
+func (h *Hub) initMoves() {
+	h.moves = &moveState{
+		pending:   map[string]*packet.MovePacket{},
+		positions: map[string]position{},
+		far:       map[string]farMove{},
+	}
+
+	h.moveTickRate = config.GetConfig().GetFloat64("socket.moves.tick_rate")
+	h.interestRadius = config.GetConfig().GetFloat64("socket.moves.interest_radius")
+	h.farUpdateInterval = uint64(config.GetConfig().GetInt("socket.moves.far_update_interval"))
+
+	if h.farUpdateInterval == 0 {
+		h.farUpdateInterval = 1
+	}
+}
+
+// Holds on to a move until the next tick, replacing any earlier move by the same
+// character
+func (h *Hub) queueMove(p *packet.MovePacket) {
+	h.moves.mu.Lock()
+	defer h.moves.mu.Unlock()
+
+	h.moves.pending[p.ID] = p
+}
+
+// Sends out queued moves at the configured tick rate
+func (h *Hub) runMoveTicks() {
+	if h.moveTickRate <= 0 {
+		log.Println("ERROR: socket.moves.tick_rate must be positive")
+		return
+	}
+
+	for range time.NewTicker(time.Duration(float64(time.Second) / h.moveTickRate)).C {
+		h.moveTick()
+	}
+}
+
+func (h *Hub) moveTick() {
+	h.moves.mu.Lock()
+	pending := h.moves.pending
+	h.moves.pending = map[string]*packet.MovePacket{}
+	h.moves.tick++
+
+	var far map[string]farMove
+
+	if h.interestRadius > 0 && h.moves.tick%h.farUpdateInterval == 0 {
+		far = h.moves.far
+		h.moves.far = map[string]farMove{}
+	}
+
+	h.moves.mu.Unlock()
+
+	if len(pending) > 0 {
+		// Save every position, then publish every move in one round trip
+		positions := make(map[string]db.Position, len(pending))
+		publications := make([]db.Publication, 0, len(pending))
+		routed := make([]*routedPacket, 0, len(pending))
+
+		for _, p := range pending {
+			data, _ := p.MarshalBinary()
+			rp, err := newRoutedPacket(data)
+
+			if err != nil {
+				continue
+			}
+
+			positions[p.ID] = db.Position{X: p.X, Y: p.Y}
+			publications = append(publications, db.Publication{Data: data, Channels: rp.channels})
+			routed = append(routed, rp)
+		}
+
+		if err := db.GetStore().Characters.SetPositions(positions); err != nil {
+			log.Println("ERROR: Unable to save positions ->", err)
+		}
+
+		db.PublishAll(publications)
+
+		for _, rp := range routed {
+			h.processRoutes(rp)
+		}
+	}
+
+	// Catch up everyone else on the latest positions
+	for characterID, move := range far {
+		out := newOutgoing(move.msg)
+
+		for _, client := range h.recipients(move.room) {
+			if !h.isNear(client, characterID) {
+				h.deliver(client, out, true)
+			}
+		}
+	}
+}
+
+// Sends a move to the clients in its room. If there's an interest radius, only
+// clients near the character get it right away
+func (h *Hub) sendMove(p packet.MovePacket, msg []byte) {
+	h.moves.mu.Lock()
+	h.moves.positions[p.ID] = position{p.X, p.Y}
+
+	if h.interestRadius > 0 {
+		h.moves.far[p.ID] = farMove{p.Room, msg}
+	}
+
+	h.moves.mu.Unlock()
+
+	if h.interestRadius <= 0 {
+		h.SendBytes(p.Room, msg)
+		return
+	}
+
+	out := newOutgoing(msg)
+
+	for _, client := range h.recipients(p.Room) {
+		if h.isNear(client, p.ID) {
+			h.deliver(client, out, true)
+		}
+	}
+}
+
+// Returns true if this client's character is within the interest radius of
+// another character. Characters we don't know the position of count as near
+func (h *Hub) isNear(client *Client, characterID string) bool {
+	h.moves.mu.Lock()
+	defer h.moves.mu.Unlock()
+
+	if client.character.ID == characterID {
+		return true
+	}
+
+	a, ok := h.moves.positions[characterID]
+
+	if !ok {
+		return true
+	}
+
+	b, ok := h.moves.positions[client.character.ID]
+
+	if !ok {
+		return true
+	}
+
+	return math.Hypot(a.x-b.x, a.y-b.y) <= h.interestRadius
+}
+
+// Forgets where a character was once they leave their room, so that we don't
+// send stale moves into the room they came from
+func (h *Hub) forgetPosition(characterID string) {
+	h.moves.mu.Lock()
+	defer h.moves.mu.Unlock()
+
+	delete(h.moves.pending, characterID)
+	delete(h.moves.positions, characterID)
+	delete(h.moves.far, characterID)
+}
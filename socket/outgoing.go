@@ -0,0 +1,42 @@
+package socket
+
+import (
+	"log"
+
+	"github.com/techx/playground/wire"
+)
+
+// A packet on its way out to clients. It's encoded at most once for each wire
+// format, no matter how many clients it goes to
+type outgoing struct {
+	json    []byte
+	encoded map[wire.Format][]byte
+}
+
+func newOutgoing(msg []byte) *outgoing {
+	return &outgoing{json: msg}
+}
+
+// Returns this packet encoded in the given format, or nil if it can't be
+func (o *outgoing) bytes(format wire.Format) []byte {
+	if format == wire.JSON {
+		return o.json
+	}
+
+	if data, ok := o.encoded[format]; ok {
+		return data
+	}
+
+	data, err := wire.Encode(o.json, format)
+
+	if err != nil {
+		log.Println("ERROR: Unable to encode packet as", format, "->", err)
+	}
+
+	if o.encoded == nil {
+		o.encoded = map[wire.Format][]byte{}
+	}
+
+	o.encoded[format] = data
+	return data
+}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 )
 
 type AchievementsPacket struct {
@@ -25,8 +24,9 @@ func NewAchievementsPacket(characterID string) *AchievementsPacket {
 
 	p.ID = characterID
 
-	res, _ := db.GetInstance().HGetAll("character:" + characterID + ":achievements").Result()
-	utils.Bind(res, &p.Achievements)
+	if achievements, err := db.GetStore().Characters.Achievements(characterID); err == nil {
+		p.Achievements = *achievements
+	}
 
 	return p
 }
@@ -2,8 +2,7 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they need to add a valid email to our system
@@ -21,8 +20,12 @@ type AddEmailPacket struct {
 	SponsorID string `json:"sponsorId"`
 }
 
-func (p AddEmailPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p AddEmailPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p AddEmailPacket) RequiredCapability(characterID string) string {
+	return permissions.LoginsManage
 }
 
 func (p AddEmailPacket) MarshalBinary() ([]byte, error) {
@@ -1,11 +1,15 @@
 package packet
 
-import (
-	"github.com/techx/playground/db/models"
-)
-
 type Packet interface {
-	PermissionCheck(characterID string, role models.Role) bool
+	PermissionCheck(characterID string) bool
+}
+
+// Restricted is implemented by packets that need a capability to send, on top
+// of their PermissionCheck (see the permissions package)
+type Restricted interface {
+	// RequiredCapability returns the capability that whoever sent this packet
+	// needs, or "" if this particular packet doesn't need one
+	RequiredCapability(characterID string) string
 }
 
 // The base packet that can be sent between clients and server. These are all
@@ -15,8 +19,12 @@ type BasePacket struct {
 
 	// Identifies the type of packet
 	Type string `json:"type"`
+
+	// Optional ID chosen by the client, which the server echoes back on its
+	// reply and on any error
+	RequestID string `json:"requestId,omitempty"`
 }
 
-func (p *BasePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p *BasePacket) PermissionCheck(characterID string) bool {
 	return false
 }
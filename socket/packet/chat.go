@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type ChatPacket struct {
@@ -20,7 +18,7 @@ type ChatPacket struct {
 	Room string `json:"room"`
 }
 
-func (p ChatPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p ChatPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
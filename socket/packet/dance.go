@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by clients when they dance
@@ -21,7 +19,7 @@ type DancePacket struct {
 	Dance int `json:"dance"`
 }
 
-func (p DancePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p DancePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
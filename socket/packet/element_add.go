@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they're adding an element
@@ -21,8 +22,12 @@ type ElementAddPacket struct {
 	Element models.Element `json:"element"`
 }
 
-func (p ElementAddPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p ElementAddPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p ElementAddPacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p ElementAddPacket) MarshalBinary() ([]byte, error) {
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by clients when they're deleting an element
@@ -15,7 +13,7 @@ type ElementTogglePacket struct {
 	ID string `json:"id"`
 }
 
-func (p ElementTogglePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p ElementTogglePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they're updating the room
@@ -32,8 +33,12 @@ func NewElementUpdatePacket(room, id string, element models.Element) *ElementUpd
 	}
 }
 
-func (p ElementUpdatePacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p ElementUpdatePacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p ElementUpdatePacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p ElementUpdatePacket) MarshalBinary() ([]byte, error) {
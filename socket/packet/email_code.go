@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by clients when they need a login code
@@ -18,7 +16,7 @@ type EmailCodePacket struct {
 	Role int `json:"role"`
 }
 
-func (p EmailCodePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p EmailCodePacket) PermissionCheck(characterID string) bool {
 	return true
 }
 
@@ -4,17 +4,27 @@ import (
 	"encoding/json"
 )
 
+// Sent by ingests when they can't do what a client asked
 type ErrorPacket struct {
 	BasePacket
 	Packet `json:",omitempty"`
 
 	Code int `json:"code"`
+
+	// Machine-readable reason for the error, e.g. "rate_limited". Only sent
+	// to clients with the error_reasons capability
+	Reason string `json:"reason,omitempty"`
+
+	// A message that can be shown to the user, sent along with the reason
+	Message string `json:"message,omitempty"`
 }
 
-func NewErrorPacket(code int) *ErrorPacket {
+func NewErrorPacket(code int, reason, message string) *ErrorPacket {
 	p := new(ErrorPacket)
 	p.BasePacket = BasePacket{Type: "error"}
 	p.Code = code
+	p.Reason = reason
+	p.Message = message
 	return p
 }
 
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent when a user confirms attendance for an event
@@ -21,7 +19,7 @@ func (p *EventPacket) Init(id string) *EventPacket {
 	return p
 }
 
-func (p EventPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p EventPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
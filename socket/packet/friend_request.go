@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type FriendRequestPacket struct {
@@ -14,7 +12,7 @@ type FriendRequestPacket struct {
 	RecipientID string `json:"recipientId"`
 }
 
-func (p FriendRequestPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p FriendRequestPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -6,7 +6,6 @@ import (
 
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 )
 
 type Friend struct {
@@ -30,18 +29,14 @@ type FriendUpdatePacket struct {
 }
 
 func NewFriendUpdatePacket(characterID string, friendID string) *FriendUpdatePacket {
-	pip := db.GetInstance().Pipeline()
-	friendCmd := pip.HGetAll("character:" + friendID)
-	isTeammateCmd := pip.SIsMember("character:"+characterID+":teammates", friendID)
-	isRequestCmd := pip.SIsMember("character:"+characterID+":requests", friendID)
-	pip.Exec()
+	friend, err := db.GetStore().Characters.Get(friendID)
 
-	friendData, _ := friendCmd.Result()
-	friend := new(models.Character)
-	utils.Bind(friendData, friend)
+	if err != nil {
+		friend = new(models.Character)
+	}
 
-	isTeammate, _ := isTeammateCmd.Result()
-	isRequest, _ := isRequestCmd.Result()
+	isTeammate, _ := db.GetStore().Friends.IsTeammate(characterID, friendID)
+	isRequest, _ := db.GetStore().Friends.HasRequest(characterID, friendID)
 
 	return &FriendUpdatePacket{
 		BasePacket: BasePacket{
@@ -61,7 +56,7 @@ func NewFriendUpdatePacket(characterID string, friendID string) *FriendUpdatePac
 }
 
 // This isn't needed -- remove later
-func (p FriendUpdatePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p FriendUpdatePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
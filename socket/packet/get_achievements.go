@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type GetAchievementsPacket struct {
@@ -13,7 +11,7 @@ type GetAchievementsPacket struct {
 	ID string `json:"id"`
 }
 
-func (p GetAchievementsPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p GetAchievementsPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -2,15 +2,13 @@ package packet
 
 import(
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type GetCurrentSongPacket struct {
 	BasePacket
 }
 
-func (p GetCurrentSongPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p GetCurrentSongPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
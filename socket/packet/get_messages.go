@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type GetMessagesPacket struct {
@@ -13,7 +11,7 @@ type GetMessagesPacket struct {
 	Recipient string `json:"recipient"`
 }
 
-func (p GetMessagesPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p GetMessagesPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -2,15 +2,13 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type GetSongsPacket struct {
 	BasePacket
 }
 
-func (p GetSongsPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p GetSongsPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
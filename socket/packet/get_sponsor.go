@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type GetSponsorPacket struct {
@@ -13,7 +11,7 @@ type GetSponsorPacket struct {
 	SponsorID string `json:"id"`
 }
 
-func (p GetSponsorPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p GetSponsorPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
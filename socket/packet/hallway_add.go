@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when adding a hallway
@@ -21,8 +22,12 @@ type HallwayAddPacket struct {
 	Hallway models.Hallway `json:"hallway"`
 }
 
-func (p HallwayAddPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p HallwayAddPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p HallwayAddPacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p HallwayAddPacket) MarshalBinary() ([]byte, error) {
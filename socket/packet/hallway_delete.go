@@ -3,7 +3,7 @@ package packet
 import (
 	"encoding/json"
 
-	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they're deleting a hallway
@@ -18,8 +18,12 @@ type HallwayDeletePacket struct {
 	ID string `json:"id"`
 }
 
-func (p HallwayDeletePacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p HallwayDeletePacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p HallwayDeletePacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p HallwayDeletePacket) MarshalBinary() ([]byte, error) {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they're updating a hallway
@@ -21,8 +22,12 @@ type HallwayUpdatePacket struct {
 	Hallway models.Hallway `json:"hallway"`
 }
 
-func (p HallwayUpdatePacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && role == models.Organizer
+func (p HallwayUpdatePacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p HallwayUpdatePacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p HallwayUpdatePacket) MarshalBinary() ([]byte, error) {
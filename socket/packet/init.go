@@ -2,16 +2,14 @@ package packet
 
 import (
 	"encoding/json"
+	"log"
 	"strings"
 	"time"
 
+	"github.com/techx/playground/auth"
 	"github.com/techx/playground/config"
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
-
-	"github.com/dgrijalva/jwt-go"
-	"github.com/go-redis/redis/v7"
 )
 
 // Sent by server to clients upon connecting. Contains information about the
@@ -25,8 +23,10 @@ type InitPacket struct {
 	// The room that the client is about to join
 	Room *models.Room `json:"room"`
 
-	// A token for the client to save for future authentication
-	Token string `json:"token,omitempty"`
+	// Tokens for the client to save for future authentication. The token
+	// expires quickly, after which the refresh token gets them a new pair
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
 
 	// All possible element names
 	ElementNames []string `json:"elementNames"`
@@ -51,266 +51,106 @@ type InitPacket struct {
 
 	// True if the user needs to register
 	FirstTime bool `json:"firstTime"`
-}
 
-func NewInitPacket(characterID, roomID string, needsToken bool) *InitPacket {
-	// Fetch character and room from Redis
-	pip := db.GetInstance().Pipeline()
-	roomCmd := pip.HGetAll("room:" + roomID)
-	roomCharactersCmd := pip.SMembers("room:" + roomID + ":characters")
-	roomElementsCmd := pip.LRange("room:"+roomID+":elements", 0, -1)
-	roomHallwaysCmd := pip.SMembers("room:" + roomID + ":hallways")
-	characterCmd := pip.HGetAll("character:" + characterID)
-	settingsCmd := pip.HGetAll("character:" + characterID + ":settings")
-	teammatesCmd := pip.SMembers("character:" + characterID + ":teammates")
-	friendsCmd := pip.SMembers("character:" + characterID + ":friends")
-	requestsCmd := pip.SMembers("character:" + characterID + ":requests")
-	projectIDCmd := pip.Get("character:" + characterID + ":project")
-	eventsCmd := pip.SMembers("events")
-	pip.Exec()
-
-	room := new(models.Room).Init()
-	roomRes, _ := roomCmd.Result()
-	utils.Bind(roomRes, room)
-	room.ID = roomID
-
-	character := new(models.Character)
-	characterRes, _ := characterCmd.Result()
-	utils.Bind(characterRes, character)
-	character.ID = characterID
+	// The range of protocol versions this server speaks
+	MinProtocolVersion int `json:"minProtocolVersion"`
+	MaxProtocolVersion int `json:"maxProtocolVersion"`
 
-	// Load additional room stuff
-	pip = db.GetInstance().Pipeline()
-
-	characterIDs, _ := roomCharactersCmd.Result()
-	characterCmds := make([]*redis.StringStringMapCmd, len(characterIDs))
-
-	for i, characterID := range characterIDs {
-		characterCmds[i] = pip.HGetAll("character:" + characterID)
-	}
-
-	elementIDs, _ := roomElementsCmd.Result()
-	elementCmds := make([]*redis.StringStringMapCmd, len(elementIDs))
-
-	for i, elementID := range elementIDs {
-		elementCmds[i] = pip.HGetAll("element:" + elementID)
-	}
-
-	hallwayIDs, _ := roomHallwaysCmd.Result()
-	hallwayCmds := make([]*redis.StringStringMapCmd, len(hallwayIDs))
-
-	for i, hallwayID := range hallwayIDs {
-		hallwayCmds[i] = pip.HGetAll("hallway:" + hallwayID)
-	}
-
-	eventIDs, _ := eventsCmd.Result()
-	eventCmds := make([]*redis.StringStringMapCmd, len(eventIDs))
-
-	for i, eventID := range eventIDs {
-		eventCmds[i] = pip.HGetAll("event:" + eventID)
-	}
+	// Capabilities that both the client and server support
+	Capabilities []string `json:"capabilities,omitempty"`
+}
 
-	projectIDCmds := make([]*redis.StringCmd, len(characterIDs))
+func NewInitPacket(characterID, roomID string, needsToken bool) *InitPacket {
+	// Fetch character and room from the database
+	store := db.GetStore()
+	room, err := store.Rooms.Get(roomID)
 
-	if strings.HasPrefix(roomID, "arena:") {
-		for i, characterID := range characterIDs {
-			projectIDCmds[i] = pip.Get("character:" + characterID + ":project")
-		}
+	if err != nil {
+		room = new(models.Room).Init()
+		room.ID = roomID
 	}
 
-	// Get friends
-	teammateIDs, _ := teammatesCmd.Result()
-	friendIDs, _ := friendsCmd.Result()
-	requestIDs, _ := requestsCmd.Result()
-
-	teammateCmds := make([]*redis.StringStringMapCmd, len(teammateIDs))
-	teammateStatusCmds := make([]*redis.StringCmd, len(teammateIDs))
+	character, err := store.Characters.Get(characterID)
 
-	friendCmds := make([]*redis.StringStringMapCmd, len(friendIDs))
-	friendStatusCmds := make([]*redis.StringCmd, len(friendIDs))
-
-	requestCmds := make([]*redis.StringStringMapCmd, len(requestIDs))
-
-	for i, id := range teammateIDs {
-		teammateCmds[i] = pip.HGetAll("character:" + id)
-		teammateStatusCmds[i] = pip.Get("character:" + id + ":active")
+	if err != nil {
+		character = &models.Character{ID: characterID}
 	}
 
-	for i, id := range friendIDs {
-		friendCmds[i] = pip.HGetAll("character:" + id)
-		friendStatusCmds[i] = pip.Get("character:" + id + ":active")
-	}
+	// Load additional room stuff
+	characterIDs, _ := store.Rooms.Characters(roomID)
+	characters, _ := store.Characters.GetMany(characterIDs)
 
-	for i, id := range requestIDs {
-		requestCmds[i] = pip.HGetAll("character:" + id)
+	for _, roomCharacter := range characters {
+		roomCharacter.Email = ""
+		room.Characters[roomCharacter.ID] = roomCharacter
 	}
 
-	var sponsorCmd *redis.StringStringMapCmd
+	room.Elements, _ = store.Rooms.Elements(roomID)
+	room.Hallways, _ = store.Rooms.Hallways(roomID)
 
 	if len(room.SponsorID) > 0 {
-		sponsorCmd = pip.HGetAll("sponsor:" + room.SponsorID)
-	}
-
-	pip.Exec()
-
-	for i, characterCmd := range characterCmds {
-		characterRes, _ := characterCmd.Result()
-		room.Characters[characterIDs[i]] = new(models.Character)
-		utils.Bind(characterRes, room.Characters[characterIDs[i]])
-		room.Characters[characterIDs[i]].ID = characterIDs[i]
-		room.Characters[characterIDs[i]].Email = ""
-	}
-
-	for i, elementCmd := range elementCmds {
-		elementRes, _ := elementCmd.Result()
-		room.Elements = append(room.Elements, new(models.Element))
-		utils.Bind(elementRes, room.Elements[i])
-		room.Elements[i].ID = elementIDs[i]
+		room.Sponsor, _ = store.Sponsors.Get(room.SponsorID)
 	}
 
-	for i, hallwayCmd := range hallwayCmds {
-		hallwayRes, _ := hallwayCmd.Result()
-		room.Hallways[hallwayIDs[i]] = new(models.Hallway)
-		utils.Bind(hallwayRes, room.Hallways[hallwayIDs[i]])
-	}
-
-	if len(room.SponsorID) > 0 {
-		sponsorRes, _ := sponsorCmd.Result()
-		sponsor := new(models.Sponsor)
-		utils.Bind(sponsorRes, sponsor)
-		sponsor.ID = room.SponsorID
-		room.Sponsor = sponsor
-	}
+	// Get friends
+	teammateIDs, _ := store.Friends.Teammates(characterID)
+	friendIDs, _ := store.Friends.Friends(characterID)
+	requestIDs, _ := store.Friends.Requests(characterID)
 
 	// Set data and return
 	p := new(InitPacket)
 	p.BasePacket = BasePacket{Type: "init"}
 	p.Character = character
+	p.MinProtocolVersion = config.GetConfig().GetInt("socket.protocol.min_version")
+	p.MaxProtocolVersion = config.GetConfig().GetInt("socket.protocol.max_version")
 
 	feedbackOpen := time.Unix(config.GetConfig().GetInt64("feedback_open"), 0)
 
 	if !character.FeedbackOpened && time.Now().After(feedbackOpen) {
 		p.OpenFeedback = true
-		db.GetInstance().HSet("character:"+characterID, "feedbackOpened", true)
+		store.Characters.Update(characterID, map[string]interface{}{
+			"feedbackOpened": true,
+		})
 	}
 
 	p.Room = room
 
 	// Set friends
-	i := 0
-	p.Friends = make([]Friend, len(teammateIDs)+len(friendIDs)+len(requestIDs))
-
-	for j, cmd := range teammateCmds {
-		data, _ := cmd.Result()
-		res := new(models.Character)
-		utils.Bind(data, res)
-
-		active, _ := teammateStatusCmds[j].Result()
-		status := 2
-
-		if active == "true" {
-			status = 0
-		}
-
-		p.Friends[i] = Friend{
-			ID:       teammateIDs[j],
-			Name:     res.Name,
-			School:   res.School,
-			Status:   status,
-			Teammate: true,
-			LastSeen: time.Now(),
-		}
-
-		i++
-	}
+	p.Friends = make([]Friend, 0, len(teammateIDs)+len(friendIDs)+len(requestIDs))
+	p.Friends = append(p.Friends, loadFriends(teammateIDs, true, false)...)
+	p.Friends = append(p.Friends, loadFriends(friendIDs, false, false)...)
+	p.Friends = append(p.Friends, loadFriends(requestIDs, false, true)...)
 
-	for j, cmd := range friendCmds {
-		data, _ := cmd.Result()
-		res := new(models.Character)
-		utils.Bind(data, res)
-
-		active, _ := friendStatusCmds[j].Result()
-		status := 2
-
-		if active == "true" {
-			status = 0
-		}
-
-		p.Friends[i] = Friend{
-			ID:       friendIDs[j],
-			Name:     res.Name,
-			School:   res.School,
-			Status:   status,
-			LastSeen: time.Now(),
-		}
-
-		i++
-	}
-
-	for j, cmd := range requestCmds {
-		data, _ := cmd.Result()
-		res := new(models.Character)
-		utils.Bind(data, res)
-
-		p.Friends[i] = Friend{
-			ID:       requestIDs[j],
-			Name:     res.Name,
-			School:   res.School,
-			Status:   2,
-			Pending:  true,
-			LastSeen: time.Now(),
-		}
-
-		i++
-	}
-
-	p.Events = make([]*models.Event, len(eventIDs))
-	for i, eventCmd := range eventCmds {
-		eventRes, _ := eventCmd.Result()
-		p.Events[i] = new(models.Event)
-		utils.Bind(eventRes, p.Events[i])
-	}
+	p.Events, _ = store.Events.List()
 
 	if strings.HasPrefix(roomID, "arena:") {
 		// Load projects
-		pip = db.GetInstance().Pipeline()
-		projectCmds := make(map[string]*redis.StringStringMapCmd)
+		seen := map[string]bool{}
+		p.Projects = []*models.Project{}
 
-		for _, cmd := range projectIDCmds {
-			projectID, err := cmd.Result()
+		for _, id := range characterIDs {
+			projectID, _ := store.Characters.ProjectID(id)
 
-			if err != nil || len(projectID) == 0 {
+			if len(projectID) == 0 || seen[projectID] {
 				continue
 			}
 
-			if _, ok := projectCmds[projectID]; ok {
-				continue
-			}
-
-			projectCmds[projectID] = pip.HGetAll("project:" + projectID)
-		}
-
-		pip.Exec()
-
-		p.Projects = make([]*models.Project, len(projectCmds))
-		i := 0
+			seen[projectID] = true
 
-		for _, cmd := range projectCmds {
-			projectRes, _ := cmd.Result()
-			p.Projects[i] = new(models.Project)
-			utils.Bind(projectRes, p.Projects[i])
-			i++
+			if project, err := store.Projects.Get(projectID); err == nil {
+				p.Projects = append(p.Projects, project)
+			}
 		}
 	}
 
 	if needsToken {
 		// Generate a JWT
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id": characterID,
-		})
-
-		tokenString, _ := token.SignedString([]byte(config.GetSecret("JWT_SECRET")))
-		p.Token = tokenString
+		if tokens, err := auth.IssueTokens(characterID); err == nil {
+			p.Token = tokens.Token
+			p.RefreshToken = tokens.RefreshToken
+		} else {
+			log.Println("ERROR: Unable to issue tokens ->", err)
+		}
 	}
 
 	// Find all of the possible paths
@@ -344,25 +184,61 @@ func NewInitPacket(characterID, roomID string, needsToken bool) *InitPacket {
 	// }
 
 	// Get all room names
-	p.RoomNames, _ = db.GetInstance().SMembers("rooms").Result()
+	p.RoomNames, _ = store.Rooms.List()
 
 	// Get settings
-	p.Settings = new(models.Settings)
-	settingsRes, _ := settingsCmd.Result()
-	utils.Bind(settingsRes, p.Settings)
+	p.Settings, _ = store.Characters.Settings(characterID)
 
 	// Get project
-	projectID, err := projectIDCmd.Result()
+	projectID, _ := store.Characters.ProjectID(characterID)
 
-	if err == nil && len(projectID) > 0 {
-		projectRes, _ := db.GetInstance().HGetAll("project:" + projectID).Result()
-		p.Character.Project = new(models.Project)
-		utils.Bind(projectRes, p.Character.Project)
+	if len(projectID) > 0 {
+		p.Character.Project, _ = store.Projects.Get(projectID)
 	}
 
 	return p
 }
 
+// Loads the friends list entries for these characters
+func loadFriends(ids []string, teammates, pending bool) []Friend {
+	characters, _ := db.GetStore().Characters.GetMany(ids)
+	active := make([]bool, len(characters))
+
+	if !pending {
+		characterIDs := make([]string, len(characters))
+
+		for i, character := range characters {
+			characterIDs[i] = character.ID
+		}
+
+		if statuses, err := db.GetStore().Characters.Active(characterIDs); err == nil {
+			active = statuses
+		}
+	}
+
+	friends := make([]Friend, len(characters))
+
+	for i, character := range characters {
+		status := 2
+
+		if active[i] {
+			status = 0
+		}
+
+		friends[i] = Friend{
+			ID:       character.ID,
+			Name:     character.Name,
+			School:   character.School,
+			Status:   status,
+			Teammate: teammates,
+			Pending:  pending,
+			LastSeen: time.Now(),
+		}
+	}
+
+	return friends
+}
+
 func (p InitPacket) MarshalBinary() ([]byte, error) {
 	return json.Marshal(p)
 }
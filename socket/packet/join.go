@@ -6,7 +6,6 @@ import (
 
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 )
 
 // Sent by clients after receiving the init packet. Identifies them to the
@@ -20,9 +19,24 @@ type JoinPacket struct {
 	QuillToken string `json:"quillToken,omitempty"`
 	Token      string `json:"token,omitempty"`
 
+	// Used instead of the token once it expires
+	RefreshToken string `json:"refreshToken,omitempty"`
+
 	Email string `json:"email,omitempty"`
 	Code  int    `json:"code,omitempty"`
 
+	// An ID token from an OpenID Connect provider
+	IDToken string `json:"idToken,omitempty"`
+
+	// Optional -- which login provider to use, if more than one could accept
+	// these credentials
+	Provider string `json:"provider,omitempty"`
+
+	// The protocol version the client speaks, and the optional features it
+	// supports. Clients that don't send a version are on version 1
+	ProtocolVersion int      `json:"protocolVersion,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+
 	// Server attributes
 	Character *models.Character `json:"character"`
 	ClientID  string            `json:"clientId,omitempty"`
@@ -44,18 +58,16 @@ func NewJoinPacket(character *models.Character, room string) *JoinPacket {
 }
 
 func (p *JoinPacket) SetProject() {
-	projectID, err := db.GetInstance().Get("character:" + p.Character.ID + ":project").Result()
+	projectID, err := db.GetStore().Characters.ProjectID(p.Character.ID)
 
 	if err != nil || len(projectID) == 0 {
 		return
 	}
 
-	p.Project = new(models.Project)
-	projectRes, _ := db.GetInstance().HGetAll("project:" + projectID).Result()
-	utils.Bind(projectRes, p.Project)
+	p.Project, _ = db.GetStore().Projects.Get(projectID)
 }
 
-func (p JoinPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p JoinPacket) PermissionCheck(characterID string) bool {
 	return true
 }
 
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by ingests when a user opens the jukebox for the first time
@@ -25,7 +23,7 @@ func (p *JukeboxWarningPacket) Init() *JukeboxWarningPacket {
 	return p
 }
 
-func (p JukeboxWarningPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p JukeboxWarningPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -26,7 +26,7 @@ func NewLeavePacket(character *models.Character, room string) *LeavePacket {
 	return p
 }
 
-func (p LeavePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p LeavePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
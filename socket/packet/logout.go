@@ -0,0 +1,43 @@
+package packet
+
+import (
+	"encoding/json"
+)
+
+// Sent by clients when they log out, with the tokens they want revoked. Sent
+// by the server to every client of a character whose sessions have been
+// ended, right before they're disconnected
+type LogoutPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	// Client attributes
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+
+	// Server attributes
+	CharacterID string `json:"characterId,omitempty"`
+
+	// Why they're being logged out, e.g. "logout" or "revoked"
+	Reason string `json:"reason,omitempty"`
+}
+
+func NewLogoutPacket(characterID, reason string) *LogoutPacket {
+	p := new(LogoutPacket)
+	p.BasePacket = BasePacket{Type: "logout"}
+	p.CharacterID = characterID
+	p.Reason = reason
+	return p
+}
+
+func (p LogoutPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p LogoutPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *LogoutPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
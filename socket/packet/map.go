@@ -3,10 +3,8 @@ package packet
 import (
 	"encoding/json"
 
-	"github.com/go-redis/redis/v7"
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 )
 
 type MapPacket struct {
@@ -17,24 +15,8 @@ type MapPacket struct {
 }
 
 func NewMapPacket() *MapPacket {
-	// Load locations from Redis
-	locationIDs, _ := db.GetInstance().SMembers("locations").Result()
-
-	pip := db.GetInstance().Pipeline()
-	locationCmds := make([]*redis.StringStringMapCmd, len(locationIDs))
-
-	for i, locationID := range locationIDs {
-		locationCmds[i] = pip.HGetAll("location:" + locationID)
-	}
-
-	pip.Exec()
-	locations := make([]*models.Location, len(locationCmds))
-
-	for i, locationCmd := range locationCmds {
-		locationRes, _ := locationCmd.Result()
-		locations[i] = new(models.Location)
-		utils.Bind(locationRes, locations[i])
-	}
+	// Load locations from the database
+	locations, _ := db.GetStore().Locations.List()
 
 	// Send locations back to client
 	return &MapPacket{
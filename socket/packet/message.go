@@ -12,7 +12,7 @@ type MessagePacket struct {
 	*models.Message
 }
 
-func (p MessagePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p MessagePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by clients when they move around
@@ -36,7 +34,7 @@ func NewMovePacket(id, room string, x, y float64) *MovePacket {
 	}
 }
 
-func (p MovePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p MovePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
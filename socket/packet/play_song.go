@@ -31,7 +31,7 @@ func (p *PlaySongPacket) Init(song *models.Song) *PlaySongPacket {
 	return p
 }
 
-func (p PlaySongPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p PlaySongPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
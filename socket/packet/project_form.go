@@ -15,7 +15,7 @@ type ProjectFormPacket struct {
 	*models.Project
 }
 
-func (p ProjectFormPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p ProjectFormPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -3,7 +3,7 @@ package packet
 import (
 	"encoding/json"
 
-	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by hackers to join a sponsor's queue
@@ -14,8 +14,12 @@ type QueueJoinPacket struct {
 	Interests []string `json:"interests"`
 }
 
-func (p QueueJoinPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && (role == models.Hacker || role == models.Organizer)
+func (p QueueJoinPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p QueueJoinPacket) RequiredCapability(characterID string) string {
+	return permissions.QueueJoin
 }
 
 func (p QueueJoinPacket) MarshalBinary() ([]byte, error) {
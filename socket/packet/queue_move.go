@@ -0,0 +1,35 @@
+package packet
+
+import (
+	"encoding/json"
+
+	"github.com/techx/playground/permissions"
+)
+
+// Sent by sponsors to move a hacker to a different spot in their queue
+type QueueMovePacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	SponsorID   string `json:"sponsorId"`
+	CharacterID string `json:"characterId"`
+
+	// Where to put the hacker, starting from 1
+	Position int `json:"position"`
+}
+
+func (p QueueMovePacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p QueueMovePacket) RequiredCapability(characterID string) string {
+	return permissions.QueueManage(p.SponsorID)
+}
+
+func (p QueueMovePacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *QueueMovePacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
@@ -0,0 +1,32 @@
+package packet
+
+import (
+	"encoding/json"
+
+	"github.com/techx/playground/permissions"
+)
+
+// Sent by sponsors to take the next hacker off their queue
+type QueueNextPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	SponsorID string `json:"sponsorId"`
+	Zoom      string `json:"zoom"`
+}
+
+func (p QueueNextPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p QueueNextPacket) RequiredCapability(characterID string) string {
+	return permissions.QueueManage(p.SponsorID)
+}
+
+func (p QueueNextPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *QueueNextPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
@@ -3,7 +3,7 @@ package packet
 import (
 	"encoding/json"
 
-	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by hackers to take themselves off queue
@@ -15,14 +15,17 @@ type QueueRemovePacket struct {
 	Zoom        string `json:"zoom"`
 }
 
-func (p QueueRemovePacket) PermissionCheck(characterID string, role models.Role) bool {
-	if len(characterID) == 0 {
-		// User is not signed in
-		return false
+func (p QueueRemovePacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p QueueRemovePacket) RequiredCapability(characterID string) string {
+	if characterID == p.CharacterID {
+		// Hackers can always take themselves off the queue
+		return ""
 	}
 
-	// Can remove if the hacker is removing themself, or if the sponsor is taking them off the queue
-	return role == models.SponsorRep || characterID == p.CharacterID
+	return permissions.QueueManage(p.SponsorID)
 }
 
 func (p QueueRemovePacket) MarshalBinary() ([]byte, error) {
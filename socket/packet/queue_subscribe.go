@@ -15,7 +15,7 @@ type QueueSubscribePacket struct {
 	Characters []*models.Character `json:"characters"`
 }
 
-func (p QueueSubscribePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p QueueSubscribePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // sent by hackers and sponsors to unsubscribe to queue updates
@@ -13,7 +11,7 @@ type QueueUnsubscribePacket struct {
 	SponsorID string `json:"sponsorId"`
 }
 
-func (p QueueUnsubscribePacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p QueueUnsubscribePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
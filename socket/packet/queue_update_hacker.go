@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by server to update a hacker on their position in the queue
@@ -30,7 +28,7 @@ func NewQueueUpdateHackerPacket(sponsorID string, position int, url string) *Que
 }
 
 // This isn't needed -- remove later
-func (p QueueUpdateHackerPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p QueueUpdateHackerPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
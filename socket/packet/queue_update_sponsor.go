@@ -26,7 +26,7 @@ func NewQueueUpdateSponsorPacket(subscribers []*models.QueueSubscriber) *QueueUp
 }
 
 // This isn't needed -- remove later
-func (p QueueUpdateSponsorPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p QueueUpdateSponsorPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -0,0 +1,31 @@
+package packet
+
+import (
+	"encoding/json"
+)
+
+// Sent by ingests that are shutting down, right before they close every
+// connection. Clients should connect again, which will land them on another
+// ingest, instead of waiting to resume their session here
+type ReconnectPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	// Why the ingest is going away, e.g. "shutdown"
+	Reason string `json:"reason"`
+}
+
+func NewReconnectPacket(reason string) *ReconnectPacket {
+	p := new(ReconnectPacket)
+	p.BasePacket = BasePacket{Type: "reconnect"}
+	p.Reason = reason
+	return p
+}
+
+func (p ReconnectPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *ReconnectPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
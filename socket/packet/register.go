@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 
 	webpush "github.com/SherClockHolmes/webpush-go"
-	"github.com/techx/playground/db/models"
 )
 
 type RegisterPacket struct {
@@ -18,7 +17,7 @@ type RegisterPacket struct {
 	BrowserSubscription *webpush.Subscription `json:"browserSubscription"`
 }
 
-func (p RegisterPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p RegisterPacket) PermissionCheck(characterID string) bool {
 	return true
 }
 
@@ -0,0 +1,47 @@
+package packet
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// Decoder turns raw packet data into a concrete packet
+type Decoder func(data []byte) (Packet, error)
+
+var (
+	decoders   = map[string]Decoder{}
+	decodersMu sync.RWMutex
+)
+
+// Register associates one or more packet type identifiers with a decoder.
+// Registering an identifier that already exists replaces its decoder, which
+// lets forks override the behavior of built-in packets
+func Register(decoder Decoder, types ...string) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	for _, t := range types {
+		decoders[t] = decoder
+	}
+}
+
+// NewDecoder returns a decoder that unmarshals data into a fresh value of the
+// same type as prototype, e.g. NewDecoder(ChatPacket{})
+func NewDecoder(prototype Packet) Decoder {
+	typ := reflect.TypeOf(prototype)
+
+	return func(data []byte) (Packet, error) {
+		p := reflect.New(typ)
+		json.Unmarshal(data, p.Interface())
+		return p.Elem().Interface().(Packet), nil
+	}
+}
+
+func getDecoder(packetType string) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	decoder, ok := decoders[packetType]
+	return decoder, ok
+}
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type ReportPacket struct {
@@ -14,7 +12,7 @@ type ReportPacket struct {
 	Text        string `json:"text"`
 }
 
-func (p ReportPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p ReportPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -0,0 +1,30 @@
+package packet
+
+import (
+	"encoding/json"
+)
+
+// Sent by clients as their first packet when they reconnect, to pick up the
+// session they had before their connection dropped
+type ResumePacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	// The session they had before
+	SessionID string `json:"sessionId"`
+
+	// The last sequence number they saw
+	Seq uint64 `json:"seq"`
+
+	// The same access token they'd join with. It has to belong to the
+	// session's character
+	Token string `json:"token"`
+}
+
+func (p ResumePacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *ResumePacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
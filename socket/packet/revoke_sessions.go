@@ -0,0 +1,32 @@
+package packet
+
+import (
+	"encoding/json"
+
+	"github.com/techx/playground/permissions"
+)
+
+// Sent by organizers to revoke every token a character has been given and
+// disconnect them everywhere, e.g. if their account was compromised
+type RevokeSessionsPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	CharacterID string `json:"characterId"`
+}
+
+func (p RevokeSessionsPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p RevokeSessionsPacket) RequiredCapability(characterID string) string {
+	return permissions.SessionsRevoke
+}
+
+func (p RevokeSessionsPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *RevokeSessionsPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
@@ -3,7 +3,7 @@ package packet
 import (
 	"encoding/json"
 
-	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by clients when they're adding an element
@@ -21,8 +21,12 @@ type RoomAddPacket struct {
 	Sponsor bool `json:"sponsor"`
 }
 
-func (p RoomAddPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return role == models.Organizer
+func (p RoomAddPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p RoomAddPacket) RequiredCapability(characterID string) string {
+	return permissions.WorldEdit
 }
 
 func (p RoomAddPacket) MarshalBinary() ([]byte, error) {
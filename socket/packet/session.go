@@ -0,0 +1,35 @@
+package packet
+
+import (
+	"encoding/json"
+)
+
+// Sent by ingests as soon as a client connects, before any numbered packets.
+// Clients hold on to the session ID so they can resume after a reconnect
+type SessionPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	// Identifies this session when reconnecting
+	SessionID string `json:"sessionId"`
+
+	// True if the client reconnected to an existing session. Any packets they
+	// missed will follow this one
+	Resumed bool `json:"resumed"`
+}
+
+func NewSessionPacket(sessionID string, resumed bool) *SessionPacket {
+	p := new(SessionPacket)
+	p.BasePacket = BasePacket{Type: "session"}
+	p.SessionID = sessionID
+	p.Resumed = resumed
+	return p
+}
+
+func (p SessionPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *SessionPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
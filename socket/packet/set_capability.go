@@ -0,0 +1,37 @@
+package packet
+
+import (
+	"encoding/json"
+
+	"github.com/techx/playground/permissions"
+)
+
+// Sent by organizers to grant or deny a capability to one character, no matter
+// what their role says (see the permissions package)
+type SetCapabilityPacket struct {
+	BasePacket
+	Packet `json:",omitempty"`
+
+	CharacterID string `json:"characterId"`
+	Capability  string `json:"capability"`
+
+	// True to grant it, false to deny it, or left out to go back to whatever
+	// their role says
+	Granted *bool `json:"granted"`
+}
+
+func (p SetCapabilityPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p SetCapabilityPacket) RequiredCapability(characterID string) string {
+	return permissions.PermissionsManage
+}
+
+func (p SetCapabilityPacket) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *SetCapabilityPacket) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, p)
+}
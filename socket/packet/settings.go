@@ -21,7 +21,7 @@ type SettingsPacket struct {
 	Zoom     string `json:"zoom"`
 }
 
-func (p SettingsPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p SettingsPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
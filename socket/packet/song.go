@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 // Sent by ingests when a song is added to queue
@@ -23,8 +24,16 @@ func (p *SongPacket) Init(song *models.Song) *SongPacket {
 	return p
 }
 
-func (p SongPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && (!p.Remove || role == models.Organizer)
+func (p SongPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p SongPacket) RequiredCapability(characterID string) string {
+	if p.Remove {
+		return permissions.JukeboxRemove
+	}
+
+	return ""
 }
 
 func (p SongPacket) MarshalBinary() ([]byte, error) {
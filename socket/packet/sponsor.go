@@ -5,7 +5,6 @@ import (
 
 	"github.com/techx/playground/db"
 	"github.com/techx/playground/db/models"
-	"github.com/techx/playground/utils"
 )
 
 type SponsorPacket struct {
@@ -16,15 +15,17 @@ type SponsorPacket struct {
 }
 
 func NewSponsorPacket(sponsorID string) *SponsorPacket {
-	var sponsor models.Sponsor
-	sponsorRes, _ := db.GetInstance().HGetAll("sponsor:" + sponsorID).Result()
-	utils.Bind(sponsorRes, &sponsor)
+	sponsor, err := db.GetStore().Sponsors.Get(sponsorID)
+
+	if err != nil {
+		sponsor = new(models.Sponsor)
+	}
 
 	return &SponsorPacket{
 		BasePacket: BasePacket{
 			Type: "sponsor",
 		},
-		Sponsor: &sponsor,
+		Sponsor: sponsor,
 	}
 }
 
@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 // Sent by clients when the window gains or loses focus
@@ -36,7 +34,7 @@ func NewStatusPacket(characterID string, online bool) *StatusPacket {
 	}
 }
 
-func (p StatusPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p StatusPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
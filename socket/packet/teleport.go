@@ -38,7 +38,7 @@ func NewTeleportPacket(character *models.Character, from, to string) *TeleportPa
 	return p
 }
 
-func (p TeleportPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p TeleportPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -12,7 +12,7 @@ type UpdateMapPacket struct {
 	*models.Location `json:"location"`
 }
 
-func (p UpdateMapPacket) PermissionCheck(characterID string, role models.Role) bool {
+func (p UpdateMapPacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
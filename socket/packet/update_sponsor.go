@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
 )
 
 type UpdateSponsorPacket struct {
@@ -14,8 +15,16 @@ type UpdateSponsorPacket struct {
 	SetQueueOpen bool `json:"setQueueOpen"`
 }
 
-func (p UpdateSponsorPacket) PermissionCheck(characterID string, role models.Role) bool {
-	return len(characterID) > 0 && (role == models.SponsorRep || role == models.Organizer)
+func (p UpdateSponsorPacket) PermissionCheck(characterID string) bool {
+	return len(characterID) > 0
+}
+
+func (p UpdateSponsorPacket) RequiredCapability(characterID string) string {
+	if p.Sponsor == nil {
+		return permissions.SponsorsEdit("")
+	}
+
+	return permissions.SponsorsEdit(p.Sponsor.ID)
 }
 
 func (p UpdateSponsorPacket) MarshalBinary() ([]byte, error) {
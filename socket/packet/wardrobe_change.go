@@ -2,8 +2,6 @@ package packet
 
 import (
 	"encoding/json"
-
-	"github.com/techx/playground/db/models"
 )
 
 type WardrobeChangePacket struct {
@@ -19,11 +17,7 @@ type WardrobeChangePacket struct {
 	PantsColor string `json:"pantsColor"`
 }
 
-func (p WardrobeChangePacket) PermissionCheck(characterID string, role models.Role) bool {
-	if role == models.Organizer {
-		return true
-	}
-
+func (p WardrobeChangePacket) PermissionCheck(characterID string) bool {
 	return len(characterID) > 0
 }
 
@@ -0,0 +1,32 @@
+package socket
+
+import (
+	"log"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/db/models"
+)
+
+func (h *Hub) initPacketLog() {
+	h.redactedFields = map[string][]string{}
+
+	for packetType := range config.GetConfig().GetStringMap("logs.redact") {
+		h.redactedFields[packetType] = config.GetConfig().GetStringSlice("logs.redact." + packetType)
+	}
+}
+
+// Records a packet that a client sent, leaving out any secrets in it (like
+// login tokens) so they never end up in the database or the archive
+func (h *Hub) logPacket(characterID, packetType string, msg []byte) {
+	message, err := db.RedactFields(msg, h.redactedFields[packetType])
+
+	if err != nil {
+		// processMessage already decoded this, so it should never happen
+		return
+	}
+
+	if err := db.GetStore().Logs.Add(models.NewLog(characterID, packetType, string(message))); err != nil {
+		log.Println("ERROR: Unable to log packet ->", err)
+	}
+}
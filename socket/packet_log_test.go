@@ -0,0 +1,58 @@
+package socket
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/techx/playground/db"
+)
+
+func TestLogPacket(t *testing.T) {
+	h := testHub
+
+	tests := []struct {
+		packetType string
+		msg        string
+		expected   string
+	}{
+		{"chat", `{"type":"chat","mssg":"hi"}`, `{"type":"chat","mssg":"hi"}`},
+		{"join", `{"type":"join","token":"secret"}`, `{"token":"[redacted]","type":"join"}`},
+		{"auth", `{"type":"auth","email":"a@example.com","code":123456}`, `{"code":"[redacted]","email":"[redacted]","type":"auth"}`},
+		{"register", `{"type":"register","phoneNumber":"5555555555","name":"a"}`, `{"name":"a","phoneNumber":"[redacted]","type":"register"}`},
+	}
+
+	for _, test := range tests {
+		characterID := uuid.New().String()
+		h.logPacket(characterID, test.packetType, []byte(test.msg))
+
+		logs, err := db.GetStore().Logs.Query(db.LogFilter{CharacterID: characterID})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(logs) != 1 {
+			t.Fatalf("%s: expected 1 log, got %d", test.packetType, len(logs))
+		}
+
+		if logs[0].Type != test.packetType || logs[0].Message != test.expected {
+			t.Errorf("%s: expected %s, got %+v", test.packetType, test.expected, logs[0])
+		}
+	}
+}
+
+func TestProcessMessageLogs(t *testing.T) {
+	h := testHub
+	client := newTestClient(h)
+
+	h.processMessage(&SocketMessage{
+		msg:    []byte(`{"type":"chat","mssg":"hi everyone"}`),
+		sender: client,
+	})
+
+	logs, _ := db.GetStore().Logs.Query(db.LogFilter{CharacterID: client.character.ID})
+
+	if len(logs) != 1 || logs[0].Type != "chat" {
+		t.Errorf("expected the chat packet to be logged, got %v", logs)
+	}
+}
@@ -0,0 +1,81 @@
+package socket
+
+import (
+	"log"
+	"sort"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/socket/packet"
+)
+
+// Clients with this capability get a reason and message with every error,
+// rather than just a code
+const errorReasonsCapability = "error_reasons"
+
+// Checks that we speak the protocol version of a client who's joining, and
+// works out which capabilities we both support. Sends the client an error and
+// returns false if they're too old or too new for us
+func (h *Hub) negotiateProtocol(m *SocketMessage, p packet.JoinPacket) bool {
+	version := p.ProtocolVersion
+
+	if version == 0 {
+		// Clients from before we started versioning the protocol
+		version = 1
+	}
+
+	minVersion := config.GetConfig().GetInt("socket.protocol.min_version")
+	maxVersion := config.GetConfig().GetInt("socket.protocol.max_version")
+
+	if version < minVersion || version > maxVersion {
+		log.Println("Refusing client", m.sender.id, "with protocol version", version)
+		h.sendError(m, IncompatibleProtocol)
+		return false
+	}
+
+	supported := map[string]bool{}
+
+	for _, capability := range config.GetConfig().GetStringSlice("socket.protocol.capabilities") {
+		supported[capability] = true
+	}
+
+	m.sender.protocolVersion = version
+	m.sender.capabilities = map[string]bool{}
+
+	for _, capability := range p.Capabilities {
+		if supported[capability] {
+			m.sender.capabilities[capability] = true
+		}
+	}
+
+	return true
+}
+
+// ProtocolVersion returns the protocol version this client joined with. Must be
+// called from a packet handler
+func (c *Client) ProtocolVersion() int {
+	return c.protocolVersion
+}
+
+// Supports returns true if both this client and the server support a
+// capability. Must be called from a packet handler
+func (c *Client) Supports(capability string) bool {
+	return c.capabilities[capability]
+}
+
+// Returns true once we've negotiated a protocol with this client. Must be
+// called from a packet handler
+func (c *Client) joined() bool {
+	return c.capabilities != nil
+}
+
+// Returns the capabilities we agreed on with this client, in a stable order
+func (c *Client) capabilityList() []string {
+	capabilities := make([]string, 0, len(c.capabilities))
+
+	for capability := range c.capabilities {
+		capabilities = append(capabilities, capability)
+	}
+
+	sort.Strings(capabilities)
+	return capabilities
+}
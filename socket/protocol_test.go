@@ -0,0 +1,60 @@
+package socket
+
+import (
+	"testing"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/socket/packet"
+)
+
+func TestErrorReasonsCapability(t *testing.T) {
+	h := testHub
+	defer config.GetConfig().Set("socket.protocol.capabilities", config.GetConfig().GetStringSlice("socket.protocol.capabilities"))
+
+	tests := []struct {
+		name string
+
+		// What the server and client support, or nil for a client who hasn't
+		// joined yet
+		server []string
+		client []string
+
+		reasons bool
+	}{
+		{"not joined yet", []string{"error_reasons"}, nil, true},
+		{"both support it", []string{"error_reasons"}, []string{"error_reasons", "something_new"}, true},
+		{"old client", []string{"error_reasons"}, []string{}, false},
+		{"old server", []string{}, []string{"error_reasons"}, false},
+	}
+
+	for _, test := range tests {
+		config.GetConfig().Set("socket.protocol.capabilities", test.server)
+		client := newTestClient(h)
+		m := &SocketMessage{sender: client, requestID: "1"}
+
+		if test.client != nil && !h.negotiateProtocol(m, packet.JoinPacket{Capabilities: test.client}) {
+			t.Fatalf("%s: expected the protocol to be accepted", test.name)
+		}
+
+		h.sendError(m, RateLimited)
+
+		var res struct {
+			Code      int    `json:"code"`
+			Reason    string `json:"reason"`
+			Message   string `json:"message"`
+			RequestID string `json:"requestId"`
+		}
+
+		receive(t, client, &res)
+
+		if res.Code != int(RateLimited) || res.RequestID != "1" {
+			t.Errorf("%s: expected a rate limited error for request 1, got %+v", test.name, res)
+		}
+
+		if reasons := res.Reason == "rate_limited" && res.Message != ""; reasons != test.reasons {
+			t.Errorf("%s: expected a reason and message: %v, got %+v", test.name, test.reasons, res)
+		} else if !test.reasons && (res.Reason != "" || res.Message != "") {
+			t.Errorf("%s: expected only a code, got %+v", test.name, res)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package socket
+
+import (
+	"log"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// How many packets of a type a client can send: rate per second, with bursts
+// of up to burst packets
+type rateBudget struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst float64 `mapstructure:"burst"`
+}
+
+type rateLimitConfig struct {
+	// Budgets for each packet type, for everyone
+	Packets map[string]rateBudget `mapstructure:"packets"`
+
+	// Budgets for each role, overriding the ones above
+	Roles map[string]map[string]rateBudget `mapstructure:"roles"`
+
+	Escalation struct {
+		// How long to remember a client going over their budget
+		WindowSeconds int `mapstructure:"window_seconds"`
+
+		// How many times a client can go over their budget within the window
+		// before they're muted, and then disconnected
+		MuteAfter       int `mapstructure:"mute_after"`
+		DisconnectAfter int `mapstructure:"disconnect_after"`
+
+		// How long mutes last
+		MuteSeconds int `mapstructure:"mute_seconds"`
+	} `mapstructure:"escalation"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Takes a token from the bucket if there's one left
+func (b *tokenBucket) take(budget rateBudget, now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = budget.Burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * budget.Rate
+
+		if b.tokens > budget.Burst {
+			b.tokens = budget.Burst
+		}
+	}
+
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Keeps track of how fast a client is sending packets. Only touched while
+// holding the client's mu
+type rateLimiter struct {
+	buckets map[string]*tokenBucket
+
+	// Times this client went over budget since windowStart
+	violations  int
+	windowStart time.Time
+
+	mutedUntil time.Time
+}
+
+// Loads rate limits from the config
+func (h *Hub) initRateLimits() {
+	if err := config.GetConfig().UnmarshalKey("socket.rate_limits", &h.rateLimits); err != nil {
+		log.Println("ERROR: Unable to load rate limits ->", err)
+	}
+}
+
+// Returns the budget for a packet type and role, or false if it's unlimited
+func (h *Hub) rateBudget(packetType string, role models.Role) (rateBudget, bool) {
+	if budget, ok := h.rateLimits.Roles[role.String()][packetType]; ok {
+		return budget, true
+	}
+
+	budget, ok := h.rateLimits.Packets[packetType]
+	return budget, ok
+}
+
+// Returns true if this client is allowed to send a packet of this type right
+// now. Clients that keep going over budget are muted and then disconnected
+func (h *Hub) allowPacket(m *SocketMessage, packetType string, role models.Role) bool {
+	budget, ok := h.rateBudget(packetType, role)
+
+	if !ok {
+		return true
+	}
+
+	limiter := &m.sender.limiter
+	now := time.Now()
+
+	if now.Before(limiter.mutedUntil) {
+		// Spamming while muted still counts against them
+		h.rateLimitViolation(m, now, false)
+		return false
+	}
+
+	if limiter.buckets == nil {
+		limiter.buckets = map[string]*tokenBucket{}
+	}
+
+	bucket, ok := limiter.buckets[packetType]
+
+	if !ok {
+		bucket = new(tokenBucket)
+		limiter.buckets[packetType] = bucket
+	}
+
+	if bucket.take(budget, now) {
+		return true
+	}
+
+	h.rateLimitViolation(m, now, true)
+	return false
+}
+
+// Records a client going over their budget, and mutes or disconnects them if
+// they've been doing it a lot
+func (h *Hub) rateLimitViolation(m *SocketMessage, now time.Time, notify bool) {
+	client := m.sender
+	limiter := &client.limiter
+	escalation := h.rateLimits.Escalation
+	window := time.Duration(escalation.WindowSeconds) * time.Second
+
+	if now.Sub(limiter.windowStart) > window {
+		limiter.violations = 0
+		limiter.windowStart = now
+	}
+
+	limiter.violations++
+
+	if notify {
+		h.sendError(m, RateLimited)
+	}
+
+	switch {
+	case escalation.DisconnectAfter > 0 && limiter.violations == escalation.DisconnectAfter:
+		h.kick(client, "rate limited")
+	case escalation.MuteAfter > 0 && limiter.violations == escalation.MuteAfter:
+		log.Println("Muting client", client.id, "for going over their rate limits")
+		limiter.mutedUntil = now.Add(time.Duration(escalation.MuteSeconds) * time.Second)
+	}
+}
+
+// Disconnects a client for good, without letting them resume their session
+func (h *Hub) kick(client *Client, reason string) {
+	client.sendMu.Lock()
+	client.resumable = false
+	client.sendMu.Unlock()
+
+	go client.closeWithReason(websocket.ClosePolicyViolation, reason)
+}
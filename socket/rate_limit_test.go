@@ -0,0 +1,199 @@
+package socket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/wire"
+)
+
+func TestTokenBucket(t *testing.T) {
+	budget := rateBudget{Rate: 2, Burst: 3}
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		after   time.Duration
+		allowed bool
+	}{
+		// Starts full, so the first few go through right away
+		{"first", 0, true},
+		{"second", 0, true},
+		{"third", 0, true},
+		{"over burst", 0, false},
+
+		// Two tokens a second, so one comes back every half second
+		{"too soon", 400 * time.Millisecond, false},
+		{"refilled", 500 * time.Millisecond, true},
+		{"empty again", 500 * time.Millisecond, false},
+
+		// Tokens stop piling up once the bucket is full
+		{"after a break", 10 * time.Second, true},
+		{"still bursting", 10 * time.Second, true},
+		{"burst used up", 10 * time.Second, true},
+		{"capped at burst", 10 * time.Second, false},
+	}
+
+	var bucket tokenBucket
+
+	for _, test := range tests {
+		if allowed := bucket.take(budget, start.Add(test.after)); allowed != test.allowed {
+			t.Errorf("%s: expected %v, got %v", test.name, test.allowed, allowed)
+		}
+	}
+}
+
+// Returns a hub with just enough set up to rate limit packets
+func newRateLimitedHub() *Hub {
+	h := new(Hub)
+	h.rateLimits.Packets = map[string]rateBudget{
+		"chat": {Rate: 0.001, Burst: 2},
+		"move": {Rate: 0.001, Burst: 5},
+	}
+
+	h.rateLimits.Roles = map[string]map[string]rateBudget{
+		"organizer": {"chat": {Rate: 0.001, Burst: 4}},
+	}
+
+	h.rateLimits.Escalation.WindowSeconds = 60
+	h.rateLimits.Escalation.MuteAfter = 3
+	h.rateLimits.Escalation.MuteSeconds = 60
+	h.rateLimits.Escalation.DisconnectAfter = 5
+	return h
+}
+
+// Returns a client that can be sent packets without a connection
+func newRateLimitedClient(h *Hub) *Client {
+	return &Client{
+		hub:    h,
+		id:     "client",
+		send:   make(chan []byte, 64),
+		done:   make(chan struct{}),
+		format: wire.JSON,
+	}
+}
+
+func TestRateBudget(t *testing.T) {
+	h := newRateLimitedHub()
+
+	tests := []struct {
+		packetType string
+		role       models.Role
+		burst      float64
+		limited    bool
+	}{
+		{"chat", models.Hacker, 2, true},
+		{"chat", models.Organizer, 4, true},
+		{"move", models.Organizer, 5, true},
+		{"dance", models.Hacker, 0, false},
+	}
+
+	for _, test := range tests {
+		budget, limited := h.rateBudget(test.packetType, test.role)
+
+		if limited != test.limited || budget.Burst != test.burst {
+			t.Errorf("%s as %s: expected burst %v (limited: %v), got %v (limited: %v)",
+				test.packetType, test.role, test.burst, test.limited, budget.Burst, limited)
+		}
+	}
+}
+
+func TestAllowPacket(t *testing.T) {
+	h := newRateLimitedHub()
+	client := newRateLimitedClient(h)
+	m := &SocketMessage{sender: client, requestID: "7"}
+
+	// Each packet type has its own budget
+	for i := 0; i < 2; i++ {
+		if !h.allowPacket(m, "chat", models.Hacker) {
+			t.Fatalf("chat %d should be allowed", i+1)
+		}
+	}
+
+	if h.allowPacket(m, "chat", models.Hacker) {
+		t.Error("third chat should go over the budget")
+	}
+
+	if !h.allowPacket(m, "move", models.Hacker) {
+		t.Error("moves shouldn't be limited by the chat budget")
+	}
+
+	if !h.allowPacket(m, "dance", models.Hacker) {
+		t.Error("packets without a budget shouldn't be limited")
+	}
+
+	// Going over the budget tells the client
+	select {
+	case msg := <-client.send:
+		var res struct {
+			Type      string `json:"type"`
+			Code      int    `json:"code"`
+			RequestID string `json:"requestId"`
+		}
+
+		json.Unmarshal(msg, &res)
+
+		if res.Type != "error" || res.Code != int(RateLimited) || res.RequestID != "7" {
+			t.Errorf("expected a rate limited error, got %s", msg)
+		}
+	default:
+		t.Error("expected an error packet")
+	}
+}
+
+func TestRateLimitEscalation(t *testing.T) {
+	h := newRateLimitedHub()
+	client := newRateLimitedClient(h)
+	client.resumable = true
+	m := &SocketMessage{sender: client}
+
+	// Pretend the connection is already closing, so kicking them doesn't need
+	// a real one
+	client.closing = 1
+
+	h.allowPacket(m, "chat", models.Hacker)
+	h.allowPacket(m, "chat", models.Hacker)
+
+	tests := []struct {
+		packetType string
+		muted      bool
+		kicked     bool
+	}{
+		{"chat", false, false},
+		{"chat", false, false},
+
+		// Third violation mutes them
+		{"chat", true, false},
+
+		// Everything is blocked while muted, and still counts against them
+		{"move", true, false},
+
+		// Fifth violation disconnects them
+		{"move", true, true},
+	}
+
+	for i, test := range tests {
+		if h.allowPacket(m, test.packetType, models.Hacker) {
+			t.Errorf("packet %d (%s) should have been blocked", i+1, test.packetType)
+		}
+
+		if muted := time.Now().Before(client.limiter.mutedUntil); muted != test.muted {
+			t.Errorf("packet %d: expected muted to be %v", i+1, test.muted)
+		}
+
+		if kicked := !client.resumable; kicked != test.kicked {
+			t.Errorf("packet %d: expected kicked to be %v", i+1, test.kicked)
+		}
+	}
+
+	// Violations are forgotten once the window is over
+	client.limiter.windowStart = time.Now().Add(-2 * time.Minute)
+	client.limiter.mutedUntil = time.Time{}
+	h.rateLimitViolation(m, time.Now(), false)
+
+	if client.limiter.violations != 1 {
+		t.Errorf("expected violations to start over, got %d", client.limiter.violations)
+	}
+}
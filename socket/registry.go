@@ -0,0 +1,91 @@
+package socket
+
+import (
+	"sync"
+
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/permissions"
+	"github.com/techx/playground/socket/packet"
+)
+
+// HandlerFunc processes a packet sent by a client. Handlers run on the worker
+// for the sender's room (see shard.go) while holding the sender's lock, so
+// they're free to touch the sender and anything else only that room's worker
+// touches. Other rooms' handlers run at the same time, so anything shared
+// between rooms (the hub's client and room indexes, other clients) has to go
+// through the hub's methods, which lock it
+type HandlerFunc func(h *Hub, m *SocketMessage, p packet.Packet)
+
+// PermissionFunc returns true when the sender has permission to send p
+type PermissionFunc func(p packet.Packet, characterID string) bool
+
+// PacketHandler describes everything the hub needs to know about a packet
+// that clients can send
+type PacketHandler struct {
+	// The type identifiers of the packets handled here, e.g. "teleport" and
+	// "teleport_home"
+	Types []string
+
+	// Turns raw data into a packet. Usually packet.NewDecoder(SomePacket{})
+	Decode packet.Decoder
+
+	// Optional -- defaults to the packet's own PermissionCheck method
+	PermissionCheck PermissionFunc
+
+	// Does the actual work
+	Handle HandlerFunc
+}
+
+var (
+	handlers   = map[string]*PacketHandler{}
+	handlersMu sync.RWMutex
+)
+
+// RegisterPacket makes a client packet known to the server. Packages outside
+// of socket can call this from an init function to add new packet types
+// without touching the hub. Registering a type that already exists replaces
+// the previous handler
+func RegisterPacket(handler PacketHandler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	for _, t := range handler.Types {
+		handlers[t] = &handler
+	}
+
+	packet.Register(handler.Decode, handler.Types...)
+}
+
+func getHandler(packetType string) (*PacketHandler, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+
+	handler, ok := handlers[packetType]
+	return handler, ok
+}
+
+// Returns true if this character is allowed to send p. Characters are nil
+// until they've joined
+func (ph *PacketHandler) permitted(p packet.Packet, character *models.Character) bool {
+	var characterID string
+
+	if character != nil {
+		characterID = character.ID
+	}
+
+	if ph.PermissionCheck != nil {
+		if !ph.PermissionCheck(p, characterID) {
+			return false
+		}
+	} else if !p.PermissionCheck(characterID) {
+		return false
+	}
+
+	if restricted, ok := p.(packet.Restricted); ok {
+		if capability := restricted.RequiredCapability(characterID); capability != "" {
+			return permissions.Can(character, capability)
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,232 @@
+package socket
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/techx/playground/db"
+	"github.com/techx/playground/socket/packet"
+
+	"github.com/gorilla/websocket"
+)
+
+// A packet along with the Redis channels it's published on. Ingests only
+// subscribe to "room:<id>" and "character:<id>" channels for the rooms and
+// characters of their own clients, plus "all" for packets that go everywhere
+type routedPacket struct {
+	packet   packet.Packet
+	res      map[string]interface{}
+	msg      []byte
+	channels []string
+
+	// The packet without fields that only ingests need, made on demand
+	clientMsg []byte
+}
+
+func newRoutedPacket(msg []byte) (*routedPacket, error) {
+	p, err := packet.ParsePacket(msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &routedPacket{packet: p, msg: msg}
+	json.Unmarshal(msg, &rp.res)
+
+	seen := map[string]bool{}
+	add := func(channel string) {
+		if !seen[channel] {
+			seen[channel] = true
+			rp.channels = append(rp.channels, channel)
+		}
+	}
+
+	switch p := p.(type) {
+	case packet.MessagePacket:
+		add("character:" + p.To)
+		add("character:" + p.From)
+	case packet.ChatPacket, packet.DancePacket, packet.ElementAddPacket, packet.ElementDeletePacket, packet.ElementUpdatePacket, packet.HallwayAddPacket, packet.HallwayUpdatePacket, packet.HallwayDeletePacket, packet.WardrobeChangePacket:
+		room, _ := rp.res["room"].(string)
+		add("room:" + room)
+	case packet.MovePacket:
+		add("room:" + p.Room)
+	case packet.LeavePacket:
+		add("room:" + p.Room)
+	case packet.SongPacket, packet.PlaySongPacket:
+		add("all")
+	case packet.FriendUpdatePacket:
+		add("character:" + p.RecipientID)
+	case packet.JoinPacket:
+		if p.Character != nil {
+			add("character:" + p.Character.ID)
+			add("room:" + p.Character.Room)
+		}
+	case packet.QueueUpdateHackerPacket, packet.QueueUpdateSponsorPacket:
+		characterIDs, _ := rp.res["characterIds"].([]interface{})
+
+		for _, characterID := range characterIDs {
+			if id, ok := characterID.(string); ok {
+				add("character:" + id)
+			}
+		}
+	case packet.StatusPacket:
+		for _, id := range append(p.TeammateIDs, p.FriendIDs...) {
+			add("character:" + id)
+		}
+	case packet.TeleportPacket:
+		add("room:" + p.From)
+		add("room:" + p.To)
+	case packet.LogoutPacket:
+		add("character:" + p.CharacterID)
+	}
+
+	return rp, nil
+}
+
+// Returns the packet to send to clients, without any fields that were only
+// there to route it
+func (rp *routedPacket) clientPayload() []byte {
+	if rp.clientMsg != nil {
+		return rp.clientMsg
+	}
+
+	switch rp.packet.(type) {
+	case packet.FriendUpdatePacket:
+		rp.res["recipientId"] = ""
+	case packet.JoinPacket:
+		rp.res["clientId"] = ""
+	case packet.LogoutPacket:
+		rp.res["characterId"] = ""
+	case packet.QueueUpdateHackerPacket, packet.QueueUpdateSponsorPacket:
+		rp.res["characterIds"] = []interface{}{}
+	case packet.StatusPacket:
+		rp.res["teammateIds"] = []string{}
+		rp.res["friendIds"] = []string{}
+	default:
+		rp.clientMsg = rp.msg
+		return rp.clientMsg
+	}
+
+	rp.clientMsg, _ = json.Marshal(rp.res)
+	return rp.clientMsg
+}
+
+// Delivers a packet for every channel it was published on
+func (h *Hub) processRoutes(rp *routedPacket) {
+	for _, channel := range rp.channels {
+		h.processRoute(rp, channel)
+	}
+}
+
+// Delivers a packet to the clients on this ingest who are listening on one of
+// its channels
+func (h *Hub) processRoute(rp *routedPacket, channel string) {
+	// SendBytes takes room IDs, "character:<id>", or "*"
+	target := channel
+
+	if channel == "all" {
+		target = "*"
+	} else if strings.HasPrefix(channel, "room:") {
+		target = strings.TrimPrefix(channel, "room:")
+	}
+
+	switch p := rp.packet.(type) {
+	case packet.MovePacket:
+		h.sendMove(p, rp.msg)
+	case packet.LeavePacket:
+		if p.Character != nil {
+			h.forgetPosition(p.Character.ID)
+		}
+
+		h.SendBytes(target, rp.msg)
+	case packet.JoinPacket:
+		if channel == "character:"+p.Character.ID {
+			// Only one client per character at a time
+			for _, client := range h.recipients(channel) {
+				if client.id == p.ClientID {
+					continue
+				}
+
+				client := client
+				log.Println("disconnecting existing client for", p.Character.ID)
+
+				// This can run on any room's worker, or none, so disconnect
+				// them from their own
+				h.runForClientAsync(client, func() {
+					if h.isConnected(client) {
+						h.disconnectClient(client, false)
+					}
+				})
+			}
+
+			return
+		}
+
+		h.SendBytes(target, rp.clientPayload())
+	case packet.LogoutPacket:
+		// Their tokens were revoked, so kick them off everywhere
+		for _, client := range h.recipients(channel) {
+			h.sendAndClose(client, rp.clientPayload(), websocket.ClosePolicyViolation, p.Reason)
+		}
+	case packet.TeleportPacket:
+		h.forgetPosition(p.Character.ID)
+
+		if target == p.From {
+			leavePacket, _ := packet.NewLeavePacket(p.Character, p.From).MarshalBinary()
+			h.SendBytes(p.From, leavePacket)
+		}
+
+		if target == p.To {
+			joinPacket, _ := packet.NewJoinPacket(p.Character, p.To).MarshalBinary()
+			h.SendBytes(p.To, joinPacket)
+		}
+	default:
+		h.SendBytes(target, rp.clientPayload())
+	}
+}
+
+// Notes that we need to start or stop listening on a channel. Must be called
+// while holding h.mu
+func (h *Hub) queueSubscription(channel string, subscribe bool) {
+	h.pendingSubscriptions = append(h.pendingSubscriptions, subscriptionChange{channel, subscribe})
+}
+
+// Sends queued subscription changes on, in the order they were made. Must be
+// called without holding h.mu, since subscriptions can fill up
+func (h *Hub) flushSubscriptions() {
+	h.subscriptionsMu.Lock()
+	defer h.subscriptionsMu.Unlock()
+
+	h.mu.Lock()
+	changes := h.pendingSubscriptions
+	h.pendingSubscriptions = nil
+	h.mu.Unlock()
+
+	for _, change := range changes {
+		h.subscriptions <- change
+	}
+}
+
+type subscriptionChange struct {
+	channel   string
+	subscribe bool
+}
+
+// Applies subscription changes as rooms and characters come and go from this
+// ingest
+func (h *Hub) runSubscriptions() {
+	for change := range h.subscriptions {
+		var err error
+
+		if change.subscribe {
+			err = db.Subscribe(change.channel)
+		} else {
+			err = db.Unsubscribe(change.channel)
+		}
+
+		if err != nil {
+			log.Println("ERROR: Unable to update subscription to", change.channel, "->", err)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package socket
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/techx/playground/socket/packet"
+	"github.com/techx/playground/wire"
+
 	"github.com/gorilla/websocket"
 )
 
@@ -31,6 +35,7 @@ var (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    wire.Subprotocols,
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -38,30 +43,43 @@ var upgrader = websocket.Upgrader{
 // The application runs readPump in a per-connection goroutine. The application
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
-func (c *Client) readPump() {
+func (c *Client) readPump(conn *websocket.Conn) {
 	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close()
+		c.hub.unregister(c, conn)
+		conn.Close()
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+		if message, err = decodeMessage(message, c.format); err != nil {
+			log.Println("ERROR: Unable to decode packet from", c.id, "->", err)
+			continue
+		}
+
+		sendMessage := SocketMessage{msg: message, sender: c}
+		c.hub.dispatch(&sendMessage)
+	}
+}
 
-		sendMessage := SocketMessage{message, c}
-		c.hub.broadcast <- &sendMessage
+// Turns a message from the websocket connection into the JSON that handlers
+// expect
+func decodeMessage(message []byte, format wire.Format) ([]byte, error) {
+	if format == wire.JSON {
+		return bytes.TrimSpace(bytes.Replace(message, newline, space, -1)), nil
 	}
+
+	return wire.Decode(message, format)
 }
 
 // writePump pumps messages from the hub to the websocket connection.
@@ -69,49 +87,75 @@ func (c *Client) readPump() {
 // A goroutine running writePump is started for each connection. The
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
-func (c *Client) writePump() {
+func (c *Client) writePump(conn *websocket.Conn, send chan []byte, done chan struct{}) {
+	messageType := websocket.TextMessage
+
+	if c.format != wire.JSON {
+		messageType = websocket.BinaryMessage
+	}
+
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.conn.Close()
+		conn.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case message, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
+			w, err := conn.NextWriter(messageType)
 			if err != nil {
 				return
 			}
 			w.Write(message)
 
 			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
+			// MessagePack values mark their own ends, so they don't need a
+			// separator
+			n := len(send)
 			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
+				if c.format == wire.JSON {
+					w.Write(newline)
+				}
+				w.Write(<-send)
 			}
 
 			if err := w.Close(); err != nil {
 				return
 			}
+		case <-done:
+			// The read pump has stopped, or the client resumed elsewhere
+			return
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// Starts pumping messages over a connection. Each connection gets its own
+// queue, so that a resumed session never shares one with its old connection
+func (c *Client) start(conn *websocket.Conn, send chan []byte, done chan struct{}) {
+	go c.writePump(conn, send, done)
+	go c.readPump(conn)
+}
+
 // ServeWs handles websocket requests from the peer.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if hub.Draining() {
+		// Send them to another ingest
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	// TODO: Create more strict origin checks -- this is a security risk
 	upgrader.CheckOrigin = func(r *http.Request) bool {
 		return true
@@ -125,12 +169,48 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients that are reconnecting say which session they had in their first
+	// packet, so wait for it before setting up a new one
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	format := wire.FormatForSubprotocol(conn.Subprotocol())
+	_, first, err := conn.ReadMessage()
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if first, err = decodeMessage(first, format); err != nil {
+		log.Println("ERROR: Unable to decode first packet ->", err)
+		first = nil
+	}
+
+	var p packet.ResumePacket
+
+	if json.Unmarshal(first, &p) == nil && p.Type == "resume" {
+		if hub.resume(p, conn) {
+			return
+		}
+
+		// They'll get a new session instead, and have to join again
+		first = nil
+	}
+
 	// Create a new client with a unique ID
 	client := NewClient(hub, conn)
-	client.hub.register <- client
+	client.hub.register(client)
+
+	// Let the client know which session they're in before anything else
+	data, _ := packet.NewSessionPacket(client.sessionID, false).MarshalBinary()
+	client.send <- newOutgoing(data).bytes(client.format)
+
+	// Handle their first packet before the read pump gets to the rest
+	if first != nil {
+		client.hub.dispatch(&SocketMessage{msg: first, sender: client})
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines
-	go client.writePump()
-	go client.readPump()
+	client.start(conn, client.send, client.done)
 }
@@ -0,0 +1,201 @@
+package socket
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/techx/playground/auth"
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+	"github.com/techx/playground/socket/packet"
+	"github.com/techx/playground/wire"
+
+	"github.com/gorilla/websocket"
+)
+
+// A packet we've already sent a client, kept in case they need it again
+type sequencedMessage struct {
+	seq uint64
+	msg []byte
+}
+
+// Loads session settings from the config
+func (h *Hub) initSessions() {
+	h.sessions = map[string]*Client{}
+	h.sessionGracePeriod = time.Duration(config.GetConfig().GetInt("socket.sessions.grace_period_seconds")) * time.Second
+	h.replayBufferSize = config.GetConfig().GetInt("socket.sessions.replay_buffer_size")
+}
+
+// Numbers a message that's about to be queued for this client, and holds on to
+// it in case they reconnect. Must be called while holding the client's sendMu
+func (h *Hub) sequence(client *Client, msg []byte, droppable bool) []byte {
+	client.seq++
+	stamped := wire.Stamp(msg, client.format, client.seq)
+
+	if droppable {
+		// Not worth replaying, but clients still see its number so they know
+		// where they left off
+		return stamped
+	}
+
+	client.replay = append(client.replay, sequencedMessage{client.seq, stamped})
+
+	if size := h.replayBufferSize; len(client.replay) > size {
+		client.evictedSeq = client.replay[len(client.replay)-size-1].seq
+		client.replay = client.replay[len(client.replay)-size:]
+	}
+
+	return stamped
+}
+
+// Returns the packets this client hasn't seen yet, or false if some of them
+// have already fallen out of the replay buffer. Must be called while holding
+// sendMu
+func (c *Client) missedSince(lastSeq uint64) ([][]byte, bool) {
+	if lastSeq < c.evictedSeq || lastSeq > c.seq {
+		return nil, false
+	}
+
+	var missed [][]byte
+
+	for _, m := range c.replay {
+		if m.seq > lastSeq {
+			missed = append(missed, m.msg)
+		}
+	}
+
+	return missed, true
+}
+
+// Returns this client's current connection
+func (c *Client) connection() *websocket.Conn {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	return c.conn
+}
+
+// Lets this client resume their session if their connection drops. Only
+// clients who have joined are worth holding on to
+func (h *Hub) enableResume(client *Client) {
+	client.sendMu.Lock()
+	client.resumable = true
+	client.sendMu.Unlock()
+
+	h.mu.Lock()
+	h.sessions[client.sessionID] = client
+	h.mu.Unlock()
+}
+
+// Holds on to a client whose connection just dropped, so that they can pick up
+// where they left off if they reconnect soon. Returns false if this client
+// can't be resumed and should be disconnected now
+func (h *Hub) park(client *Client, conn *websocket.Conn) bool {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	if client.conn != conn {
+		// They've already resumed on a new connection
+		return true
+	}
+
+	// Stop the write pump for this connection
+	close(client.done)
+
+	if !client.resumable || h.sessionGracePeriod <= 0 {
+		return false
+	}
+
+	client.parked = true
+	client.generation++
+	generation := client.generation
+
+	time.AfterFunc(h.sessionGracePeriod, func() {
+		h.expireSession(client, generation)
+	})
+
+	return true
+}
+
+// Disconnects a parked client for good if they haven't come back since
+func (h *Hub) expireSession(client *Client, generation int) {
+	h.runForClient(client, func() {
+		client.sendMu.Lock()
+		expired := client.parked && client.generation == generation
+		client.sendMu.Unlock()
+
+		if !expired || !h.isConnected(client) {
+			return
+		}
+
+		h.disconnectClient(client, true)
+	})
+}
+
+// Attaches a new connection to an existing session, and queues up the packets
+// that the client missed while they were gone. Returns false if the session
+// can't be resumed, in which case the client should start a new one
+func (h *Hub) resume(p packet.ResumePacket, conn *websocket.Conn) bool {
+	h.mu.RLock()
+	client, ok := h.sessions[p.SessionID]
+	var character *models.Character
+
+	if ok {
+		character = client.character
+	}
+
+	h.mu.RUnlock()
+
+	if !ok || character == nil {
+		return false
+	}
+
+	// Resuming takes the same token as joining, and it has to belong to the
+	// character whose session this is
+	claims, err := auth.ParseToken(p.Token)
+
+	if err != nil || claims.CharacterID != character.ID {
+		log.Println("Rejected attempt to resume session for client", client.id)
+		return false
+	}
+
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	missed, ok := client.missedSince(p.Seq)
+
+	// The packets we kept are already encoded, so the client has to stick with
+	// the same format
+	sameFormat := wire.FormatForSubprotocol(conn.Subprotocol()) == client.format
+
+	if !ok || !sameFormat || len(missed)+1 > cap(client.send) {
+		log.Println("Unable to resume session for client", client.id)
+		return false
+	}
+
+	if !client.parked {
+		// We haven't noticed that their old connection is gone yet
+		close(client.done)
+		client.conn.Close()
+	}
+
+	// Anything still queued for the old connection is either in the replay
+	// buffer or wasn't worth replaying, so start over with a fresh queue
+	client.conn = conn
+	client.send = make(chan []byte, cap(client.send))
+	client.done = make(chan struct{})
+	client.parked = false
+	client.generation++
+	atomic.StoreInt32(&client.closing, 0)
+
+	data, _ := packet.NewSessionPacket(client.sessionID, true).MarshalBinary()
+	client.send <- newOutgoing(data).bytes(client.format)
+
+	for _, msg := range missed {
+		client.send <- msg
+	}
+
+	client.start(conn, client.send, client.done)
+	return true
+}
@@ -0,0 +1,181 @@
+package socket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/techx/playground/auth"
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/socket/packet"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Returns a client whose connection has dropped, and who can still resume
+// their session
+func newParkedClient(h *Hub) *Client {
+	client := newTestClient(h)
+	client.sessionID = uuid.New().String()
+	h.enableResume(client)
+
+	client.sendMu.Lock()
+	client.parked = true
+	client.sendMu.Unlock()
+
+	return client
+}
+
+// Reads packets off a connection one at a time, even when several share a
+// message
+type packetReader struct {
+	conn    *websocket.Conn
+	pending []string
+}
+
+func (r *packetReader) read(t *testing.T, v interface{}) {
+	if len(r.pending) == 0 {
+		r.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := r.conn.ReadMessage()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.pending = strings.Split(string(data), "\n")
+	}
+
+	if err := json.Unmarshal([]byte(r.pending[0]), v); err != nil {
+		t.Fatal(err)
+	}
+
+	r.pending = r.pending[1:]
+}
+
+// Connects to the hub and sends this packet first, returning a reader for the
+// connection and the session packet that comes back
+func connectWith(t *testing.T, url string, first interface{}) (*packetReader, *packet.SessionPacket) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.WriteJSON(first); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &packetReader{conn: conn}
+	var res packet.SessionPacket
+	r.read(t, &res)
+	return r, &res
+}
+
+func TestResume(t *testing.T) {
+	h := testHub
+	oldSecret, hadSecret := os.LookupEnv(string(config.JWTSecret))
+	os.Setenv(string(config.JWTSecret), "secret")
+
+	defer func() {
+		if hadSecret {
+			os.Setenv(string(config.JWTSecret), oldSecret)
+		} else {
+			os.Unsetenv(string(config.JWTSecret))
+		}
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(h, w, r)
+	}))
+
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name string
+
+		// Returns the token to resume with, and the session to resume
+		resume  func(client *Client) (string, string)
+		resumed bool
+	}{
+		{"their own token", func(client *Client) (string, string) {
+			tokens, _ := auth.IssueTokens(client.character.ID)
+			return tokens.Token, client.sessionID
+		}, true},
+		{"no token", func(client *Client) (string, string) {
+			return "", client.sessionID
+		}, false},
+		{"garbage token", func(client *Client) (string, string) {
+			return "not a token", client.sessionID
+		}, false},
+		{"someone else's token", func(client *Client) (string, string) {
+			tokens, _ := auth.IssueTokens(uuid.New().String())
+			return tokens.Token, client.sessionID
+		}, false},
+		{"refresh token", func(client *Client) (string, string) {
+			tokens, _ := auth.IssueTokens(client.character.ID)
+			return tokens.RefreshToken, client.sessionID
+		}, false},
+		{"unknown session", func(client *Client) (string, string) {
+			tokens, _ := auth.IssueTokens(client.character.ID)
+			return tokens.Token, uuid.New().String()
+		}, false},
+	}
+
+	for _, test := range tests {
+		client := newParkedClient(h)
+		token, sessionID := test.resume(client)
+
+		r, res := connectWith(t, url, map[string]interface{}{
+			"type":      "resume",
+			"sessionId": sessionID,
+			"seq":       0,
+			"token":     token,
+		})
+
+		if res.Resumed != test.resumed {
+			t.Errorf("%s: expected resumed to be %v, got %v", test.name, test.resumed, res.Resumed)
+		}
+
+		// Anyone who didn't get the session back gets a new one
+		if (res.SessionID == client.sessionID) != test.resumed {
+			t.Errorf("%s: expected session %s to be resumed: %v, got %s", test.name, client.sessionID, test.resumed, res.SessionID)
+		}
+
+		client.sendMu.Lock()
+		parked := client.parked
+		client.sendMu.Unlock()
+
+		if parked == test.resumed {
+			t.Errorf("%s: expected the old session to be parked: %v, got %v", test.name, !test.resumed, parked)
+		}
+
+		r.conn.Close()
+	}
+
+	// Clients that aren't resuming get a new session, and their first packet
+	// is handled as usual
+	r, res := connectWith(t, url, map[string]interface{}{"type": "join", "protocolVersion": 1000, "requestId": "first"})
+	defer r.conn.Close()
+
+	if res.Resumed || res.SessionID == "" {
+		t.Errorf("expected a new session, got %+v", res)
+	}
+
+	var reply struct {
+		Type      string `json:"type"`
+		Code      int    `json:"code"`
+		RequestID string `json:"requestId"`
+	}
+
+	r.read(t, &reply)
+
+	if reply.Code != int(IncompatibleProtocol) || reply.RequestID != "first" {
+		t.Errorf("expected an error for the first packet, got %+v", reply)
+	}
+}
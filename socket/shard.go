@@ -0,0 +1,215 @@
+package socket
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Size of each room's queue of pending work
+	shardQueueSize = 1024
+
+	// Shards for rooms that have been quiet this long shut down
+	shardIdleTimeout = time.Minute
+
+	// How long to wait on a room whose queue is full before giving up
+	shardSendTimeout = 5 * time.Second
+
+	// How much work from callers that can't wait can pile up behind a full
+	// queue before it's dropped
+	shardOverflowSize = 1024
+)
+
+// roomShard processes messages for every client in one room. Work within a
+// room happens in order, but separate rooms don't wait on each other
+type roomShard struct {
+	room  string
+	inbox chan func()
+
+	// Work that arrived while the inbox was full, from callers that can't
+	// wait. It runs once the inbox is empty, oldest first
+	overflowMu sync.Mutex
+	overflow   []func()
+
+	// Signaled when work is added to the overflow
+	wake chan struct{}
+
+	// Number of callers holding on to this shard that haven't been processed
+	// yet. Only incremented while holding the hub's shardsMu
+	pending int32
+}
+
+// Returns the shard for this room, starting one if needed. Callers must send
+// exactly one function to the shard's inbox afterwards
+func (h *Hub) acquireShard(room string) *roomShard {
+	h.shardsMu.Lock()
+	defer h.shardsMu.Unlock()
+
+	shard, ok := h.shards[room]
+
+	if !ok {
+		shard = &roomShard{
+			room:  room,
+			inbox: make(chan func(), shardQueueSize),
+			wake:  make(chan struct{}, 1),
+		}
+
+		h.shards[room] = shard
+		go h.runShard(shard)
+	}
+
+	atomic.AddInt32(&shard.pending, 1)
+	return shard
+}
+
+func (h *Hub) runShard(shard *roomShard) {
+	ticker := time.NewTicker(shardIdleTimeout)
+	defer ticker.Stop()
+
+	lastActive := time.Now()
+
+	for {
+		// The overflow only fills up behind a full inbox, so everything in
+		// the inbox goes first
+		select {
+		case fn := <-shard.inbox:
+			atomic.AddInt32(&shard.pending, -1)
+			fn()
+			lastActive = time.Now()
+			continue
+		default:
+		}
+
+		if fn := shard.popOverflow(); fn != nil {
+			atomic.AddInt32(&shard.pending, -1)
+			fn()
+			lastActive = time.Now()
+			continue
+		}
+
+		select {
+		case fn := <-shard.inbox:
+			atomic.AddInt32(&shard.pending, -1)
+			fn()
+			lastActive = time.Now()
+		case <-shard.wake:
+		case <-ticker.C:
+			if time.Since(lastActive) < shardIdleTimeout {
+				continue
+			}
+
+			h.shardsMu.Lock()
+
+			if atomic.LoadInt32(&shard.pending) == 0 {
+				// Nobody can acquire this shard while we hold the lock, so it's
+				// safe to shut down
+				delete(h.shards, shard.room)
+				h.shardsMu.Unlock()
+				return
+			}
+
+			h.shardsMu.Unlock()
+		}
+	}
+}
+
+// Runs fn on the shard for whichever room this client is currently in. Work for
+// a single client never runs concurrently, even if they switch rooms midway.
+// Waits up to shardSendTimeout if the room is backed up, then drops fn and
+// returns false
+func (h *Hub) runForClient(client *Client, fn func()) bool {
+	shard, work := h.clientWork(client, fn)
+
+	select {
+	case shard.inbox <- work:
+		return true
+	default:
+	}
+
+	return h.sendToShard(shard, client, work)
+}
+
+// runForClientAsync is runForClient for callers that can't wait on a room,
+// like the hub's own loop. If the room is backed up, fn goes in the shard's
+// overflow instead, and if that's full too, fn is dropped and this returns
+// false
+func (h *Hub) runForClientAsync(client *Client, fn func()) bool {
+	shard, work := h.clientWork(client, fn)
+
+	shard.overflowMu.Lock()
+	defer shard.overflowMu.Unlock()
+
+	// Work that's already waiting in the overflow stays ahead of this
+	if len(shard.overflow) == 0 {
+		select {
+		case shard.inbox <- work:
+			return true
+		default:
+		}
+	}
+
+	if len(shard.overflow) >= shardOverflowSize {
+		// We acquired the shard but never gave it anything to do
+		atomic.AddInt32(&shard.pending, -1)
+		log.Println("ERROR: Room", shard.room, "is backed up, dropping work for client", client.id)
+		return false
+	}
+
+	shard.overflow = append(shard.overflow, work)
+
+	select {
+	case shard.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Takes the oldest work out of the overflow, or returns nil if there isn't any
+func (shard *roomShard) popOverflow() func() {
+	shard.overflowMu.Lock()
+	defer shard.overflowMu.Unlock()
+
+	if len(shard.overflow) == 0 {
+		return nil
+	}
+
+	work := shard.overflow[0]
+	shard.overflow[0] = nil
+	shard.overflow = shard.overflow[1:]
+	return work
+}
+
+// Wraps fn so that it holds the client's lock, and acquires the shard it
+// should run on. The caller must then send it to the shard's inbox or call
+// sendToShard
+func (h *Hub) clientWork(client *Client, fn func()) (*roomShard, func()) {
+	h.mu.RLock()
+	room := client.room
+	h.mu.RUnlock()
+
+	return h.acquireShard(room), func() {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+
+		fn()
+	}
+}
+
+// Sends work to a shard, giving up after shardSendTimeout
+func (h *Hub) sendToShard(shard *roomShard, client *Client, work func()) bool {
+	timer := time.NewTimer(shardSendTimeout)
+	defer timer.Stop()
+
+	select {
+	case shard.inbox <- work:
+		return true
+	case <-timer.C:
+		// We acquired the shard but never gave it anything to do
+		atomic.AddInt32(&shard.pending, -1)
+		log.Println("ERROR: Room", shard.room, "is backed up, dropping work for client", client.id)
+		return false
+	}
+}
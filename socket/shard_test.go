@@ -0,0 +1,78 @@
+package socket
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRunForClientAsync(t *testing.T) {
+	h := testHub
+
+	tests := []struct {
+		name    string
+		sends   int
+		dropped int
+	}{
+		{"room in the inbox", 1, 0},
+		{"inbox full", shardQueueSize + 10, 0},
+		{"overflow full", shardQueueSize + shardOverflowSize + 10, 10},
+	}
+
+	for _, test := range tests {
+		client := newTestClient(h)
+
+		// Every test gets a room of its own, so that nothing else is queued
+		h.mu.Lock()
+		client.room = uuid.New().String()
+		h.mu.Unlock()
+
+		// Hold up the room until everything has been sent
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		h.runForClient(client, func() {
+			close(started)
+			<-release
+		})
+
+		<-started
+		goroutines := runtime.NumGoroutine()
+
+		ran := make(chan int, test.sends)
+		dropped := 0
+
+		for i := 0; i < test.sends; i++ {
+			i := i
+
+			if !h.runForClientAsync(client, func() { ran <- i }) {
+				dropped++
+			}
+		}
+
+		if dropped != test.dropped {
+			t.Errorf("%s: expected %d to be dropped, got %d", test.name, test.dropped, dropped)
+		}
+
+		// Nothing waits on the room in the background
+		if now := runtime.NumGoroutine(); now > goroutines {
+			t.Errorf("%s: expected no new goroutines, went from %d to %d", test.name, goroutines, now)
+		}
+
+		close(release)
+
+		// Whatever wasn't dropped runs in the order it was sent
+		for i := 0; i < test.sends-test.dropped; i++ {
+			select {
+			case got := <-ran:
+				if got != i {
+					t.Fatalf("%s: expected work %d to run next, got %d", test.name, i, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: expected work %d to run", test.name, i)
+			}
+		}
+	}
+}
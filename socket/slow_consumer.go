@@ -0,0 +1,176 @@
+package socket
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/techx/playground/config"
+	"github.com/techx/playground/db/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// SlowConsumerPolicy decides what happens when a client can't keep up with the
+// packets we're sending them
+type SlowConsumerPolicy string
+
+const (
+	// Drop packets the client can live without (e.g. moves) once their queue
+	// starts filling up, and only disconnect them if a critical packet
+	// doesn't fit
+	DropNonCritical SlowConsumerPolicy = "drop"
+
+	// Disconnect the client as soon as their queue is full
+	Disconnect SlowConsumerPolicy = "disconnect"
+)
+
+// SlowConsumerStats counts how often each policy has kicked in
+type SlowConsumerStats struct {
+	// Packets dropped for clients using the drop policy
+	Dropped int64 `json:"dropped"`
+
+	// Clients using the drop policy who were disconnected because a critical
+	// packet didn't fit in their queue
+	DropPolicyDisconnects int64 `json:"dropPolicyDisconnects"`
+
+	// Clients using the disconnect policy who were disconnected
+	DisconnectPolicyDisconnects int64 `json:"disconnectPolicyDisconnects"`
+}
+
+var slowConsumerStats SlowConsumerStats
+
+// GetSlowConsumerStats returns the number of times each slow consumer policy
+// has kicked in since the server started
+func GetSlowConsumerStats() SlowConsumerStats {
+	return SlowConsumerStats{
+		Dropped:                     atomic.LoadInt64(&slowConsumerStats.Dropped),
+		DropPolicyDisconnects:       atomic.LoadInt64(&slowConsumerStats.DropPolicyDisconnects),
+		DisconnectPolicyDisconnects: atomic.LoadInt64(&slowConsumerStats.DisconnectPolicyDisconnects),
+	}
+}
+
+// Returns the policy that clients with this role should use
+func slowConsumerPolicy(role models.Role) SlowConsumerPolicy {
+	policy := config.GetConfig().GetString("socket.slow_consumers.role_policies." + role.String())
+
+	if policy == "" {
+		policy = config.GetConfig().GetString("socket.slow_consumers.policy")
+	}
+
+	if SlowConsumerPolicy(policy) == Disconnect {
+		return Disconnect
+	}
+
+	return DropNonCritical
+}
+
+// Loads slow consumer settings from the config so we don't have to look them
+// up for every packet
+func (h *Hub) initSlowConsumers() {
+	h.dropThreshold = config.GetConfig().GetFloat64("socket.slow_consumers.drop_threshold")
+	h.droppablePackets = map[string]bool{}
+
+	for _, packetType := range config.GetConfig().GetStringSlice("socket.slow_consumers.droppable_packets") {
+		h.droppablePackets[packetType] = true
+	}
+}
+
+// Returns true if clients can miss this packet without their state going stale
+func (h *Hub) isDroppable(msg []byte) bool {
+	var res struct {
+		Type string `json:"type"`
+	}
+
+	json.Unmarshal(msg, &res)
+	return h.droppablePackets[res.Type]
+}
+
+// Sends a message to a single client without blocking, falling back on the
+// client's slow consumer policy if they're behind
+func (h *Hub) sendTo(client *Client, msg []byte) {
+	h.deliver(client, newOutgoing(msg), h.isDroppable(msg))
+}
+
+func (h *Hub) deliver(client *Client, out *outgoing, droppable bool) {
+	msg := out.bytes(client.format)
+
+	if msg == nil {
+		return
+	}
+
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	if client.parked {
+		// Their connection is down, so hold on to this in case they come back
+		if !droppable {
+			h.sequence(client, msg, false)
+		}
+
+		return
+	}
+
+	if client.policy == DropNonCritical && droppable {
+		if float64(len(client.send)) >= h.dropThreshold*float64(cap(client.send)) {
+			// Leave room in the queue for packets that matter more
+			atomic.AddInt64(&slowConsumerStats.Dropped, 1)
+			return
+		}
+	}
+
+	msg = h.sequence(client, msg, droppable)
+
+	select {
+	case client.send <- msg:
+	default:
+		if droppable && client.policy == DropNonCritical {
+			atomic.AddInt64(&slowConsumerStats.Dropped, 1)
+			return
+		}
+
+		if client.policy == Disconnect {
+			atomic.AddInt64(&slowConsumerStats.DisconnectPolicyDisconnects, 1)
+		} else {
+			atomic.AddInt64(&slowConsumerStats.DropPolicyDisconnects, 1)
+		}
+
+		// They can't keep up, so don't park them and keep buffering packets
+		// for them to resume with
+		client.resumable = false
+		go client.closeWithReason(websocket.ClosePolicyViolation, "slow consumer")
+	}
+}
+
+// Tells the client why we're disconnecting them and closes their connection.
+// Their read pump will then unregister them like any other disconnect
+func (c *Client) closeWithReason(code int, reason string) {
+	if !atomic.CompareAndSwapInt32(&c.closing, 0, 1) {
+		// Already on its way out
+		return
+	}
+
+	log.Println("Disconnecting client", c.id, "->", reason)
+
+	// WriteControl is safe to call alongside the write pump
+	conn := c.connection()
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+	conn.Close()
+}
+
+// Periodically logs slow consumer stats, if anything has happened
+func logSlowConsumerStats() {
+	var last SlowConsumerStats
+
+	for range time.NewTicker(time.Minute).C {
+		stats := GetSlowConsumerStats()
+
+		if stats != last {
+			log.Printf("Slow consumers: %d packets dropped, %d disconnected (drop policy), %d disconnected (disconnect policy)",
+				stats.Dropped, stats.DropPolicyDisconnects, stats.DisconnectPolicyDisconnects)
+			last = stats
+		}
+	}
+}
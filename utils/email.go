@@ -1,28 +1,18 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/techx/playground/mail"
+
 	"github.com/matcornic/hermes/v2"
 )
 
-const (
-	// Sender
-	Sender = "Blueprint <noreply@hackmit.org>"
-
-	// The subject line for the email.
-	Subject = "Blueprint Playground Confirmation"
-
-	// The character encoding for the email.
-	CharSet = "UTF-8"
-
-	ReplyTo = "blueprint@hackmit.org"
-)
+// The subject line for the email.
+const Subject = "Blueprint Playground Confirmation"
 
-func SendConfirmationEmail(recipient string, code int, name string) {
+func SendConfirmationEmail(ctx context.Context, recipient string, code int, name string) error {
 	paddedCode := fmt.Sprintf("%06d", code)
 
 	h := hermes.Hermes{
@@ -56,45 +46,10 @@ func SendConfirmationEmail(recipient string, code int, name string) {
 	plainText, _ := h.GeneratePlainText(email)
 
 	// 2. send email to person
-	sess, _ := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1")},
-	)
-
-	// Create an SES session.
-	svc := ses.New(sess)
-
-	// Assemble the email.
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			CcAddresses: []*string{},
-			ToAddresses: []*string{
-				aws.String(recipient),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String(CharSet),
-					Data:    aws.String(html),
-				},
-				Text: &ses.Content{
-					Charset: aws.String(CharSet),
-					Data:    aws.String(plainText),
-				},
-			},
-			Subject: &ses.Content{
-				Charset: aws.String(CharSet),
-				Data:    aws.String(Subject),
-			},
-		},
-		ReplyToAddresses: []*string{aws.String(ReplyTo)},
-		Source:           aws.String(Sender),
-	}
-
-	// Attempt to send the email.
-	_, err := svc.SendEmail(input)
-
-	if err != nil {
-		fmt.Println(err)
-	}
+	return mail.Send(ctx, &mail.Message{
+		To:      recipient,
+		Subject: Subject,
+		HTML:    html,
+		Text:    plainText,
+	})
 }
@@ -0,0 +1,3 @@
+// Package wire converts packets between JSON, which the server works with
+// internally, and the other formats we can put on the wire
+package wire
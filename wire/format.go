@@ -0,0 +1,184 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Format is an encoding that packets can be sent in
+type Format string
+
+const (
+	JSON        Format = "json"
+	MessagePack Format = "msgpack"
+)
+
+// Websocket subprotocols that clients can ask for, in the order we prefer them
+var Subprotocols = []string{
+	"playground.msgpack",
+	"playground.json",
+}
+
+// FormatForSubprotocol returns the format to use for a negotiated websocket
+// subprotocol. Clients that don't ask for one get JSON
+func FormatForSubprotocol(subprotocol string) Format {
+	if subprotocol == "playground.msgpack" {
+		return MessagePack
+	}
+
+	return JSON
+}
+
+// Encode converts a JSON packet into the given format
+func Encode(data []byte, format Format) ([]byte, error) {
+	if format != MessagePack {
+		return data, nil
+	}
+
+	var v interface{}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+
+	// Most of our numbers are whole, so don't spend 9 bytes on each of them
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode converts a packet in the given format back into JSON
+func Decode(data []byte, format Format) ([]byte, error) {
+	if format != MessagePack {
+		return data, nil
+	}
+
+	var v interface{}
+
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// IsMessagePack returns true if this packet is a MessagePack map rather than a
+// JSON object
+func IsMessagePack(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	return data[0]&0xf0 == 0x80 || data[0] == 0xde || data[0] == 0xdf
+}
+
+// Compact encodes a JSON packet for sending between ingests, falling back on
+// the JSON itself if it can't be encoded
+func Compact(data []byte) []byte {
+	packed, err := Encode(data, MessagePack)
+
+	if err != nil {
+		return data
+	}
+
+	return packed
+}
+
+// Expand turns a packet from another ingest back into JSON. Packets that are
+// already JSON are returned as-is
+func Expand(data []byte) ([]byte, error) {
+	if !IsMessagePack(data) {
+		return data, nil
+	}
+
+	return Decode(data, MessagePack)
+}
+
+// Stamp adds a sequence number as the first field of an encoded packet, e.g.
+// {"type":"chat",...} becomes {"seq":12,"type":"chat",...}
+func Stamp(data []byte, format Format, seq uint64) []byte {
+	if format == MessagePack {
+		return stampMessagePack(data, seq)
+	}
+
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+
+	stamped := make([]byte, 0, len(data)+24)
+	stamped = append(stamped, `{"seq":`...)
+	stamped = strconv.AppendUint(stamped, seq, 10)
+
+	if data[1] != '}' {
+		stamped = append(stamped, ',')
+	}
+
+	return append(stamped, data[1:]...)
+}
+
+func stampMessagePack(data []byte, seq uint64) []byte {
+	var size uint32
+	var rest []byte
+
+	switch {
+	case len(data) >= 1 && data[0]&0xf0 == 0x80:
+		size = uint32(data[0] & 0x0f)
+		rest = data[1:]
+	case len(data) >= 3 && data[0] == 0xde:
+		size = uint32(binary.BigEndian.Uint16(data[1:3]))
+		rest = data[3:]
+	case len(data) >= 5 && data[0] == 0xdf:
+		size = binary.BigEndian.Uint32(data[1:5])
+		rest = data[5:]
+	default:
+		// Not a map, so there's nowhere to put the number
+		return data
+	}
+
+	stamped := make([]byte, 0, len(data)+16)
+	size++
+
+	// Map header with room for one more field
+	switch {
+	case size <= 0x0f:
+		stamped = append(stamped, 0x80|byte(size))
+	case size <= 0xffff:
+		stamped = append(stamped, 0xde, byte(size>>8), byte(size))
+	default:
+		stamped = append(stamped, 0xdf)
+		stamped = append(stamped, make([]byte, 4)...)
+		binary.BigEndian.PutUint32(stamped[1:], size)
+	}
+
+	// The "seq" key, then its value as the smallest unsigned int that fits
+	stamped = append(stamped, 0xa3, 's', 'e', 'q')
+
+	switch {
+	case seq <= 0x7f:
+		stamped = append(stamped, byte(seq))
+	case seq <= 0xff:
+		stamped = append(stamped, 0xcc, byte(seq))
+	case seq <= 0xffff:
+		stamped = append(stamped, 0xcd, byte(seq>>8), byte(seq))
+	case seq <= 0xffffffff:
+		stamped = append(stamped, 0xce, byte(seq>>24), byte(seq>>16), byte(seq>>8), byte(seq))
+	default:
+		stamped = append(stamped, 0xcf)
+		stamped = append(stamped, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(stamped[len(stamped)-8:], seq)
+	}
+
+	return append(stamped, rest...)
+}
@@ -0,0 +1,197 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Returns a JSON packet with this many fields, including its type
+func packetWithFields(n int) []byte {
+	fields := []string{`"type":"test"`}
+
+	for i := 1; i < n; i++ {
+		fields = append(fields, fmt.Sprintf(`"field%d":%d`, i, i))
+	}
+
+	return []byte("{" + strings.Join(fields, ",") + "}")
+}
+
+// Decodes a JSON packet into a map, so packets can be compared regardless of
+// field order. Numbers are kept as they were written, so big ones stay exact
+func decodeJSON(t *testing.T, data []byte) map[string]interface{} {
+	var v map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", data, err)
+	}
+
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet string
+	}{
+		{"empty", `{}`},
+		{"move", `{"type":"move","id":"abc","x":0.25,"y":0.75}`},
+		{"whole numbers", `{"type":"error","code":4,"big":4294967296}`},
+		{"nested", `{"type":"init","room":{"id":"home","elements":[{"x":1,"tags":["a","b"]}]},"ok":true,"none":null}`},
+		{"unicode", `{"type":"chat","mssg":"héllo ☃"}`},
+		{"many fields", string(packetWithFields(40))},
+	}
+
+	for _, test := range tests {
+		for _, format := range []Format{JSON, MessagePack} {
+			encoded, err := Encode([]byte(test.packet), format)
+
+			if err != nil {
+				t.Fatalf("%s (%s): %v", test.name, format, err)
+			}
+
+			if format == MessagePack && !IsMessagePack(encoded) {
+				t.Errorf("%s: expected a MessagePack map, got %x", test.name, encoded)
+			}
+
+			decoded, err := Decode(encoded, format)
+
+			if err != nil {
+				t.Fatalf("%s (%s): %v", test.name, format, err)
+			}
+
+			if !reflect.DeepEqual(decodeJSON(t, decoded), decodeJSON(t, []byte(test.packet))) {
+				t.Errorf("%s (%s): expected %s, got %s", test.name, format, test.packet, decoded)
+			}
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	packet := []byte(`{"type":"move","id":"abc","x":0.5,"y":0.5}`)
+	compacted := Compact(packet)
+
+	if !IsMessagePack(compacted) || len(compacted) >= len(packet) {
+		t.Errorf("expected a smaller MessagePack packet, got %x", compacted)
+	}
+
+	expanded, err := Expand(compacted)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decodeJSON(t, expanded), decodeJSON(t, packet)) {
+		t.Errorf("expected %s, got %s", packet, expanded)
+	}
+
+	// Packets from ingests that still send JSON come through untouched
+	if expanded, _ := Expand(packet); string(expanded) != string(packet) {
+		t.Errorf("expected JSON to be left alone, got %s", expanded)
+	}
+
+	// Anything that can't be encoded is sent as-is
+	if compacted := Compact([]byte("not json")); string(compacted) != "not json" {
+		t.Errorf("expected invalid packets to be left alone, got %q", compacted)
+	}
+}
+
+func TestStampJSON(t *testing.T) {
+	tests := []struct {
+		packet   string
+		seq      uint64
+		expected string
+	}{
+		{`{"type":"chat"}`, 1, `{"seq":1,"type":"chat"}`},
+		{`{}`, 12, `{"seq":12}`},
+		{`{"type":"chat","mssg":"hi"}`, 18446744073709551615, `{"seq":18446744073709551615,"type":"chat","mssg":"hi"}`},
+
+		// Not objects, so there's nowhere to put the number
+		{`[1,2]`, 1, `[1,2]`},
+		{`{`, 1, `{`},
+	}
+
+	for _, test := range tests {
+		if stamped := Stamp([]byte(test.packet), JSON, test.seq); string(stamped) != test.expected {
+			t.Errorf("stamping %s with %d: expected %s, got %s", test.packet, test.seq, test.expected, stamped)
+		}
+	}
+}
+
+func TestStampMessagePack(t *testing.T) {
+	seqs := []uint64{0, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000, 0xffffffff, 0x100000000, 18446744073709551615}
+
+	// Field counts that cross each map header size once the seq is added
+	fieldCounts := []int{1, 14, 15, 16, 100}
+
+	for _, fields := range fieldCounts {
+		packet := packetWithFields(fields)
+		encoded, err := Encode(packet, MessagePack)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, seq := range seqs {
+			decoded, err := Decode(Stamp(encoded, MessagePack, seq), MessagePack)
+
+			if err != nil {
+				t.Fatalf("%d fields, seq %d: %v", fields, seq, err)
+			}
+
+			res := decodeJSON(t, decoded)
+			expected := decodeJSON(t, packet)
+
+			if res["seq"] != json.Number(strconv.FormatUint(seq, 10)) {
+				t.Errorf("%d fields: expected seq %d, got %v", fields, seq, res["seq"])
+			}
+
+			delete(res, "seq")
+
+			if !reflect.DeepEqual(res, expected) {
+				t.Errorf("%d fields, seq %d: other fields changed, got %s", fields, seq, decoded)
+			}
+		}
+	}
+
+	// Encoders can use a 32-bit map header for small maps too
+	map32 := []byte{0xdf, 0x00, 0x00, 0x00, 0x01, 0xa1, 'a', 0x01}
+	decoded, err := Decode(Stamp(map32, MessagePack, 300), MessagePack)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := decodeJSON(t, decoded); res["seq"] != json.Number("300") || res["a"] != json.Number("1") {
+		t.Errorf("expected the 32-bit map to be stamped, got %s", decoded)
+	}
+
+	// Not a map, so there's nowhere to put the number
+	notMap := []byte{0x93, 0x01, 0x02, 0x03}
+
+	if stamped := Stamp(notMap, MessagePack, 1); string(stamped) != string(notMap) {
+		t.Errorf("expected arrays to be left alone, got %x", stamped)
+	}
+}
+
+func TestFormatForSubprotocol(t *testing.T) {
+	tests := map[string]Format{
+		"playground.msgpack": MessagePack,
+		"playground.json":    JSON,
+		"":                   JSON,
+		"something-else":     JSON,
+	}
+
+	for subprotocol, expected := range tests {
+		if format := FormatForSubprotocol(subprotocol); format != expected {
+			t.Errorf("%q: expected %s, got %s", subprotocol, expected, format)
+		}
+	}
+}